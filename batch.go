@@ -0,0 +1,284 @@
+package mbtiles
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"math"
+	"strconv"
+
+	"crawshaw.io/sqlite"
+	"crawshaw.io/sqlite/sqlitex"
+)
+
+// BatchWriter writes tiles in transactions of many tiles each, which is much
+// faster than writing each tile in its own transaction using WriteTile.  It
+// holds a single connection from the pool until Close is called.
+type BatchWriter struct {
+	db       *MBtiles
+	con      *sqlite.Conn
+	maxTiles int
+	maxBytes int64
+	tiles    int   // tiles written in the current transaction
+	bytes    int64 // bytes written in the current transaction
+	// extents are the ranges of tile columns and rows written at each zoom
+	// level, used to update metadata on Close
+	extents        map[int64]*tileExtent
+	updateMetadata bool
+	committed      int64 // tiles committed since the BatchWriter was created
+	progress       func(committed int64)
+}
+
+// tileExtent is a range of tile columns and rows at a zoom level.
+type tileExtent struct {
+	minX, minY, maxX, maxY int64
+}
+
+// BatchWriterOption sets an option for BatchWriter and ConcurrentWriter.
+type BatchWriterOption func(*BatchWriter)
+
+// WithoutMetadataUpdate prevents Close from updating the minzoom, maxzoom, and
+// bounds metadata items to include the tiles written.
+func WithoutMetadataUpdate() BatchWriterOption {
+	return func(w *BatchWriter) {
+		w.updateMetadata = false
+	}
+}
+
+// WithProgress calls fn after each commit with the total number of tiles
+// committed by the BatchWriter.
+func WithProgress(fn func(committed int64)) BatchWriterOption {
+	return func(w *BatchWriter) {
+		w.progress = fn
+	}
+}
+
+// BatchWriter returns a BatchWriter that commits its transaction after every
+// maxTiles tiles or maxBytes bytes of tile data, whichever comes first.  A
+// limit of 0 or less is ignored; if both are, tiles are only committed by
+// Flush or Close.  db must have been opened for writing, using Create or the
+// SQLITE_OPEN_READWRITE flag.  Close must be called to commit the remaining
+// tiles and release the connection; if the handle is rebound or closed in the
+// meantime, the BatchWriter continues to write to the previous file.  Writes
+// and commits are interrupted if ctx is cancelled.  Unless
+// WithoutMetadataUpdate is used, Close expands the minzoom, maxzoom, and bounds
+// metadata items to include the tiles written.
+func (db *MBtiles) BatchWriter(ctx context.Context, maxTiles int, maxBytes int64, opts ...BatchWriterOption) (*BatchWriter, error) {
+	if db == nil {
+		return nil, fmt.Errorf("cannot write tile: %w", ErrDatabaseClosed)
+	}
+
+	con, err := db.getConnection(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	if db.opts.Flags&sqlite.SQLITE_OPEN_READWRITE == 0 {
+		db.closeConnection(con)
+		return nil, errors.New("cannot write tiles to mbtiles database opened read-only")
+	}
+
+	w := &BatchWriter{
+		db:             db,
+		con:            con,
+		maxTiles:       maxTiles,
+		maxBytes:       maxBytes,
+		extents:        make(map[int64]*tileExtent),
+		updateMetadata: true,
+	}
+	for _, opt := range opts {
+		opt(w)
+	}
+	return w, nil
+}
+
+// WriteTile inserts or replaces the tile for z, x, y, starting a new
+// transaction if needed, and commits the transaction if either limit of the
+// BatchWriter is reached.  y must be in the TMS scheme used by mbtiles.
+func (w *BatchWriter) WriteTile(z int64, x int64, y int64, data []byte) error {
+	if w == nil || w.con == nil {
+		return errors.New("cannot write tile to closed batch writer")
+	}
+
+	if w.con.GetAutocommit() {
+		if err := sqlitex.ExecTransient(w.con, "BEGIN", nil); err != nil {
+			return err
+		}
+		w.tiles, w.bytes = 0, 0
+	}
+
+	write := writeTile
+	if w.db.isDedup() {
+		write = writeDedupTile
+	}
+	if err := write(w.con, z, x, y, data); err != nil {
+		return err
+	}
+	w.tiles++
+	w.bytes += int64(len(data))
+
+	if extent, ok := w.extents[z]; ok {
+		extent.minX, extent.maxX = min(extent.minX, x), max(extent.maxX, x)
+		extent.minY, extent.maxY = min(extent.minY, y), max(extent.maxY, y)
+	} else {
+		w.extents[z] = &tileExtent{minX: x, minY: y, maxX: x, maxY: y}
+	}
+
+	if (w.maxTiles > 0 && w.tiles >= w.maxTiles) || (w.maxBytes > 0 && w.bytes >= w.maxBytes) {
+		return w.Flush()
+	}
+	return nil
+}
+
+// Flush commits the tiles written since the last commit.
+func (w *BatchWriter) Flush() error {
+	if w == nil || w.con == nil {
+		return errors.New("cannot flush closed batch writer")
+	}
+	if w.con.GetAutocommit() {
+		return nil
+	}
+	tiles := w.tiles
+	w.tiles, w.bytes = 0, 0
+	if err := sqlitex.ExecTransient(w.con, "COMMIT", nil); err != nil {
+		return err
+	}
+	// cached metadata may include minzoom and maxzoom inferred from the tiles
+	w.db.InvalidateMetadata()
+	w.committed += int64(tiles)
+	if w.progress != nil {
+		w.progress(w.committed)
+	}
+	return w.db.updateZoomRange(w.con)
+}
+
+// Close commits the remaining tiles, updates metadata unless
+// WithoutMetadataUpdate was used, and returns the connection to the pool.  If
+// the commit fails, the remaining tiles are rolled back and metadata are not
+// updated.
+func (w *BatchWriter) Close() error {
+	if w == nil || w.con == nil {
+		return nil
+	}
+	err := w.Flush()
+	if err != nil && !w.con.GetAutocommit() {
+		// the commit may have been interrupted by cancelling ctx, which
+		// would also interrupt the rollback
+		w.con.SetInterrupt(nil)
+		sqlitex.ExecTransient(w.con, "ROLLBACK", nil)
+	}
+	var minZoom, maxZoom int64
+	updated := false
+	if err == nil && w.updateMetadata && len(w.extents) > 0 {
+		minZoom, maxZoom, err = w.writeExtentMetadata()
+		updated = err == nil
+	}
+	w.db.closeConnection(w.con)
+	w.con = nil
+
+	if updated {
+		w.db.InvalidateMetadata()
+		w.db.setZoomRange(minZoom, maxZoom)
+	}
+	return err
+}
+
+// writeExtentMetadata expands the minzoom, maxzoom, and bounds metadata items
+// to include the tiles written, and returns the updated zoom levels.
+func (w *BatchWriter) writeExtentMetadata() (minZoom, maxZoom int64, err error) {
+	minZoom, maxZoom = int64(math.MaxInt64), int64(math.MinInt64)
+	bounds := []float64{180, 90, -180, -90}
+	for z, extent := range w.extents {
+		minZoom, maxZoom = min(minZoom, z), max(maxZoom, z)
+		west, south, _, _ := TileCoord{Z: z, X: extent.minX, Y: extent.minY}.Bounds()
+		_, _, east, north := TileCoord{Z: z, X: extent.maxX, Y: extent.maxY}.Bounds()
+		bounds = []float64{min(bounds[0], west), min(bounds[1], south), max(bounds[2], east), max(bounds[3], north)}
+	}
+
+	// existing values are kept if they include more than the tiles written
+	if value, present, err := readMetadataValue(w.con, "minzoom"); err != nil {
+		return 0, 0, err
+	} else if z, parseErr := strconv.ParseInt(value, 10, 64); present && parseErr == nil {
+		minZoom = min(minZoom, z)
+	}
+	if value, present, err := readMetadataValue(w.con, "maxzoom"); err != nil {
+		return 0, 0, err
+	} else if z, parseErr := strconv.ParseInt(value, 10, 64); present && parseErr == nil {
+		maxZoom = max(maxZoom, z)
+	}
+	if value, present, err := readMetadataValue(w.con, "bounds"); err != nil {
+		return 0, 0, err
+	} else if existing, parseErr := parseFloats(value); present && parseErr == nil && len(existing) == 4 &&
+		validLonLat(existing[0], existing[1]) && validLonLat(existing[2], existing[3]) && existing[0] <= existing[2] && existing[1] <= existing[3] {
+		// bounds that cross the antimeridian are replaced
+		bounds = []float64{min(bounds[0], existing[0]), min(bounds[1], existing[1]), max(bounds[2], existing[2]), max(bounds[3], existing[3])}
+	}
+
+	defer sqlitex.Save(w.con)(&err)
+	values := map[string]string{
+		"minzoom": strconv.FormatInt(minZoom, 10),
+		"maxzoom": strconv.FormatInt(maxZoom, 10),
+		"bounds":  formatFloats(bounds),
+	}
+	for key, value := range values {
+		if err = writeMetadataValue(w.con, key, value); err != nil {
+			return 0, 0, err
+		}
+	}
+	return minZoom, maxZoom, nil
+}
+
+// TileRecord is a tile written by WriteFrom.  Y is in the TMS scheme used by
+// mbtiles.
+type TileRecord struct {
+	Z    int64
+	X    int64
+	Y    int64
+	Data []byte
+}
+
+// WriteFrom writes the tiles received from tiles until it is closed, using a
+// BatchWriter with maxTiles, maxBytes, and opts, and returns the number of
+// tiles committed.  Tiles are written as they are received, so that they can
+// be generated and written in a pipeline without holding them in memory.
+// Tiles with invalid coordinates are skipped, and their errors are joined into
+// the returned error once tiles is closed; errors writing to the database stop
+// WriteFrom immediately.  If ctx is cancelled, tiles that have not been
+// committed are rolled back and ctx.Err() is returned.  db must have been
+// opened for writing, using Create or the SQLITE_OPEN_READWRITE flag.
+func (db *MBtiles) WriteFrom(ctx context.Context, tiles <-chan TileRecord, maxTiles int, maxBytes int64, opts ...BatchWriterOption) (committed int64, err error) {
+	w, err := db.BatchWriter(ctx, maxTiles, maxBytes, opts...)
+	if err != nil {
+		return 0, err
+	}
+	defer func() {
+		if closeErr := w.Close(); closeErr != nil && err == nil {
+			err = closeErr
+		}
+		committed = w.committed
+	}()
+
+	var errs []error
+	for {
+		select {
+		case <-ctx.Done():
+			return 0, ctx.Err()
+		case tile, ok := <-tiles:
+			if !ok {
+				return 0, errors.Join(errs...)
+			}
+			if err := validateTileCoord(tile.Z, tile.X, tile.Y); err != nil {
+				errs = append(errs, err)
+				continue
+			}
+			if err := w.WriteTile(tile.Z, tile.X, tile.Y, tile.Data); err != nil {
+				// writes are interrupted when ctx is cancelled; report the
+				// cancellation rather than the interrupt
+				if ctxErr := ctx.Err(); ctxErr != nil {
+					return 0, ctxErr
+				}
+				return 0, err
+			}
+		}
+	}
+}
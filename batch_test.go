@@ -0,0 +1,234 @@
+package mbtiles
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"path/filepath"
+	"testing"
+)
+
+func Test_BatchWriter(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "test.mbtiles")
+	db, err := Create(path, PNG)
+	if err != nil {
+		t.Fatal("Could not create:", path, err)
+	}
+	defer db.Close()
+
+	w, err := db.BatchWriter(context.Background(), 3, 0)
+	if err != nil {
+		t.Fatal("Could not create batch writer:", err)
+	}
+	for x := int64(0); x < 4; x++ {
+		if err := w.WriteTile(2, x, 0, []byte{byte(x)}); err != nil {
+			t.Fatal("Could not write tile:", err)
+		}
+	}
+	if w.tiles != 1 {
+		t.Error("BatchWriter did not commit after maxTiles, pending tiles:", w.tiles)
+	}
+
+	// tiles in the open transaction are not visible to other connections
+	count, err := db.CountTiles()
+	if err != nil {
+		t.Fatal("Could not count tiles:", err)
+	}
+	if count != 3 {
+		t.Error("Tile count", count, "before Close does not match expected value: 3")
+	}
+
+	if err := w.Close(); err != nil {
+		t.Fatal("Could not close batch writer:", err)
+	}
+	if err := w.WriteTile(2, 0, 0, nil); err == nil {
+		t.Error("WriteTile did not raise error for closed batch writer")
+	}
+
+	var data []byte
+	for x := int64(0); x < 4; x++ {
+		if err := db.ReadTile(2, x, 0, &data); err != nil {
+			t.Fatal("Could not read tile:", err)
+		}
+		if !bytes.Equal(data, []byte{byte(x)}) {
+			t.Error("Read tile", data, "does not match expected value", []byte{byte(x)})
+		}
+	}
+
+	// commit by size
+	w, err = db.BatchWriter(context.Background(), 0, 4)
+	if err != nil {
+		t.Fatal("Could not create batch writer:", err)
+	}
+	defer w.Close()
+	if err := w.WriteTile(3, 0, 0, []byte{1, 2, 3, 4, 5}); err != nil {
+		t.Fatal("Could not write tile:", err)
+	}
+	if w.tiles != 0 {
+		t.Error("BatchWriter did not commit after maxBytes, pending tiles:", w.tiles)
+	}
+}
+
+func Test_BatchWriter_open(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "test.mbtiles")
+	db, err := Create(path, PNG)
+	if err != nil {
+		t.Fatal("Could not create:", path, err)
+	}
+	defer db.Close()
+
+	// closing a BatchWriter while another is open updates metadata
+	other, err := db.BatchWriter(context.Background(), 0, 0)
+	if err != nil {
+		t.Fatal("Could not create batch writer:", err)
+	}
+	defer other.Close()
+	w, err := db.BatchWriter(context.Background(), 0, 0)
+	if err != nil {
+		t.Fatal("Could not create batch writer:", err)
+	}
+	if err := w.WriteTile(3, 0, 0, []byte{1}); err != nil {
+		t.Fatal("Could not write tile:", err)
+	}
+	if err := w.Close(); err != nil {
+		t.Fatal("Could not close batch writer:", err)
+	}
+	if db.GetMaxZoom() != 3 {
+		t.Error("GetMaxZoom", db.GetMaxZoom(), "does not match expected value: 3")
+	}
+}
+
+func Test_BatchWriter_readonly(t *testing.T) {
+	db, err := Open("./testdata/geography-class-png.mbtiles")
+	if err != nil {
+		t.Fatal("Could not open mbtiles:", err)
+	}
+	defer db.Close()
+
+	if _, err := db.BatchWriter(context.Background(), 100, 0); err == nil {
+		t.Error("BatchWriter did not raise error for read-only database")
+	}
+}
+
+func Test_BatchWriter_metadata(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "test.mbtiles")
+	db, err := CreateWithMetadata(path, PNG, map[string]string{"minzoom": "2", "bounds": "-10,-10,10,10"})
+	if err != nil {
+		t.Fatal("Could not create:", path, err)
+	}
+	defer db.Close()
+
+	w, err := db.BatchWriter(context.Background(), 0, 0)
+	if err != nil {
+		t.Fatal("Could not create batch writer:", err)
+	}
+	// northeast quadrant of the world at zoom 1, and a tile at zoom 3
+	if err := w.WriteTile(1, 1, 1, []byte{1}); err != nil {
+		t.Fatal("Could not write tile:", err)
+	}
+	if err := w.WriteTile(3, 4, 4, []byte{1}); err != nil {
+		t.Fatal("Could not write tile:", err)
+	}
+	if err := w.Close(); err != nil {
+		t.Fatal("Could not close batch writer:", err)
+	}
+
+	metadata, err := db.ReadMetadata()
+	if err != nil {
+		t.Fatal("Could not read metadata:", err)
+	}
+	if metadata["minzoom"] != 1 || metadata["maxzoom"] != 3 {
+		t.Error("Metadata zoom range", metadata["minzoom"], metadata["maxzoom"], "does not match expected value: 1 3")
+	}
+	if db.GetMinZoom() != 1 || db.GetMaxZoom() != 3 {
+		t.Error("Cached zoom range", db.GetMinZoom(), db.GetMaxZoom(), "does not match expected value: 1 3")
+	}
+	bounds, ok := metadata["bounds"].([]float64)
+	if !ok || len(bounds) != 4 || bounds[0] != -10 || bounds[1] != -10 || bounds[2] != 180 || bounds[3] < 85 {
+		t.Error("Metadata bounds", metadata["bounds"], "do not match expected value: [-10 -10 180 85.05...]")
+	}
+
+	// metadata are not changed by WithoutMetadataUpdate
+	w, err = db.BatchWriter(context.Background(), 0, 0, WithoutMetadataUpdate())
+	if err != nil {
+		t.Fatal("Could not create batch writer:", err)
+	}
+	if err := w.WriteTile(0, 0, 0, []byte{1}); err != nil {
+		t.Fatal("Could not write tile:", err)
+	}
+	if err := w.Close(); err != nil {
+		t.Fatal("Could not close batch writer:", err)
+	}
+	metadata, err = db.ReadMetadata()
+	if err != nil {
+		t.Fatal("Could not read metadata:", err)
+	}
+	if metadata["minzoom"] != 1 {
+		t.Error("Metadata minzoom", metadata["minzoom"], "was updated using WithoutMetadataUpdate")
+	}
+}
+
+func Test_WriteFrom(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "test.mbtiles")
+	db, err := Create(path, PNG)
+	if err != nil {
+		t.Fatal("Could not create:", path, err)
+	}
+	defer db.Close()
+
+	tiles := make(chan TileRecord)
+	go func() {
+		defer close(tiles)
+		for x := int64(0); x < 4; x++ {
+			for y := int64(0); y < 4; y++ {
+				tiles <- TileRecord{Z: 2, X: x, Y: y, Data: []byte{byte(x), byte(y)}}
+			}
+		}
+		tiles <- TileRecord{Z: 2, X: 4, Y: 0, Data: []byte{1}}
+		tiles <- TileRecord{Z: -1, X: 0, Y: 0, Data: []byte{1}}
+	}()
+
+	var progress []int64
+	committed, err := db.WriteFrom(context.Background(), tiles, 5, 0, WithProgress(func(committed int64) {
+		progress = append(progress, committed)
+	}))
+	if err == nil {
+		t.Error("WriteFrom did not raise error for invalid tile coordinates")
+	}
+	if committed != 16 {
+		t.Error("WriteFrom committed", committed, "tiles instead of expected value: 16")
+	}
+	if len(progress) != 4 || progress[0] != 5 || progress[3] != 16 {
+		t.Error("Progress", progress, "does not match expected value: [5 10 15 16]")
+	}
+
+	count, err := db.CountTiles()
+	if err != nil {
+		t.Fatal("Could not count tiles:", err)
+	}
+	if count != 16 {
+		t.Error("Tile count", count, "does not match expected value: 16")
+	}
+
+	// tiles that have not been committed are rolled back on cancellation
+	ctx, cancel := context.WithCancel(context.Background())
+	tiles = make(chan TileRecord)
+	go func() {
+		tiles <- TileRecord{Z: 0, X: 0, Y: 0, Data: []byte{1}}
+		cancel()
+	}()
+	committed, err = db.WriteFrom(ctx, tiles, 0, 0)
+	if !errors.Is(err, context.Canceled) {
+		t.Error("WriteFrom did not return context.Canceled, got:", err)
+	}
+	if committed != 0 {
+		t.Error("WriteFrom committed", committed, "tiles instead of expected value: 0")
+	}
+	exists, err := db.HasTile(0, 0, 0)
+	if err != nil {
+		t.Fatal("Could not check tile:", err)
+	}
+	if exists {
+		t.Error("Tile written before cancellation was not rolled back")
+	}
+}
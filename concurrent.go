@@ -0,0 +1,115 @@
+package mbtiles
+
+import (
+	"context"
+	"errors"
+	"sync"
+)
+
+// ConcurrentWriter writes tiles from multiple goroutines through a single
+// connection.  Tiles are sent to a bounded queue and written by a background
+// goroutine using a BatchWriter; WriteTile blocks while the queue is full.
+type ConcurrentWriter struct {
+	mu     sync.RWMutex // guards closed; held for reading while sending
+	closed bool
+	queue  chan queuedTile
+	done   chan struct{}
+	errMu  sync.Mutex
+	err    error // first error raised by the background goroutine
+}
+
+// queuedTile is a tile waiting to be written by a ConcurrentWriter.
+type queuedTile struct {
+	z, x, y int64
+	data    []byte
+}
+
+// ConcurrentWriter returns a ConcurrentWriter that queues up to queueSize
+// tiles and writes them in transactions as for BatchWriter with maxTiles,
+// maxBytes, and opts.  db must have been opened for writing, using Create or
+// the SQLITE_OPEN_READWRITE flag.  Close must be called to write the remaining
+// tiles and release the connection.
+func (db *MBtiles) ConcurrentWriter(ctx context.Context, queueSize int, maxTiles int, maxBytes int64, opts ...BatchWriterOption) (*ConcurrentWriter, error) {
+	batch, err := db.BatchWriter(ctx, maxTiles, maxBytes, opts...)
+	if err != nil {
+		return nil, err
+	}
+
+	w := &ConcurrentWriter{
+		queue: make(chan queuedTile, max(queueSize, 0)),
+		done:  make(chan struct{}),
+	}
+	go w.run(batch)
+	return w, nil
+}
+
+// run writes tiles from the queue until it is closed, then closes batch.
+// After an error, remaining tiles are discarded so that senders do not block.
+func (w *ConcurrentWriter) run(batch *BatchWriter) {
+	defer close(w.done)
+	for tile := range w.queue {
+		if w.Err() != nil {
+			continue
+		}
+		if err := batch.WriteTile(tile.z, tile.x, tile.y, tile.data); err != nil {
+			w.setErr(err)
+		}
+	}
+	if err := batch.Close(); err != nil {
+		w.setErr(err)
+	}
+}
+
+// WriteTile queues the tile for z, x, y to be inserted or replaced, blocking
+// while the queue is full.  y must be in the TMS scheme used by mbtiles.  data
+// must not be modified after calling WriteTile.  Returns the first error raised
+// while writing earlier tiles, if any, in which case the tile is not queued.
+// It is safe to call WriteTile from multiple goroutines.
+func (w *ConcurrentWriter) WriteTile(z int64, x int64, y int64, data []byte) error {
+	if w == nil {
+		return errors.New("cannot write tile to closed concurrent writer")
+	}
+	w.mu.RLock()
+	defer w.mu.RUnlock()
+	if w.closed {
+		return errors.New("cannot write tile to closed concurrent writer")
+	}
+	if err := w.Err(); err != nil {
+		return err
+	}
+	w.queue <- queuedTile{z: z, x: x, y: y, data: data}
+	return nil
+}
+
+// Err returns the first error raised while writing tiles, or nil.
+func (w *ConcurrentWriter) Err() error {
+	w.errMu.Lock()
+	defer w.errMu.Unlock()
+	return w.err
+}
+
+// setErr records err if no error has been recorded yet.
+func (w *ConcurrentWriter) setErr(err error) {
+	w.errMu.Lock()
+	defer w.errMu.Unlock()
+	if w.err == nil {
+		w.err = err
+	}
+}
+
+// Close waits for the queued tiles to be written and committed, updates
+// metadata as for BatchWriter, returns the connection to the pool, and returns
+// the first error raised while writing tiles, if any.
+func (w *ConcurrentWriter) Close() error {
+	if w == nil {
+		return nil
+	}
+	w.mu.Lock()
+	if !w.closed {
+		w.closed = true
+		close(w.queue)
+	}
+	w.mu.Unlock()
+	<-w.done
+	return w.Err()
+}
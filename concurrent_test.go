@@ -0,0 +1,62 @@
+package mbtiles
+
+import (
+	"context"
+	"path/filepath"
+	"sync"
+	"testing"
+)
+
+func Test_ConcurrentWriter(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "test.mbtiles")
+	db, err := Create(path, PNG)
+	if err != nil {
+		t.Fatal("Could not create:", path, err)
+	}
+	defer db.Close()
+
+	w, err := db.ConcurrentWriter(context.Background(), 4, 10, 0)
+	if err != nil {
+		t.Fatal("Could not create concurrent writer:", err)
+	}
+
+	var wg sync.WaitGroup
+	for x := int64(0); x < 8; x++ {
+		wg.Add(1)
+		go func(x int64) {
+			defer wg.Done()
+			for y := int64(0); y < 8; y++ {
+				if err := w.WriteTile(3, x, y, []byte{byte(x), byte(y)}); err != nil {
+					t.Error("Could not write tile:", err)
+				}
+			}
+		}(x)
+	}
+	wg.Wait()
+
+	if err := w.Close(); err != nil {
+		t.Fatal("Could not close concurrent writer:", err)
+	}
+	if err := w.Close(); err != nil {
+		t.Error("Unexpected error closing concurrent writer twice:", err)
+	}
+	if err := w.WriteTile(3, 0, 0, nil); err == nil {
+		t.Error("WriteTile did not raise error for closed concurrent writer")
+	}
+
+	count, err := db.CountTiles()
+	if err != nil {
+		t.Fatal("Could not count tiles:", err)
+	}
+	if count != 64 {
+		t.Error("Tile count", count, "does not match expected value: 64")
+	}
+
+	var data []byte
+	if err := db.ReadTile(3, 5, 6, &data); err != nil {
+		t.Fatal("Could not read tile:", err)
+	}
+	if len(data) != 2 || data[0] != 5 || data[1] != 6 {
+		t.Error("Read tile", data, "does not match expected value: [5 6]")
+	}
+}
@@ -0,0 +1,227 @@
+package mbtiles
+
+import (
+	"fmt"
+	"math"
+	"math/bits"
+)
+
+// TileCoord identifies a tile by zoom level, column, and row.
+type TileCoord struct {
+	Z int64
+	X int64
+	Y int64
+}
+
+// String returns the tile coordinates formatted as "z/x/y".
+func (c TileCoord) String() string {
+	return fmt.Sprintf("%d/%d/%d", c.Z, c.X, c.Y)
+}
+
+// Parent returns the tile at the next lower zoom level that contains c.  The
+// parent of a tile at zoom level 0 is the tile itself.
+func (c TileCoord) Parent() TileCoord {
+	if c.Z <= 0 {
+		return c
+	}
+	return TileCoord{Z: c.Z - 1, X: c.X >> 1, Y: c.Y >> 1}
+}
+
+// Children returns the four tiles at the next higher zoom level contained by c.
+func (c TileCoord) Children() [4]TileCoord {
+	z, x, y := c.Z+1, c.X<<1, c.Y<<1
+	return [4]TileCoord{
+		{Z: z, X: x, Y: y},
+		{Z: z, X: x + 1, Y: y},
+		{Z: z, X: x, Y: y + 1},
+		{Z: z, X: x + 1, Y: y + 1},
+	}
+}
+
+// FlipY returns c with y flipped between the TMS and XYZ schemes.
+func (c TileCoord) FlipY() TileCoord {
+	return TileCoord{Z: c.Z, X: c.X, Y: flipY(c.Z, c.Y)}
+}
+
+// Bounds returns the geographic bounds of the tile, where y is in the TMS
+// scheme used by mbtiles.
+func (c TileCoord) Bounds() (west, south, east, north float64) {
+	y := flipY(c.Z, c.Y)
+	return tileXToLon(c.X, c.Z), tileYToLat(y+1, c.Z), tileXToLon(c.X+1, c.Z), tileYToLat(y, c.Z)
+}
+
+// maxZoom is the highest zoom level at which the number of tiles along each
+// axis (1 << z) fits within an int64.
+const maxZoom = 62
+
+// TMSToXYZ converts tile coordinates from the TMS scheme used by mbtiles, where
+// y increases northward, to the XYZ scheme used by most web maps, where y
+// increases southward.  Only y is changed.  z must be between 0 and 62;
+// coordinates at other zoom levels are returned unchanged.
+func TMSToXYZ(z int64, x int64, y int64) (int64, int64, int64) {
+	return z, x, flipY(z, y)
+}
+
+// XYZToTMS converts tile coordinates from the XYZ scheme used by most web maps
+// to the TMS scheme used by mbtiles.  Only y is changed.  z must be between 0
+// and 62; coordinates at other zoom levels are returned unchanged.
+func XYZToTMS(z int64, x int64, y int64) (int64, int64, int64) {
+	return z, x, flipY(z, y)
+}
+
+// QuadkeyToTile converts a Bing Maps quadkey to tile coordinates, where y is in
+// the TMS scheme used by mbtiles.  The length of quadkey is the zoom level; an
+// empty quadkey is tile 0/0/0.
+func QuadkeyToTile(quadkey string) (z int64, x int64, y int64, err error) {
+	if len(quadkey) > maxZoom {
+		return 0, 0, 0, fmt.Errorf("quadkey must be at most %d characters, got: %d", maxZoom, len(quadkey))
+	}
+
+	z = int64(len(quadkey))
+	for i, c := range quadkey {
+		mask := int64(1) << (z - int64(i) - 1)
+		switch c {
+		case '0':
+		case '1':
+			x |= mask
+		case '2':
+			y |= mask
+		case '3':
+			x |= mask
+			y |= mask
+		default:
+			return 0, 0, 0, fmt.Errorf("invalid quadkey %q: character %q at position %d must be one of 0, 1, 2, 3", quadkey, c, i)
+		}
+	}
+
+	// quadkeys use the XYZ scheme
+	z, x, y = XYZToTMS(z, x, y)
+	return z, x, y, nil
+}
+
+// TileToQuadkey converts tile coordinates, where y is in the TMS scheme used by
+// mbtiles, to a Bing Maps quadkey.  Returns an error if z, x, or y are outside
+// the valid range of tiles.
+func TileToQuadkey(z int64, x int64, y int64) (string, error) {
+	if err := validateTileCoord(z, x, y); err != nil {
+		return "", err
+	}
+
+	// quadkeys use the XYZ scheme
+	_, _, y = TMSToXYZ(z, x, y)
+	quadkey := make([]byte, z)
+	for i := range quadkey {
+		mask := int64(1) << (z - int64(i) - 1)
+		digit := byte('0')
+		if x&mask != 0 {
+			digit++
+		}
+		if y&mask != 0 {
+			digit += 2
+		}
+		quadkey[i] = digit
+	}
+	return string(quadkey), nil
+}
+
+// validateTileCoord returns an error if z is outside the range 0 to 62, or if x
+// or y are outside the range of tiles at zoom z.
+func validateTileCoord(z int64, x int64, y int64) error {
+	if z < 0 || z > maxZoom {
+		return fmt.Errorf("zoom level must be between 0 and %d, got: %d", maxZoom, z)
+	}
+	n := int64(1) << z
+	if x < 0 || x >= n || y < 0 || y >= n {
+		return fmt.Errorf("tile coordinates %d/%d/%d are outside the valid range of tiles at zoom level %d", z, x, y, z)
+	}
+	return nil
+}
+
+// flipY flips y between the TMS and XYZ schemes at zoom z.
+func flipY(z int64, y int64) int64 {
+	if z < 0 || z > maxZoom {
+		return y
+	}
+	return (int64(1) << z) - 1 - y
+}
+
+// maxMercatorLatitude is the maximum latitude covered by Web Mercator tiles.
+const maxMercatorLatitude = 85.0511287798066
+
+// TileCountForBBox returns the number of tiles covering the bounding box
+// (in geographic coordinates) from minZoom through maxZoom, inclusive.
+// Latitudes are clamped to the valid Web Mercator range.  If west is greater
+// than east, the bounding box is assumed to cross the antimeridian.  Zoom
+// levels outside the valid range of 0 through 62 have no tiles.  Counts that
+// overflow int64 (e.g., the whole world at zoom level 32 or above) are
+// returned as math.MaxInt64.
+func TileCountForBBox(minZoom, maxZoom int64, west, south, east, north float64) int64 {
+	south = math.Max(south, -maxMercatorLatitude)
+	north = math.Min(north, maxMercatorLatitude)
+	if south > north {
+		return 0
+	}
+
+	var count int64
+	// maxZoom shadows the package constant, so zoom levels are checked using
+	// validateTileCoord
+	for z := max(minZoom, 0); z <= maxZoom && validateTileCoord(z, 0, 0) == nil; z++ {
+		minX := lonToTileX(west, z)
+		maxX := lonToTileX(east, z)
+		// y increases southward in XYZ scheme
+		minY := latToTileY(north, z)
+		maxY := latToTileY(south, z)
+
+		cols := maxX - minX + 1
+		if west > east {
+			cols = (int64(1)<<z - minX) + maxX + 1
+		}
+		hi, tiles := bits.Mul64(uint64(cols), uint64(maxY-minY+1))
+		if hi != 0 || tiles > math.MaxInt64-uint64(count) {
+			return math.MaxInt64
+		}
+		count += int64(tiles)
+	}
+	return count
+}
+
+// lonToTileX returns the tile column (x) that contains longitude at zoom z.
+func lonToTileX(lon float64, z int64) int64 {
+	n := int64(1) << z
+	lon = math.Max(math.Min(lon, 180), -180)
+	x := int64(math.Floor((lon + 180) / 360 * float64(n)))
+	return clampTile(x, n)
+}
+
+// latToTileY returns the tile row (y) in XYZ scheme that contains latitude at
+// zoom z.
+func latToTileY(lat float64, z int64) int64 {
+	n := int64(1) << z
+	lat = math.Max(math.Min(lat, maxMercatorLatitude), -maxMercatorLatitude)
+	rad := lat * math.Pi / 180
+	y := int64(math.Floor((1 - math.Log(math.Tan(rad)+1/math.Cos(rad))/math.Pi) / 2 * float64(n)))
+	return clampTile(y, n)
+}
+
+// tileXToLon returns the longitude of the west edge of tile column x at zoom z.
+func tileXToLon(x int64, z int64) float64 {
+	return float64(x)/float64(int64(1)<<z)*360 - 180
+}
+
+// tileYToLat returns the latitude of the north edge of tile row y in XYZ
+// scheme at zoom z.
+func tileYToLat(y int64, z int64) float64 {
+	n := math.Pi * (1 - 2*float64(y)/float64(int64(1)<<z))
+	return math.Atan(math.Sinh(n)) * 180 / math.Pi
+}
+
+// clampTile clamps a tile column or row to the range [0, n-1].
+func clampTile(v int64, n int64) int64 {
+	if v < 0 {
+		return 0
+	}
+	if v >= n {
+		return n - 1
+	}
+	return v
+}
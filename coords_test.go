@@ -0,0 +1,148 @@
+package mbtiles
+
+import (
+	"math"
+	"testing"
+)
+
+func Test_TileCountForBBox(t *testing.T) {
+	tests := []struct {
+		minZoom int64
+		maxZoom int64
+		bounds  []float64
+		count   int64
+	}{
+		// world bounds: 1 + 4 + 16 tiles
+		{minZoom: 0, maxZoom: 2, bounds: []float64{-180, -90, 180, 90}, count: 21},
+		// single quadrant at zoom 1
+		{minZoom: 1, maxZoom: 1, bounds: []float64{-179, 1, -1, 84}, count: 1},
+		// crosses the antimeridian
+		{minZoom: 2, maxZoom: 2, bounds: []float64{170, 1, -170, 10}, count: 2},
+		// inverted latitudes are empty
+		{minZoom: 0, maxZoom: 2, bounds: []float64{-10, 10, 10, -10}, count: 0},
+		// zoom levels outside the valid range have no tiles
+		{minZoom: -1, maxZoom: 0, bounds: []float64{-180, -90, 180, 90}, count: 1},
+		{minZoom: 63, maxZoom: 64, bounds: []float64{-180, -90, 180, 90}, count: 0},
+		{minZoom: 3, maxZoom: 2, bounds: []float64{-180, -90, 180, 90}, count: 0},
+		// world bounds: 4^31 tiles fit in int64, but 4^32 tiles do not
+		{minZoom: 31, maxZoom: 31, bounds: []float64{-180, -90, 180, 90}, count: 1 << 62},
+		{minZoom: 32, maxZoom: 32, bounds: []float64{-180, -90, 180, 90}, count: math.MaxInt64},
+		{minZoom: 31, maxZoom: 62, bounds: []float64{-180, -90, 180, 90}, count: math.MaxInt64},
+		// single tile at the maximum zoom level
+		{minZoom: 62, maxZoom: 62, bounds: []float64{0.5, 0.5, 0.5, 0.5}, count: 1},
+	}
+
+	for _, tc := range tests {
+		count := TileCountForBBox(tc.minZoom, tc.maxZoom, tc.bounds[0], tc.bounds[1], tc.bounds[2], tc.bounds[3])
+		if count != tc.count {
+			t.Error("TileCountForBBox returned", count, "expected", tc.count, "for:", tc.bounds)
+		}
+	}
+}
+
+func Test_TMSToXYZ(t *testing.T) {
+	tests := []struct {
+		z    int64
+		x    int64
+		tmsY int64
+		xyzY int64
+	}{
+		{z: 0, x: 0, tmsY: 0, xyzY: 0},
+		{z: 1, x: 1, tmsY: 0, xyzY: 1},
+		{z: 10, x: 5, tmsY: 1, xyzY: 1022},
+		{z: 30, x: 0, tmsY: 0, xyzY: 1<<30 - 1},
+		{z: 30, x: 1<<30 - 1, tmsY: 1<<30 - 1, xyzY: 0},
+		{z: 62, x: 0, tmsY: 0, xyzY: 1<<62 - 1},
+	}
+
+	for _, tc := range tests {
+		z, x, y := TMSToXYZ(tc.z, tc.x, tc.tmsY)
+		if z != tc.z || x != tc.x || y != tc.xyzY {
+			t.Error("TMSToXYZ returned", z, x, y, "expected", tc.z, tc.x, tc.xyzY)
+		}
+
+		z, x, y = XYZToTMS(tc.z, tc.x, tc.xyzY)
+		if z != tc.z || x != tc.x || y != tc.tmsY {
+			t.Error("XYZToTMS returned", z, x, y, "expected", tc.z, tc.x, tc.tmsY)
+		}
+	}
+
+	// zoom levels that would overflow are returned unchanged
+	if _, _, y := TMSToXYZ(63, 0, 5); y != 5 {
+		t.Error("TMSToXYZ did not return y unchanged for zoom 63, got:", y)
+	}
+}
+
+func Test_QuadkeyToTile(t *testing.T) {
+	tests := []struct {
+		quadkey string
+		z       int64
+		x       int64
+		y       int64 // TMS
+	}{
+		{quadkey: "", z: 0, x: 0, y: 0},
+		{quadkey: "0", z: 1, x: 0, y: 1},
+		{quadkey: "3", z: 1, x: 1, y: 0},
+		// example from https://learn.microsoft.com/en-us/bingmaps/articles/bing-maps-tile-system
+		// xyz 3/3/5
+		{quadkey: "213", z: 3, x: 3, y: 2},
+	}
+
+	for _, tc := range tests {
+		z, x, y, err := QuadkeyToTile(tc.quadkey)
+		if err != nil {
+			t.Error("Unexpected error converting quadkey:", tc.quadkey, err)
+			continue
+		}
+		if z != tc.z || x != tc.x || y != tc.y {
+			t.Error("QuadkeyToTile returned", z, x, y, "expected", tc.z, tc.x, tc.y, "for:", tc.quadkey)
+		}
+
+		quadkey, err := TileToQuadkey(tc.z, tc.x, tc.y)
+		if err != nil || quadkey != tc.quadkey {
+			t.Error("TileToQuadkey returned", quadkey, err, "expected", tc.quadkey)
+		}
+	}
+
+	for _, quadkey := range []string{"4", "01a"} {
+		if _, _, _, err := QuadkeyToTile(quadkey); err == nil {
+			t.Error("Invalid quadkey did not raise error:", quadkey)
+		}
+	}
+
+	if _, err := TileToQuadkey(1, 2, 0); err == nil {
+		t.Error("Invalid tile coordinates did not raise error")
+	}
+}
+
+func Test_TileCoord(t *testing.T) {
+	c := TileCoord{Z: 2, X: 1, Y: 3}
+
+	if s := c.String(); s != "2/1/3" {
+		t.Error("String returned:", s)
+	}
+	if p := c.Parent(); p != (TileCoord{Z: 1, X: 0, Y: 1}) {
+		t.Error("Parent returned:", p)
+	}
+	if p := (TileCoord{}).Parent(); p != (TileCoord{}) {
+		t.Error("Parent of zoom 0 tile returned:", p)
+	}
+	for _, child := range c.Children() {
+		if child.Z != 3 || child.Parent() != c {
+			t.Error("Children returned tile not contained by parent:", child)
+		}
+	}
+	if f := c.FlipY(); f != (TileCoord{Z: 2, X: 1, Y: 0}) {
+		t.Error("FlipY returned:", f)
+	}
+
+	west, south, east, north := TileCoord{Z: 0, X: 0, Y: 0}.Bounds()
+	if west != -180 || east != 180 || math.Abs(north-maxMercatorLatitude) > 1e-9 || math.Abs(south+maxMercatorLatitude) > 1e-9 {
+		t.Error("Bounds of zoom 0 tile returned:", west, south, east, north)
+	}
+	// TMS row 0 at zoom 1 is the southern half
+	west, south, east, north = TileCoord{Z: 1, X: 1, Y: 0}.Bounds()
+	if west != 0 || east != 180 || north != 0 || math.Abs(south+maxMercatorLatitude) > 1e-9 {
+		t.Error("Bounds of 1/1/0 returned:", west, south, east, north)
+	}
+}
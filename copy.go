@@ -0,0 +1,115 @@
+package mbtiles
+
+import (
+	"context"
+	"errors"
+	"fmt"
+
+	"crawshaw.io/sqlite"
+	"crawshaw.io/sqlite/sqlitex"
+)
+
+// CopyTilesTo copies tiles from minZoom through maxZoom, inclusive, that
+// intersect bounds (west, south, east, north in geographic coordinates) into
+// dst, which must have been opened using Create or CreateDeduplicated; tiles
+// copied into a deduplicated file share identical tile data.  Tiles are copied
+// as stored, without changing their scheme.  Metadata items are also copied,
+// except that minzoom, maxzoom, bounds, and center are updated to match the
+// copied tiles.  Tiles are streamed from a single connection and written to
+// dst within a single transaction.
+func (db *MBtiles) CopyTilesTo(dst *MBtiles, minZoom, maxZoom int64, bounds [4]float64) (err error) {
+	if db == nil || dst == nil {
+		return fmt.Errorf("cannot copy tiles: %w", ErrDatabaseClosed)
+	}
+	if db == dst {
+		return errors.New("cannot copy tiles into the same mbtiles database")
+	}
+	if err := validateTileCoord(minZoom, 0, 0); err != nil {
+		return err
+	}
+	if err := validateTileCoord(maxZoom, 0, 0); err != nil {
+		return err
+	}
+	if minZoom > maxZoom {
+		return fmt.Errorf("minZoom must be less than or equal to maxZoom, got: %d, %d", minZoom, maxZoom)
+	}
+	west, south, east, north := bounds[0], bounds[1], bounds[2], bounds[3]
+	if west > east || south > north {
+		return fmt.Errorf("invalid bounds: %v", bounds)
+	}
+
+	db.mu.RLock()
+	scheme := db.scheme
+	db.mu.RUnlock()
+
+	write := writeTile
+	if dst.isDedup() {
+		write = writeDedupTile
+	}
+
+	con, err := db.getConnection(context.TODO())
+	defer db.closeConnection(con)
+	if err != nil {
+		return err
+	}
+
+	dstCon, err := dst.getConnection(context.TODO())
+	defer dst.closeConnection(dstCon)
+	if err != nil {
+		return err
+	}
+
+	// cached metadata and zoom levels of dst are updated once the copy has
+	// been committed
+	defer func() {
+		if err == nil {
+			dst.InvalidateMetadata()
+			dst.setZoomRange(minZoom, maxZoom)
+		}
+	}()
+	defer sqlitex.Save(dstCon)(&err)
+
+	err = sqlitex.Exec(con, "select name, value from metadata where name not in ('minzoom', 'maxzoom', 'bounds', 'center')", func(stmt *sqlite.Stmt) error {
+		return writeMetadataValue(dstCon, stmt.ColumnText(0), stmt.ColumnText(1))
+	})
+	if err != nil {
+		return err
+	}
+
+	south = max(south, -maxMercatorLatitude)
+	north = min(north, maxMercatorLatitude)
+	metadata := map[string]string{
+		"minzoom": fmt.Sprint(minZoom),
+		"maxzoom": fmt.Sprint(maxZoom),
+		"bounds":  formatFloats([]float64{west, south, east, north}),
+		"center":  formatFloats([]float64{(west + east) / 2, (south + north) / 2, float64(minZoom)}),
+	}
+	for name, value := range metadata {
+		err = writeMetadataValue(dstCon, name, value)
+		if err != nil {
+			return err
+		}
+	}
+
+	for z := minZoom; z <= maxZoom; z++ {
+		minX, maxX := lonToTileX(west, z), lonToTileX(east, z)
+		// y increases southward in XYZ scheme
+		minY, maxY := latToTileY(north, z), latToTileY(south, z)
+		if scheme != "xyz" {
+			minY, maxY = flipY(z, maxY), flipY(z, minY)
+		}
+
+		err = sqlitex.Exec(con, `select tile_column, tile_row, tile_data from tiles
+			where zoom_level = ? and tile_column between ? and ? and tile_row between ? and ?`,
+			func(stmt *sqlite.Stmt) error {
+				data := make([]byte, stmt.ColumnLen(2))
+				stmt.ColumnBytes(2, data)
+				return write(dstCon, z, stmt.ColumnInt64(0), stmt.ColumnInt64(1), data)
+			}, z, minX, maxX, minY, maxY)
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
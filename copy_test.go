@@ -0,0 +1,133 @@
+package mbtiles
+
+import (
+	"bytes"
+	"path/filepath"
+	"testing"
+)
+
+func Test_CopyTilesTo(t *testing.T) {
+	src, err := Open("./testdata/geography-class-png.mbtiles")
+	if err != nil {
+		t.Fatal("Could not open source:", err)
+	}
+	defer src.Close()
+
+	path := filepath.Join(t.TempDir(), "extract.mbtiles")
+	dst, err := Create(path, PNG)
+	if err != nil {
+		t.Fatal("Could not create:", path, err)
+	}
+	defer dst.Close()
+
+	// metadata cached before the copy are replaced
+	if _, err := dst.ReadMetadata(); err != nil {
+		t.Fatal("Could not read metadata:", err)
+	}
+
+	// western hemisphere, northern half
+	err = src.CopyTilesTo(dst, 0, 1, [4]float64{-170, 10, -10, 80})
+	if err != nil {
+		t.Fatal("Could not copy tiles:", err)
+	}
+
+	tiles, err := dst.ListTiles(10, 0)
+	if err != nil {
+		t.Fatal("Could not list tiles:", err)
+	}
+	expected := []TileCoord{{Z: 0, X: 0, Y: 0}, {Z: 1, X: 0, Y: 1}}
+	if len(tiles) != len(expected) {
+		t.Fatal("Number of copied tiles", len(tiles), "does not match expected value", len(expected))
+	}
+	for i, tile := range tiles {
+		if tile.Z != expected[i].Z || tile.X != expected[i].X || tile.Y != expected[i].Y {
+			t.Error("Copied tile", tile, "does not match expected value", expected[i])
+		}
+	}
+
+	var srcData, dstData []byte
+	src.ReadTile(1, 0, 1, &srcData)
+	dst.ReadTile(1, 0, 1, &dstData)
+	if !bytes.Equal(srcData, dstData) {
+		t.Error("Copied tile data does not match source")
+	}
+
+	metadata, err := dst.ReadMetadata()
+	if err != nil {
+		t.Fatal("Could not read metadata:", err)
+	}
+	if metadata["name"] != "Geography Class" {
+		t.Error("Copied name", metadata["name"], "does not match expected value")
+	}
+	if metadata["maxzoom"] != 1 {
+		t.Error("Copied maxzoom", metadata["maxzoom"], "does not match expected value: 1")
+	}
+	if dst.GetMaxZoom() != 1 {
+		t.Error("GetMaxZoom", dst.GetMaxZoom(), "does not match expected value: 1")
+	}
+	bounds, ok := metadata["bounds"].([]float64)
+	if !ok || len(bounds) != 4 || bounds[0] != -170 || bounds[3] != 80 {
+		t.Error("Copied bounds", metadata["bounds"], "do not match expected value")
+	}
+}
+
+func Test_CopyTilesTo_dedup(t *testing.T) {
+	src, err := Open("./testdata/geography-class-png.mbtiles")
+	if err != nil {
+		t.Fatal("Could not open source:", err)
+	}
+	defer src.Close()
+
+	path := filepath.Join(t.TempDir(), "extract.mbtiles")
+	dst, err := CreateDeduplicated(path, PNG, nil)
+	if err != nil {
+		t.Fatal("Could not create:", path, err)
+	}
+	defer dst.Close()
+
+	if err = src.CopyTilesTo(dst, 0, 1, [4]float64{-180, -85, 180, 85}); err != nil {
+		t.Fatal("Could not copy tiles:", err)
+	}
+	count, err := dst.CountTiles()
+	if err != nil {
+		t.Fatal("Could not count tiles:", err)
+	}
+	if count != 5 {
+		t.Error("Number of copied tiles", count, "does not match expected value: 5")
+	}
+	var srcData, dstData []byte
+	src.ReadTile(1, 1, 0, &srcData)
+	dst.ReadTile(1, 1, 0, &dstData)
+	if !bytes.Equal(srcData, dstData) {
+		t.Error("Copied tile data does not match source")
+	}
+	hashes, err := dst.VerifyTileHashes()
+	if err != nil || len(hashes) != 0 {
+		t.Error("Copied tiles are not stored by hash:", hashes, err)
+	}
+}
+
+func Test_CopyTilesTo_invalid(t *testing.T) {
+	src, err := Open("./testdata/geography-class-png.mbtiles")
+	if err != nil {
+		t.Fatal("Could not open source:", err)
+	}
+	defer src.Close()
+
+	tests := []struct {
+		minZoom int64
+		maxZoom int64
+		bounds  [4]float64
+	}{
+		{minZoom: 2, maxZoom: 1, bounds: [4]float64{-180, -85, 180, 85}},
+		{minZoom: -1, maxZoom: 1, bounds: [4]float64{-180, -85, 180, 85}},
+		{minZoom: 0, maxZoom: 1, bounds: [4]float64{180, -85, -180, 85}},
+	}
+
+	for _, tc := range tests {
+		err = src.CopyTilesTo(src, tc.minZoom, tc.maxZoom, tc.bounds)
+		if err == nil {
+			t.Error("CopyTilesTo did not raise error for:", tc.minZoom, tc.maxZoom, tc.bounds)
+		}
+	}
+}
@@ -0,0 +1,175 @@
+package mbtiles
+
+import (
+	"context"
+	"crypto/md5"
+	"encoding/hex"
+	"errors"
+	"fmt"
+
+	"crawshaw.io/sqlite"
+	"crawshaw.io/sqlite/sqlitex"
+)
+
+// ValidateDedupIntegrity checks that every tile in the 'map' table of a
+// deduplicated mbtiles file references an existing row in the 'images' table,
+// and returns the coordinates of tiles that do not.  Y is in the TMS scheme
+// used by mbtiles.  Returns an error if the file does not use the deduplicated
+// schema.
+func (db *MBtiles) ValidateDedupIntegrity() ([]TileCoord, error) {
+	if db == nil {
+		return nil, fmt.Errorf("cannot read tile: %w", ErrDatabaseClosed)
+	}
+
+	con, err := db.getConnection(context.TODO())
+	defer db.closeConnection(con)
+	if err != nil {
+		return nil, err
+	}
+
+	isDedup, err := hasDedupSchema(con)
+	if err != nil {
+		return nil, err
+	}
+	if !isDedup {
+		return nil, errors.New("mbtiles file does not use deduplicated schema: missing one or more tables: map, images")
+	}
+
+	var missing []TileCoord
+	err = sqlitex.Exec(con, `select m.zoom_level, m.tile_column, m.tile_row from map m
+		left join images i on m.tile_id = i.tile_id
+		where i.tile_id is null
+		order by m.zoom_level, m.tile_column, m.tile_row`, func(stmt *sqlite.Stmt) error {
+		missing = append(missing, TileCoord{
+			Z: stmt.ColumnInt64(0),
+			X: stmt.ColumnInt64(1),
+			Y: stmt.ColumnInt64(2),
+		})
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return missing, nil
+}
+
+// hasDedupSchema returns true if both 'map' and 'images' tables are present in
+// the database.
+func hasDedupSchema(con *sqlite.Conn) (bool, error) {
+	query, _, err := con.PrepareTransient("SELECT count(*) as c FROM sqlite_master WHERE type = 'table' and name in ('map', 'images')")
+	if err != nil {
+		return false, err
+	}
+	defer query.Finalize()
+
+	_, err = query.Step()
+	if err != nil {
+		return false, err
+	}
+	return query.ColumnInt32(0) == 2, nil
+}
+
+// HashTile returns the hex encoded MD5 hash of data, which is used as the
+// tile_id of tiles written to files created using CreateDeduplicated, as in
+// files created by TileMill and mbutil.
+func HashTile(data []byte) string {
+	sum := md5.Sum(data)
+	return hex.EncodeToString(sum[:])
+}
+
+// TileHash returns the tile_id of the tile for z, x, y in a deduplicated
+// mbtiles file, or an empty string if the tile does not exist.  y must be in
+// the TMS scheme used by mbtiles.  For files created using CreateDeduplicated,
+// this is the value of HashTile for the tile data.  Returns an error if the
+// file does not use the deduplicated schema.
+func (db *MBtiles) TileHash(z int64, x int64, y int64) (string, error) {
+	if db == nil {
+		return "", fmt.Errorf("cannot read tile: %w", ErrDatabaseClosed)
+	}
+
+	con, err := db.getConnection(context.TODO())
+	defer db.closeConnection(con)
+	if err != nil {
+		return "", err
+	}
+
+	if !db.isDedup() {
+		return "", errors.New("mbtiles file does not use deduplicated schema: missing one or more tables: map, images")
+	}
+
+	var hash string
+	err = sqlitex.Exec(con, "select tile_id from map where zoom_level = ? and tile_column = ? and tile_row = ?", func(stmt *sqlite.Stmt) error {
+		hash = stmt.ColumnText(0)
+		return nil
+	}, z, x, y)
+	return hash, err
+}
+
+// VerifyTileHashes checks that the tile_id of every row in the 'images' table
+// of a deduplicated mbtiles file is the MD5 hash of its tile data, as for files
+// created using CreateDeduplicated, and returns the tile_ids that do not match.
+// Files created by some tools may use other tile_ids.  Returns an error if the
+// file does not use the deduplicated schema.
+func (db *MBtiles) VerifyTileHashes() ([]string, error) {
+	if db == nil {
+		return nil, fmt.Errorf("cannot read tile: %w", ErrDatabaseClosed)
+	}
+
+	con, err := db.getConnection(context.TODO())
+	defer db.closeConnection(con)
+	if err != nil {
+		return nil, err
+	}
+
+	if !db.isDedup() {
+		return nil, errors.New("mbtiles file does not use deduplicated schema: missing one or more tables: map, images")
+	}
+
+	var mismatched []string
+	err = sqlitex.Exec(con, "select tile_id, tile_data from images order by tile_id", func(stmt *sqlite.Stmt) error {
+		data := make([]byte, stmt.ColumnLen(1))
+		stmt.ColumnBytes(1, data)
+		if id := stmt.ColumnText(0); HashTile(data) != id {
+			mismatched = append(mismatched, id)
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return mismatched, nil
+}
+
+// writeDedupTile inserts or replaces the tile for z, x, y in a deduplicated
+// mbtiles file using con.  The tile data are only inserted into 'images' if no
+// tile with the same hash is present.  y must be in the TMS scheme used by
+// mbtiles.
+func writeDedupTile(con *sqlite.Conn, z int64, x int64, y int64, data []byte) (err error) {
+	defer sqlitex.Save(con)(&err)
+
+	hash := HashTile(data)
+	exists := false
+	err = sqlitex.Exec(con, "select 1 from images where tile_id = ?", func(stmt *sqlite.Stmt) error {
+		exists = true
+		return nil
+	}, hash)
+	if err != nil {
+		return err
+	}
+	if !exists {
+		err = sqlitex.Exec(con, "insert into images (tile_id, tile_data) values (?, ?)", nil, hash, data)
+		if err != nil {
+			return err
+		}
+	}
+
+	// grid_id is preserved for tiles that are replaced
+	return sqlitex.Exec(con, `insert into map (zoom_level, tile_column, tile_row, tile_id) values (?, ?, ?, ?)
+		on conflict (zoom_level, tile_column, tile_row) do update set tile_id = excluded.tile_id`, nil, z, x, y, hash)
+}
+
+// deleteUnusedImages deletes tile data from the 'images' table of a
+// deduplicated mbtiles file that are not referenced by any tile in 'map'.
+func deleteUnusedImages(con *sqlite.Conn) error {
+	return sqlitex.Exec(con, "delete from images where tile_id not in (select tile_id from map where tile_id is not null)", nil)
+}
@@ -0,0 +1,287 @@
+package mbtiles
+
+import (
+	"bytes"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"crawshaw.io/sqlite"
+	"crawshaw.io/sqlite/sqlitex"
+)
+
+func Test_ValidateDedupIntegrity(t *testing.T) {
+	path := createTestMBtiles(t, `
+		CREATE TABLE map (zoom_level integer, tile_column integer, tile_row integer, tile_id text);
+		CREATE TABLE images (tile_data blob, tile_id text);
+		CREATE VIEW tiles AS SELECT map.zoom_level AS zoom_level, map.tile_column AS tile_column, map.tile_row AS tile_row, images.tile_data AS tile_data
+			FROM map JOIN images ON images.tile_id = map.tile_id;
+		INSERT INTO images VALUES (x'89504e470d0a1a0a0000000d4948445200000100', 'a');
+		INSERT INTO map VALUES (0, 0, 0, 'a');
+		INSERT INTO map VALUES (1, 0, 0, 'a');
+		INSERT INTO map VALUES (1, 1, 0, 'missing');
+	`)
+
+	db, err := Open(path)
+	if err != nil {
+		t.Fatal("Could not open:", path, err)
+	}
+	defer db.Close()
+
+	missing, err := db.ValidateDedupIntegrity()
+	if err != nil {
+		t.Fatal("Unexpected error validating dedup integrity:", err)
+	}
+	if len(missing) != 1 || missing[0] != (TileCoord{Z: 1, X: 1, Y: 0}) {
+		t.Error("Missing tiles do not match expected values, got:", missing)
+	}
+}
+
+func Test_ValidateDedupIntegrity_fixture(t *testing.T) {
+	// geography-class-png.mbtiles uses the deduplicated schema
+	db, err := Open("./testdata/geography-class-png.mbtiles")
+	if err != nil {
+		t.Fatal("Could not open mbtiles:", err)
+	}
+	defer db.Close()
+
+	missing, err := db.ValidateDedupIntegrity()
+	if err != nil {
+		t.Fatal("Unexpected error validating dedup integrity:", err)
+	}
+	if len(missing) != 0 {
+		t.Error("ValidateDedupIntegrity found unexpected missing tiles:", missing)
+	}
+}
+
+func Test_ValidateDedupIntegrity_not_dedup(t *testing.T) {
+	db, err := Open("./testdata/world_cities.mbtiles")
+	if err != nil {
+		t.Fatal("Could not open mbtiles:", err)
+	}
+	defer db.Close()
+
+	_, err = db.ValidateDedupIntegrity()
+	if err == nil || !strings.Contains(err.Error(), "does not use deduplicated schema") {
+		t.Error("ValidateDedupIntegrity did not raise expected error, instead raised:", err)
+	}
+}
+
+func Test_Open_dedup(t *testing.T) {
+	path := createTestMBtiles(t, `
+		CREATE TABLE map (zoom_level integer, tile_column integer, tile_row integer, tile_id text);
+		CREATE TABLE images (tile_data blob, tile_id text);
+		CREATE VIEW tiles AS SELECT map.zoom_level AS zoom_level, map.tile_column AS tile_column, map.tile_row AS tile_row, images.tile_data AS tile_data
+			FROM map JOIN images ON images.tile_id = map.tile_id;
+		INSERT INTO images VALUES (x'89504e470d0a1a0a0000000d4948445200000200', 'a');
+		INSERT INTO map VALUES (0, 0, 0, 'a');
+		INSERT INTO map VALUES (1, 0, 0, 'a');
+	`)
+
+	db, err := Open(path)
+	if err != nil {
+		t.Fatal("Could not open:", path, err)
+	}
+	defer db.Close()
+
+	if db.GetTileFormat() != PNG {
+		t.Error("Tile format", db.GetTileFormat(), "does not match expected value", PNG)
+	}
+	if db.GetTileSize() != 512 {
+		t.Error("Tile size", db.GetTileSize(), "does not match expected value: 512")
+	}
+
+	var data []byte
+	err = db.ReadTile(1, 0, 0, &data)
+	if err != nil {
+		t.Fatal("Unexpected error reading tile:", err)
+	}
+	if len(data) != 20 {
+		t.Error("Tile data length", len(data), "does not match expected value: 20")
+	}
+}
+
+func Test_Open_dedup_missingView(t *testing.T) {
+	path := createTestMBtiles(t, `
+		CREATE TABLE map (zoom_level integer, tile_column integer, tile_row integer, tile_id text);
+		CREATE TABLE images (tile_data blob, tile_id text);
+	`)
+
+	_, err := Open(path)
+	if err == nil {
+		t.Fatal("Open did not raise error for deduplicated schema without tiles view")
+	}
+	if !strings.Contains(err.Error(), "must include a 'tiles' view") {
+		t.Error("Open did not raise expected error, instead raised:", err)
+	}
+}
+
+func Test_CreateDeduplicated(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "test.mbtiles")
+	db, err := CreateDeduplicated(path, PNG, map[string]string{"name": "test"})
+	if err != nil {
+		t.Fatal("Could not create:", path, err)
+	}
+	defer db.Close()
+
+	// tiles must be detected as PNG when the file is reopened
+	header := []byte{0x89, 0x50, 0x4e, 0x47, 0x0d, 0x0a, 0x1a, 0x0a, 0, 0, 0, 0x0d, 0x49, 0x48, 0x44, 0x52, 0, 0, 1, 0, 0, 0, 1, 0}
+	tile := func(b byte) []byte {
+		return append(bytes.Clone(header), b)
+	}
+	empty := tile(0)
+	for x := int64(0); x < 4; x++ {
+		if err := db.WriteTile(2, x, 0, empty); err != nil {
+			t.Fatal("Could not write tile:", err)
+		}
+	}
+	if err := db.WriteTile(2, 0, 1, tile(1)); err != nil {
+		t.Fatal("Could not write tile:", err)
+	}
+	// replace a duplicated tile with new data
+	if err := db.WriteTile(2, 1, 0, tile(2)); err != nil {
+		t.Fatal("Could not write tile:", err)
+	}
+
+	var data []byte
+	if err := db.ReadTile(2, 3, 0, &data); err != nil {
+		t.Fatal("Could not read tile:", err)
+	}
+	if !bytes.Equal(data, empty) {
+		t.Error("Read tile", data, "does not match expected value", empty)
+	}
+	if err := db.ReadTile(2, 1, 0, &data); err != nil {
+		t.Fatal("Could not read tile:", err)
+	}
+	if !bytes.Equal(data, tile(2)) {
+		t.Error("Read tile", data, "does not match expected value", tile(2))
+	}
+
+	count, err := db.CountTiles()
+	if err != nil {
+		t.Fatal("Could not count tiles:", err)
+	}
+	if count != 5 {
+		t.Error("Tile count", count, "does not match expected value: 5")
+	}
+	if n := countImages(t, path); n != 3 {
+		t.Error("Image count", n, "does not match expected value: 3")
+	}
+
+	hash, err := db.TileHash(2, 2, 0)
+	if err != nil {
+		t.Fatal("Could not read tile hash:", err)
+	}
+	if hash != HashTile(empty) {
+		t.Error("Tile hash", hash, "does not match expected value", HashTile(empty))
+	}
+
+	// images no longer used are removed by Optimize
+	if err := db.DeleteTile(2, 0, 1); err != nil {
+		t.Fatal("Could not delete tile:", err)
+	}
+	if err := db.Optimize(); err != nil {
+		t.Fatal("Could not optimize:", err)
+	}
+	if n := countImages(t, path); n != 2 {
+		t.Error("Image count after Optimize", n, "does not match expected value: 2")
+	}
+
+	mismatched, err := db.VerifyTileHashes()
+	if err != nil {
+		t.Fatal("Could not verify tile hashes:", err)
+	}
+	if len(mismatched) != 0 {
+		t.Error("VerifyTileHashes returned unexpected tile ids:", mismatched)
+	}
+
+	// file can be reopened and written
+	db.Close()
+	db, err = OpenReadWrite(path)
+	if err != nil {
+		t.Fatal("Could not open:", path, err)
+	}
+	defer db.Close()
+	if err := db.WriteTile(2, 3, 3, empty); err != nil {
+		t.Error("Could not write tile:", err)
+	}
+	if n := countImages(t, path); n != 2 {
+		t.Error("Image count after reopening", n, "does not match expected value: 2")
+	}
+}
+
+func Test_TileHash_notDedup(t *testing.T) {
+	db, err := Open("./testdata/world_cities.mbtiles")
+	if err != nil {
+		t.Fatal("Could not open mbtiles:", err)
+	}
+	defer db.Close()
+
+	if _, err := db.TileHash(0, 0, 0); err == nil {
+		t.Error("TileHash did not raise error for file without deduplicated schema")
+	}
+	if _, err := db.VerifyTileHashes(); err == nil {
+		t.Error("VerifyTileHashes did not raise error for file without deduplicated schema")
+	}
+}
+
+func Test_VerifyTileHashes(t *testing.T) {
+	db, err := Open("./testdata/geography-class-png.mbtiles")
+	if err != nil {
+		t.Fatal("Could not open mbtiles:", err)
+	}
+	defer db.Close()
+
+	// tile_ids of files created by TileMill are also MD5 hashes
+	mismatched, err := db.VerifyTileHashes()
+	if err != nil {
+		t.Fatal("Could not verify tile hashes:", err)
+	}
+	if len(mismatched) != 0 {
+		t.Error("VerifyTileHashes returned unexpected tile ids:", mismatched)
+	}
+
+	path := createTestMBtiles(t, `
+		CREATE TABLE map (zoom_level integer, tile_column integer, tile_row integer, tile_id text);
+		CREATE TABLE images (tile_data blob, tile_id text);
+		CREATE VIEW tiles AS SELECT map.zoom_level AS zoom_level, map.tile_column AS tile_column, map.tile_row AS tile_row, images.tile_data AS tile_data
+			FROM map JOIN images ON images.tile_id = map.tile_id;
+		INSERT INTO images VALUES (x'89504e470d0a1a0a0000000d4948445200000100', 'a');
+		INSERT INTO map VALUES (0, 0, 0, 'a');
+	`)
+	db, err = Open(path)
+	if err != nil {
+		t.Fatal("Could not open:", path, err)
+	}
+	defer db.Close()
+
+	mismatched, err = db.VerifyTileHashes()
+	if err != nil {
+		t.Fatal("Could not verify tile hashes:", err)
+	}
+	if len(mismatched) != 1 || mismatched[0] != "a" {
+		t.Error("VerifyTileHashes returned", mismatched, "instead of expected value: [a]")
+	}
+}
+
+// countImages returns the number of rows in the 'images' table of the mbtiles
+// file at path.
+func countImages(t *testing.T, path string) int64 {
+	t.Helper()
+
+	con, err := sqlite.OpenConn(path, sqlite.SQLITE_OPEN_READONLY)
+	if err != nil {
+		t.Fatal("Could not open:", path, err)
+	}
+	defer con.Close()
+
+	var count int64
+	err = sqlitex.Exec(con, "select count(*) from images", func(stmt *sqlite.Stmt) error {
+		count = stmt.ColumnInt64(0)
+		return nil
+	})
+	if err != nil {
+		t.Fatal("Could not count images:", err)
+	}
+	return count
+}
@@ -0,0 +1,26 @@
+package mbtiles
+
+import "errors"
+
+var (
+	// ErrTileNotFound is returned when reading a tile that does not exist in
+	// the database, if the TileNotFoundError option is set, and by
+	// WriteTileTo.
+	ErrTileNotFound = errors.New("tile not found")
+
+	// ErrDatabaseClosed is returned when using an MBtiles handle that has been
+	// closed.
+	ErrDatabaseClosed = errors.New("mbtiles database is closed")
+
+	// ErrInvalidTileset is returned when opening a file that does not have the
+	// structure or contents required by the mbtiles specification.
+	ErrInvalidTileset = errors.New("invalid mbtiles tileset")
+
+	// ErrJournalPresent is returned when opening an mbtiles file that has an
+	// associated -journal file, unless the IgnoreJournal option is set.
+	ErrJournalPresent = errors.New("refusing to open mbtiles file with associated -journal file (incomplete tileset)")
+
+	// ErrWALPresent is returned when opening an mbtiles file that has an
+	// associated -wal file, unless the WALReadOnly option is set.
+	ErrWALPresent = errors.New("refusing to open mbtiles file with associated -wal file (tileset is being written); use WALReadOnly option to open")
+)
@@ -0,0 +1,40 @@
+package mbtiles
+
+import (
+	"errors"
+	"testing"
+)
+
+func Test_SentinelErrors(t *testing.T) {
+	tests := []struct {
+		path string
+		err  error
+	}{
+		{path: "invalid.mbtiles", err: ErrInvalidTileset},
+		{path: "invalid-tile-format.mbtiles", err: ErrInvalidTileset},
+		{path: "incomplete.mbtiles", err: ErrJournalPresent},
+	}
+	for _, tc := range tests {
+		_, err := Open("./testdata/" + tc.path)
+		if !errors.Is(err, tc.err) {
+			t.Error("Open did not return", tc.err, "for:", tc.path, "got:", err)
+		}
+	}
+
+	db, err := Open("./testdata/geography-class-png.mbtiles")
+	if err != nil {
+		t.Fatal("Could not open mbtiles:", err)
+	}
+	db.Close()
+
+	var data []byte
+	if err := db.ReadTile(0, 0, 0, &data); !errors.Is(err, ErrDatabaseClosed) {
+		t.Error("ReadTile did not return ErrDatabaseClosed for closed database, got:", err)
+	}
+	if _, err := db.ReadMetadata(); !errors.Is(err, ErrDatabaseClosed) {
+		t.Error("ReadMetadata did not return ErrDatabaseClosed for closed database, got:", err)
+	}
+	if err := db.Reload(); !errors.Is(err, ErrDatabaseClosed) {
+		t.Error("Reload did not return ErrDatabaseClosed for closed database, got:", err)
+	}
+}
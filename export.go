@@ -0,0 +1,99 @@
+package mbtiles
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strconv"
+
+	"crawshaw.io/sqlite"
+	"crawshaw.io/sqlite/sqlitex"
+)
+
+// ndjsonTile is a single tile record written by ExportNDJSON.  Data is encoded
+// as base64.
+type ndjsonTile struct {
+	Z    int64  `json:"z"`
+	X    int64  `json:"x"`
+	Y    int64  `json:"y"`
+	Data []byte `json:"data"`
+}
+
+// ExportNDJSON writes every tile to w as newline-delimited JSON, one object per
+// tile of the form {"z":0,"x":0,"y":0,"data":"<base64>"}.  y is in the TMS
+// scheme used by mbtiles.  If decompress is true, GZIP and ZLIB encoded tiles
+// are decompressed before they are written.  Tiles are streamed from the
+// database rather than loaded into memory at once.
+func (db *MBtiles) ExportNDJSON(w io.Writer, decompress bool) error {
+	if db == nil {
+		return fmt.Errorf("cannot read tile: %w", ErrDatabaseClosed)
+	}
+
+	con, err := db.getConnection(context.TODO())
+	defer db.closeConnection(con)
+	if err != nil {
+		return err
+	}
+
+	enc := json.NewEncoder(w)
+	return sqlitex.Exec(con, "select zoom_level, tile_column, tile_row, tile_data from tiles order by zoom_level, tile_column, tile_row", func(stmt *sqlite.Stmt) error {
+		var tileData = make([]byte, stmt.ColumnLen(3))
+		stmt.ColumnBytes(3, tileData)
+
+		if decompress {
+			var err error
+			tileData, err = decompressTile(tileData)
+			if err != nil {
+				return err
+			}
+		}
+
+		return enc.Encode(ndjsonTile{
+			Z:    stmt.ColumnInt64(0),
+			X:    stmt.ColumnInt64(1),
+			Y:    stmt.ColumnInt64(2),
+			Data: tileData,
+		})
+	})
+}
+
+// ExportToDirectory writes every tile to dir as a {z}/{x}/{y}.{ext} directory
+// tree, where ext is derived from the tile format.  If flipY is true, y is
+// flipped from the TMS scheme used by mbtiles to the XYZ scheme used by most
+// web maps.  Tile data are written as stored; PBF tiles remain GZIP encoded.
+// Existing files in dir are overwritten.
+func (db *MBtiles) ExportToDirectory(dir string, flipY bool) error {
+	if db == nil {
+		return fmt.Errorf("cannot read tile: %w", ErrDatabaseClosed)
+	}
+
+	ext := db.GetTileFormat().String()
+	if ext == "" {
+		return fmt.Errorf("unsupported tile format for export: %q", db.GetTileFormat())
+	}
+
+	con, err := db.getConnection(context.TODO())
+	defer db.closeConnection(con)
+	if err != nil {
+		return err
+	}
+
+	return sqlitex.Exec(con, "select zoom_level, tile_column, tile_row, tile_data from tiles", func(stmt *sqlite.Stmt) error {
+		z, x, y := stmt.ColumnInt64(0), stmt.ColumnInt64(1), stmt.ColumnInt64(2)
+		if flipY {
+			z, x, y = TMSToXYZ(z, x, y)
+		}
+
+		var tileData = make([]byte, stmt.ColumnLen(3))
+		stmt.ColumnBytes(3, tileData)
+
+		tileDir := filepath.Join(dir, strconv.FormatInt(z, 10), strconv.FormatInt(x, 10))
+		if err := os.MkdirAll(tileDir, 0755); err != nil {
+			return err
+		}
+		return os.WriteFile(filepath.Join(tileDir, strconv.FormatInt(y, 10)+"."+ext), tileData, 0644)
+	})
+}
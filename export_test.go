@@ -0,0 +1,95 @@
+package mbtiles
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func Test_ExportNDJSON(t *testing.T) {
+	tests := []struct {
+		decompress bool
+		format     TileFormat
+	}{
+		{decompress: false, format: GZIP},
+		{decompress: true, format: UNKNOWN},
+	}
+
+	db, err := Open("./testdata/world_cities.mbtiles")
+	if err != nil {
+		t.Fatal("Could not open mbtiles:", err)
+	}
+	defer db.Close()
+
+	for _, tc := range tests {
+		var buf bytes.Buffer
+		err = db.ExportNDJSON(&buf, tc.decompress)
+		if err != nil {
+			t.Fatal("Unexpected error exporting tiles:", err)
+		}
+
+		count := 0
+		scanner := bufio.NewScanner(&buf)
+		scanner.Buffer(nil, 10*1024*1024)
+		for scanner.Scan() {
+			var tile ndjsonTile
+			if err := json.Unmarshal(scanner.Bytes(), &tile); err != nil {
+				t.Fatal("Could not parse exported tile:", err)
+			}
+			if count == 0 {
+				if tile.Z != 0 || tile.X != 0 || tile.Y != 0 {
+					t.Error("First exported tile is not 0/0/0, got:", tile.Z, tile.X, tile.Y)
+				}
+				if format, _ := detectTileFormat(tile.Data); format != tc.format {
+					t.Error("Exported tile format", format, "does not match expected value", tc.format)
+				}
+			}
+			count++
+		}
+		if count == 0 {
+			t.Error("ExportNDJSON did not export any tiles")
+		}
+	}
+}
+
+func Test_ExportToDirectory(t *testing.T) {
+	tests := []struct {
+		path  string
+		flipY bool
+		tile  [3]int64 // TMS z, x, y of tile to compare
+		file  string
+	}{
+		{path: "geography-class-png.mbtiles", flipY: false, tile: [3]int64{1, 0, 1}, file: "1/0/1.png"},
+		{path: "geography-class-png.mbtiles", flipY: true, tile: [3]int64{1, 0, 1}, file: "1/0/0.png"},
+		{path: "world_cities.mbtiles", flipY: false, tile: [3]int64{0, 0, 0}, file: "0/0/0.pbf"},
+	}
+
+	for _, tc := range tests {
+		db, err := Open("./testdata/" + tc.path)
+		if err != nil {
+			t.Fatal("Could not open:", tc.path, err)
+		}
+		defer db.Close()
+
+		dir := t.TempDir()
+		err = db.ExportToDirectory(dir, tc.flipY)
+		if err != nil {
+			t.Fatal("Unexpected error exporting tiles for:", tc.path, err)
+		}
+
+		var expected []byte
+		db.ReadTile(tc.tile[0], tc.tile[1], tc.tile[2], &expected)
+
+		data, err := os.ReadFile(filepath.Join(dir, tc.file))
+		if err != nil {
+			t.Error("Could not read exported tile:", tc.file, err)
+			continue
+		}
+		if !bytes.Equal(data, expected) {
+			t.Error("Exported tile", tc.file, "does not match tile data for:", tc.path)
+		}
+	}
+}
@@ -0,0 +1,170 @@
+package mbtiles
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"strings"
+
+	"crawshaw.io/sqlite"
+	"crawshaw.io/sqlite/sqlitex"
+)
+
+// finalizeCopy is a query used by FinalizeTo to copy rows in sorted order into
+// table, if it is present in the source database.
+type finalizeCopy struct {
+	table  string
+	query  string
+	insert string
+	grid   bool // table is created by createGridSchema or createDedupGridSchema
+}
+
+// FinalizeTo writes a copy of the mbtiles file to path with a deterministic
+// layout, so that the same tiles and metadata always produce a byte-identical
+// file when written by the same version of this package, e.g., for
+// reproducible builds or content-addressed storage.  Metadata items are
+// written in order of name, and tiles in order of zoom level, column, and row,
+// regardless of the order in which they were written to this file; the copy is
+// then vacuumed.  Files using the deduplicated schema are copied using the
+// deduplicated schema, with tile data in order of tile_id.  UTFGrids are also
+// copied.  path must not already exist, and is removed on error.
+func (db *MBtiles) FinalizeTo(path string) (err error) {
+	if db == nil {
+		return fmt.Errorf("cannot read: %w", ErrDatabaseClosed)
+	}
+
+	con, err := db.getConnection(context.TODO())
+	defer db.closeConnection(con)
+	if err != nil {
+		return err
+	}
+
+	dedup := db.isDedup()
+	dstCon, err := createTileset(path, dedup)
+	if err != nil {
+		return err
+	}
+	defer func() {
+		dstCon.Close()
+		if err != nil {
+			os.Remove(path)
+		}
+	}()
+
+	if err = copyFinalized(con, dstCon, dedup); err != nil {
+		return err
+	}
+	return sqlitex.ExecTransient(dstCon, "VACUUM", nil)
+}
+
+// copyFinalized copies metadata, tiles, and grids in sorted order from con to
+// dstCon within a single transaction.
+func copyFinalized(con *sqlite.Conn, dstCon *sqlite.Conn, dedup bool) (err error) {
+	defer sqlitex.Save(dstCon)(&err)
+
+	err = sqlitex.Exec(con, "select name, value from metadata order by name, value", func(stmt *sqlite.Stmt) error {
+		return writeMetadataValue(dstCon, stmt.ColumnText(0), stmt.ColumnText(1))
+	})
+	if err != nil {
+		return err
+	}
+
+	copies := []finalizeCopy{
+		{"tiles", "select zoom_level, tile_column, tile_row, tile_data from tiles order by zoom_level, tile_column, tile_row", "insert into tiles (zoom_level, tile_column, tile_row, tile_data) values (?, ?, ?, ?)", false},
+		{"grids", "select zoom_level, tile_column, tile_row, grid from grids order by zoom_level, tile_column, tile_row", "insert into grids (zoom_level, tile_column, tile_row, grid) values (?, ?, ?, ?)", true},
+		{"grid_data", "select zoom_level, tile_column, tile_row, key_name, key_json from grid_data order by zoom_level, tile_column, tile_row, key_name", "insert into grid_data (zoom_level, tile_column, tile_row, key_name, key_json) values (?, ?, ?, ?, ?)", true},
+	}
+	createGrids := createGridSchema
+	if dedup {
+		mapQuery := "select zoom_level, tile_column, tile_row, tile_id, grid_id from map order by zoom_level, tile_column, tile_row"
+		hasGridID, err := hasColumn(con, "map", "grid_id")
+		if err != nil {
+			return err
+		}
+		if !hasGridID {
+			mapQuery = strings.Replace(mapQuery, "grid_id", "null", 1)
+		}
+		copies = []finalizeCopy{
+			{"map", mapQuery, "insert into map (zoom_level, tile_column, tile_row, tile_id, grid_id) values (?, ?, ?, ?, ?)", false},
+			{"images", "select tile_id, tile_data from images order by tile_id", "insert into images (tile_id, tile_data) values (?, ?)", false},
+			{"grid_utfgrid", "select grid_id, grid_utfgrid from grid_utfgrid order by grid_id", "insert into grid_utfgrid (grid_id, grid_utfgrid) values (?, ?)", true},
+			{"grid_key", "select grid_id, key_name from grid_key order by grid_id, key_name", "insert into grid_key (grid_id, key_name) values (?, ?)", true},
+			{"keymap", "select key_name, key_json from keymap order by key_name", "insert into keymap (key_name, key_json) values (?, ?)", true},
+		}
+		createGrids = createDedupGridSchema
+	}
+
+	gridsCreated := false
+	for _, c := range copies {
+		present, err := hasTable(con, c.table)
+		if err != nil {
+			return err
+		}
+		if !present {
+			continue
+		}
+		if c.grid && !gridsCreated {
+			if err = createGrids(dstCon); err != nil {
+				return err
+			}
+			gridsCreated = true
+		}
+		if err = copyRows(con, dstCon, c.query, c.insert); err != nil {
+			return fmt.Errorf("cannot copy %s: %w", c.table, err)
+		}
+	}
+	return nil
+}
+
+// copyRows inserts each row returned by query on con into dstCon using
+// insert, which must have a parameter for each column of the row.
+func copyRows(con *sqlite.Conn, dstCon *sqlite.Conn, query string, insert string) error {
+	return sqlitex.Exec(con, query, func(stmt *sqlite.Stmt) error {
+		dstStmt, err := dstCon.Prepare(insert)
+		if err != nil {
+			return err
+		}
+		defer dstStmt.Reset()
+
+		for i := 0; i < stmt.ColumnCount(); i++ {
+			param := i + 1
+			switch stmt.ColumnType(i) {
+			case sqlite.SQLITE_INTEGER:
+				dstStmt.BindInt64(param, stmt.ColumnInt64(i))
+			case sqlite.SQLITE_FLOAT:
+				dstStmt.BindFloat(param, stmt.ColumnFloat(i))
+			case sqlite.SQLITE_TEXT:
+				dstStmt.BindText(param, stmt.ColumnText(i))
+			case sqlite.SQLITE_BLOB:
+				data := make([]byte, stmt.ColumnLen(i))
+				stmt.ColumnBytes(i, data)
+				dstStmt.BindBytes(param, data)
+			default:
+				dstStmt.BindNull(param)
+			}
+		}
+		_, err = dstStmt.Step()
+		return err
+	})
+}
+
+// hasTable returns true if a table or view named name is present in the
+// database.
+func hasTable(con *sqlite.Conn, name string) (bool, error) {
+	present := false
+	err := sqlitex.Exec(con, "select 1 from sqlite_master where type in ('table', 'view') and name = ?", func(stmt *sqlite.Stmt) error {
+		present = true
+		return nil
+	}, name)
+	return present, err
+}
+
+// hasColumn returns true if table has a column named name.
+func hasColumn(con *sqlite.Conn, table string, name string) (bool, error) {
+	present := false
+	err := sqlitex.Exec(con, "select 1 from pragma_table_info(?) where name = ?", func(stmt *sqlite.Stmt) error {
+		present = true
+		return nil
+	}, table, name)
+	return present, err
+}
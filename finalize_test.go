@@ -0,0 +1,118 @@
+package mbtiles
+
+import (
+	"bytes"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func Test_FinalizeTo(t *testing.T) {
+	for _, dedup := range []bool{false, true} {
+		dir := t.TempDir()
+		var finalized [][]byte
+		for i, order := range [][]int64{{0, 1, 2, 3}, {3, 1, 0, 2}} {
+			path := filepath.Join(dir, "test.mbtiles")
+			if i > 0 {
+				path = filepath.Join(dir, "reordered.mbtiles")
+			}
+			var db *MBtiles
+			var err error
+			if dedup {
+				db, err = CreateDeduplicated(path, PNG, nil)
+			} else {
+				db, err = Create(path, PNG)
+			}
+			if err != nil {
+				t.Fatal("Could not create:", path, err)
+			}
+			defer db.Close()
+
+			// metadata and tiles are written in a different order, with a tile
+			// that is later deleted
+			names := []string{"name", "description", "attribution", "version"}
+			for _, j := range order {
+				if err := db.WriteMetadata(names[j], "test"); err != nil {
+					t.Fatal("Could not write metadata:", err)
+				}
+				if err := db.WriteTile(2, j, 0, []byte{byte(j % 2)}); err != nil {
+					t.Fatal("Could not write tile:", err)
+				}
+				if err := db.WriteGrid(2, j, 0, []byte(`{"grid":[]}`), map[string]json.RawMessage{"1": json.RawMessage(`{}`)}); err != nil {
+					t.Fatal("Could not write grid:", err)
+				}
+				if j == order[0] {
+					if err := db.WriteTile(3, 0, 0, []byte{9}); err != nil {
+						t.Fatal("Could not write tile:", err)
+					}
+				}
+			}
+			if err := db.DeleteTile(3, 0, 0); err != nil {
+				t.Fatal("Could not delete tile:", err)
+			}
+
+			out := filepath.Join(dir, "finalized"+filepath.Base(path))
+			if err := db.FinalizeTo(out); err != nil {
+				t.Fatal("Could not finalize:", err)
+			}
+			if err := db.FinalizeTo(out); err == nil {
+				t.Error("FinalizeTo did not raise error for existing file")
+			}
+			data, err := os.ReadFile(out)
+			if err != nil {
+				t.Fatal("Could not read:", out, err)
+			}
+			finalized = append(finalized, data)
+		}
+
+		if !bytes.Equal(finalized[0], finalized[1]) {
+			t.Error("Finalized files are not identical, dedup:", dedup)
+		}
+	}
+}
+
+func Test_FinalizeTo_contents(t *testing.T) {
+	db, err := Open("./testdata/geography-class-png.mbtiles")
+	if err != nil {
+		t.Fatal("Could not open mbtiles:", err)
+	}
+	defer db.Close()
+
+	path := filepath.Join(t.TempDir(), "finalized.mbtiles")
+	if err := db.FinalizeTo(path); err != nil {
+		t.Fatal("Could not finalize:", err)
+	}
+
+	out, err := Open(path)
+	if err != nil {
+		t.Fatal("Could not open finalized file:", err)
+	}
+	defer out.Close()
+
+	expected, _ := db.CountTiles()
+	count, err := out.CountTiles()
+	if err != nil || count != expected {
+		t.Error("Finalized tile count", count, err, "does not match expected value", expected)
+	}
+	var tile, expectedTile []byte
+	if err := db.ReadTile(1, 1, 0, &expectedTile); err != nil {
+		t.Fatal("Could not read tile:", err)
+	}
+	if err := out.ReadTile(1, 1, 0, &tile); err != nil {
+		t.Fatal("Could not read finalized tile:", err)
+	}
+	if !bytes.Equal(tile, expectedTile) {
+		t.Error("Finalized tile does not match source tile")
+	}
+	if version, err := out.GetSpecVersion(); err != nil || version != "1.2" {
+		t.Error("Finalized spec version", version, err, "does not match expected value: 1.2")
+	}
+	metadata, err := out.ReadMetadata()
+	if err != nil {
+		t.Fatal("Could not read finalized metadata:", err)
+	}
+	if metadata["name"] != "Geography Class" {
+		t.Error("Finalized metadata name does not match expected value, got:", metadata["name"])
+	}
+}
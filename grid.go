@@ -0,0 +1,140 @@
+package mbtiles
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+
+	"crawshaw.io/sqlite"
+	"crawshaw.io/sqlite/sqlitex"
+)
+
+// createGridSchema creates the 'grids' and 'grid_data' tables for UTFGrid
+// interactivity according to the mbtiles specification, if they do not exist.
+func createGridSchema(con *sqlite.Conn) error {
+	return sqlitex.ExecScript(con, `
+		CREATE TABLE IF NOT EXISTS grids (zoom_level integer, tile_column integer, tile_row integer, grid blob);
+		CREATE UNIQUE INDEX IF NOT EXISTS grid_index ON grids (zoom_level, tile_column, tile_row);
+		CREATE TABLE IF NOT EXISTS grid_data (zoom_level integer, tile_column integer, tile_row integer, key_name text, key_json text);
+		CREATE UNIQUE INDEX IF NOT EXISTS grid_data_index ON grid_data (zoom_level, tile_column, tile_row, key_name);
+	`)
+}
+
+// createDedupGridSchema creates the tables used to store UTFGrids in the
+// deduplicated schema, where grids are stored once in 'grid_utfgrid' and
+// referenced by grid_id from the 'map' table, and 'grids' and 'grid_data' are
+// views, if they do not exist.
+func createDedupGridSchema(con *sqlite.Conn) error {
+	return sqlitex.ExecScript(con, `
+		CREATE TABLE IF NOT EXISTS grid_utfgrid (grid_id text, grid_utfgrid blob);
+		CREATE UNIQUE INDEX IF NOT EXISTS grid_utfgrid_lookup ON grid_utfgrid (grid_id);
+		CREATE TABLE IF NOT EXISTS grid_key (grid_id text, key_name text);
+		CREATE UNIQUE INDEX IF NOT EXISTS grid_key_lookup ON grid_key (grid_id, key_name);
+		CREATE TABLE IF NOT EXISTS keymap (key_name text, key_json text);
+		CREATE UNIQUE INDEX IF NOT EXISTS keymap_lookup ON keymap (key_name);
+		CREATE VIEW IF NOT EXISTS grids AS
+			SELECT map.zoom_level AS zoom_level, map.tile_column AS tile_column, map.tile_row AS tile_row, grid_utfgrid.grid_utfgrid AS grid
+			FROM map JOIN grid_utfgrid ON grid_utfgrid.grid_id = map.grid_id;
+		CREATE VIEW IF NOT EXISTS grid_data AS
+			SELECT map.zoom_level AS zoom_level, map.tile_column AS tile_column, map.tile_row AS tile_row, keymap.key_name AS key_name, keymap.key_json AS key_json
+			FROM map JOIN grid_key ON map.grid_id = grid_key.grid_id JOIN keymap ON grid_key.key_name = keymap.key_name;
+	`)
+}
+
+// WriteGrid inserts or replaces the UTFGrid for z, x, y, along with the data
+// for each of its keys, for interactivity as described by the 'template'
+// metadata item.  grid is the UTFGrid JSON object, which is compressed using
+// zlib unless it is already compressed using zlib or gzip.  keys are the JSON
+// data for each key of the grid.  y must be in the TMS scheme used by mbtiles.
+// The tables used to store grids are created if needed.  In deduplicated
+// files, the data for each key are shared by all grids that use the key.  db
+// must have been opened for writing, using Create or the SQLITE_OPEN_READWRITE
+// flag.
+func (db *MBtiles) WriteGrid(z int64, x int64, y int64, grid []byte, keys map[string]json.RawMessage) (err error) {
+	if db == nil {
+		return fmt.Errorf("cannot write grid: %w", ErrDatabaseClosed)
+	}
+	for key, value := range keys {
+		if !json.Valid(value) {
+			return fmt.Errorf("invalid JSON for grid key %q", key)
+		}
+	}
+	if format, _ := detectTileFormat(grid); format != ZLIB && format != GZIP {
+		if !json.Valid(grid) {
+			return errors.New("grid must be a UTFGrid JSON object, or compressed using zlib or gzip")
+		}
+		if grid, err = compressZlib(grid); err != nil {
+			return err
+		}
+	}
+
+	con, err := db.getConnection(context.TODO())
+	defer db.closeConnection(con)
+	if err != nil {
+		return err
+	}
+
+	if db.opts.Flags&sqlite.SQLITE_OPEN_READWRITE == 0 {
+		return errors.New("cannot write grid to mbtiles database opened read-only")
+	}
+
+	defer sqlitex.Save(con)(&err)
+	if db.isDedup() {
+		return writeDedupGrid(con, z, x, y, grid, keys)
+	}
+	return writeGrid(con, z, x, y, grid, keys)
+}
+
+// writeGrid inserts or replaces the compressed UTFGrid and key data for z, x, y
+// using con.
+func writeGrid(con *sqlite.Conn, z int64, x int64, y int64, grid []byte, keys map[string]json.RawMessage) error {
+	if err := createGridSchema(con); err != nil {
+		return err
+	}
+
+	err := sqlitex.Exec(con, "insert or replace into grids (zoom_level, tile_column, tile_row, grid) values (?, ?, ?, ?)", nil, z, x, y, grid)
+	if err != nil {
+		return err
+	}
+	err = sqlitex.Exec(con, "delete from grid_data where zoom_level = ? and tile_column = ? and tile_row = ?", nil, z, x, y)
+	if err != nil {
+		return err
+	}
+	for key, value := range keys {
+		err = sqlitex.Exec(con, "insert into grid_data (zoom_level, tile_column, tile_row, key_name, key_json) values (?, ?, ?, ?, ?)", nil, z, x, y, key, string(value))
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// writeDedupGrid inserts or replaces the compressed UTFGrid and key data for
+// z, x, y in a deduplicated mbtiles file using con.  Grids are identified by
+// the MD5 hash of their compressed data, as for tiles.
+func writeDedupGrid(con *sqlite.Conn, z int64, x int64, y int64, grid []byte, keys map[string]json.RawMessage) error {
+	if err := createDedupGridSchema(con); err != nil {
+		return err
+	}
+
+	hash := HashTile(grid)
+	err := sqlitex.Exec(con, "insert or ignore into grid_utfgrid (grid_id, grid_utfgrid) values (?, ?)", nil, hash, grid)
+	if err != nil {
+		return err
+	}
+	for key, value := range keys {
+		err = sqlitex.Exec(con, "insert or ignore into grid_key (grid_id, key_name) values (?, ?)", nil, hash, key)
+		if err != nil {
+			return err
+		}
+		err = sqlitex.Exec(con, "insert or replace into keymap (key_name, key_json) values (?, ?)", nil, key, string(value))
+		if err != nil {
+			return err
+		}
+	}
+
+	// tile_id is preserved for tiles that are replaced
+	return sqlitex.Exec(con, `insert into map (zoom_level, tile_column, tile_row, grid_id) values (?, ?, ?, ?)
+		on conflict (zoom_level, tile_column, tile_row) do update set grid_id = excluded.grid_id`, nil, z, x, y, hash)
+}
@@ -0,0 +1,111 @@
+package mbtiles
+
+import (
+	"encoding/json"
+	"path/filepath"
+	"testing"
+
+	"crawshaw.io/sqlite"
+	"crawshaw.io/sqlite/sqlitex"
+)
+
+func Test_WriteGrid(t *testing.T) {
+	grid := []byte(`{"grid":["  ","!!"],"keys":["","1"],"data":{}}`)
+	keys := map[string]json.RawMessage{"1": json.RawMessage(`{"name":"test"}`)}
+
+	for _, dedup := range []bool{false, true} {
+		path := filepath.Join(t.TempDir(), "test.mbtiles")
+		var db *MBtiles
+		var err error
+		if dedup {
+			db, err = CreateDeduplicated(path, PNG, nil)
+		} else {
+			db, err = Create(path, PNG)
+		}
+		if err != nil {
+			t.Fatal("Could not create:", path, err)
+		}
+		defer db.Close()
+
+		if err := db.WriteTile(1, 0, 1, []byte{1}); err != nil {
+			t.Fatal("Could not write tile:", err)
+		}
+		if err := db.WriteGrid(1, 0, 1, []byte(`{"grid":[]}`), map[string]json.RawMessage{"old": json.RawMessage(`1`)}); err != nil {
+			t.Fatal("Could not write grid:", err)
+		}
+		// replace grid and keys
+		if err := db.WriteGrid(1, 0, 1, grid, keys); err != nil {
+			t.Fatal("Could not write grid:", err)
+		}
+
+		if version, err := db.GetSpecVersion(); err != nil || version != "1.2" {
+			t.Error("Spec version", version, err, "does not match expected value: 1.2")
+		}
+
+		con, err := sqlite.OpenConn(path, sqlite.SQLITE_OPEN_READONLY)
+		if err != nil {
+			t.Fatal("Could not open:", path, err)
+		}
+		defer con.Close()
+
+		var data []byte
+		err = sqlitex.Exec(con, "select grid from grids where zoom_level = 1 and tile_column = 0 and tile_row = 1", func(stmt *sqlite.Stmt) error {
+			data = make([]byte, stmt.ColumnLen(0))
+			stmt.ColumnBytes(0, data)
+			return nil
+		})
+		if err != nil {
+			t.Fatal("Could not read grid:", err)
+		}
+		data, err = decompressTile(data)
+		if err != nil {
+			t.Fatal("Could not decompress grid:", err)
+		}
+		if string(data) != string(grid) {
+			t.Error("Grid", string(data), "does not match expected value", string(grid))
+		}
+
+		gridData := make(map[string]string)
+		err = sqlitex.Exec(con, "select key_name, key_json from grid_data where zoom_level = 1 and tile_column = 0 and tile_row = 1", func(stmt *sqlite.Stmt) error {
+			gridData[stmt.ColumnText(0)] = stmt.ColumnText(1)
+			return nil
+		})
+		if err != nil {
+			t.Fatal("Could not read grid data:", err)
+		}
+		if len(gridData) != 1 || gridData["1"] != `{"name":"test"}` {
+			t.Error("Grid data", gridData, "does not match expected value")
+		}
+
+		// tile is not changed by writing grid
+		var tile []byte
+		if err := db.ReadTile(1, 0, 1, &tile); err != nil || len(tile) != 1 {
+			t.Error("Tile", tile, err, "was changed by writing grid")
+		}
+	}
+}
+
+func Test_WriteGrid_invalid(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "test.mbtiles")
+	db, err := Create(path, PNG)
+	if err != nil {
+		t.Fatal("Could not create:", path, err)
+	}
+	defer db.Close()
+
+	if err := db.WriteGrid(0, 0, 0, []byte("not json"), nil); err == nil {
+		t.Error("WriteGrid did not raise error for invalid grid")
+	}
+	if err := db.WriteGrid(0, 0, 0, []byte(`{"grid":[]}`), map[string]json.RawMessage{"1": json.RawMessage("{")}); err == nil {
+		t.Error("WriteGrid did not raise error for invalid key data")
+	}
+
+	ro, err := Open("./testdata/world_cities.mbtiles")
+	if err != nil {
+		t.Fatal("Could not open mbtiles:", err)
+	}
+	defer ro.Close()
+	if err := ro.WriteGrid(0, 0, 0, []byte(`{"grid":[]}`), nil); err == nil {
+		t.Error("WriteGrid did not raise error for read-only database")
+	}
+}
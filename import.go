@@ -0,0 +1,175 @@
+package mbtiles
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+
+	"crawshaw.io/sqlite"
+	"crawshaw.io/sqlite/sqlitex"
+)
+
+// tileExtensions lists the file extensions accepted for each TileFormat when
+// importing tiles from a directory.
+var tileExtensions = map[TileFormat][]string{
+	PNG:  {".png"},
+	JPG:  {".jpg", ".jpeg"},
+	WEBP: {".webp"},
+	AVIF: {".avif"},
+	PBF:  {".pbf", ".mvt"},
+}
+
+// ImportFromDir creates a new mbtiles file at dst from a directory of tiles in
+// srcDir organized as z/x/y.ext.  scheme is either "xyz" or "tms" and
+// determines if the y coordinate of each tile is flipped to the TMS scheme
+// used by mbtiles.  All tile files must have an extension that matches format.
+// If srcDir contains a metadata.json file, its values are written to the
+// metadata table.  dst must not already exist, and is removed on error.
+func ImportFromDir(dst, srcDir, scheme string, format TileFormat) (err error) {
+	if scheme != "xyz" && scheme != "tms" {
+		return fmt.Errorf("scheme must be one of xyz, tms, got: %q", scheme)
+	}
+	extensions, ok := tileExtensions[format]
+	if !ok {
+		return fmt.Errorf("unsupported tile format for import: %q", format)
+	}
+	if info, err := os.Stat(srcDir); err != nil || !info.IsDir() {
+		return fmt.Errorf("source directory does not exist: %q", srcDir)
+	}
+
+	con, err := createTileset(dst, false)
+	if err != nil {
+		return err
+	}
+	defer func() {
+		con.Close()
+		if err != nil {
+			os.Remove(dst)
+		}
+	}()
+
+	// write all tiles within a single transaction
+	defer sqlitex.Save(con)(&err)
+
+	err = filepath.WalkDir(srcDir, func(path string, d fs.DirEntry, err error) error {
+		if err != nil || d.IsDir() {
+			return err
+		}
+
+		rel, err := filepath.Rel(srcDir, path)
+		if err != nil {
+			return err
+		}
+		parts := strings.Split(rel, string(filepath.Separator))
+		if len(parts) != 3 {
+			// not a tile
+			return nil
+		}
+
+		ext := filepath.Ext(parts[2])
+		if !hasExtension(extensions, ext) {
+			return fmt.Errorf("tile %q does not match tile format %q", rel, format)
+		}
+
+		z, errZ := strconv.ParseInt(parts[0], 10, 64)
+		x, errX := strconv.ParseInt(parts[1], 10, 64)
+		y, errY := strconv.ParseInt(strings.TrimSuffix(parts[2], ext), 10, 64)
+		if errZ != nil || errX != nil || errY != nil {
+			return fmt.Errorf("could not parse tile coordinates from %q", rel)
+		}
+		if scheme == "xyz" {
+			z, x, y = XYZToTMS(z, x, y)
+		}
+
+		data, err := os.ReadFile(path)
+		if err != nil {
+			return err
+		}
+		return writeTile(con, z, x, y, data)
+	})
+	if err != nil {
+		return err
+	}
+
+	metadata := map[string]interface{}{}
+	data, err := os.ReadFile(filepath.Join(srcDir, "metadata.json"))
+	if err == nil {
+		if err = json.Unmarshal(data, &metadata); err != nil {
+			return fmt.Errorf("unable to parse metadata.json: %v", err)
+		}
+	} else if !os.IsNotExist(err) {
+		return err
+	}
+	if _, ok := metadata["format"]; !ok {
+		metadata["format"] = format.String()
+	}
+
+	return writeMetadataMap(con, metadata)
+}
+
+// hasExtension returns true if ext is in extensions, ignoring case.
+func hasExtension(extensions []string, ext string) bool {
+	for _, e := range extensions {
+		if strings.EqualFold(e, ext) {
+			return true
+		}
+	}
+	return false
+}
+
+// writeMetadataMap writes metadata decoded from JSON into the metadata table
+// using con.  Numbers and arrays of numbers (e.g., bounds) are written in the
+// format expected by the mbtiles specification; any other non-string values
+// (e.g., vector_layers) are combined into the 'json' metadata item.
+func writeMetadataMap(con *sqlite.Conn, metadata map[string]interface{}) error {
+	extra := make(map[string]interface{})
+	for key, value := range metadata {
+		var str string
+		switch v := value.(type) {
+		case string:
+			str = v
+		case float64:
+			str = strconv.FormatFloat(v, 'f', -1, 64)
+		case []interface{}:
+			floats, ok := floatValues(v)
+			if !ok {
+				extra[key] = value
+				continue
+			}
+			str = formatFloats(floats)
+		default:
+			extra[key] = value
+			continue
+		}
+		if err := writeMetadataValue(con, key, str); err != nil {
+			return err
+		}
+	}
+
+	if len(extra) > 0 {
+		data, err := json.Marshal(extra)
+		if err != nil {
+			return err
+		}
+		return writeMetadataValue(con, "json", string(data))
+	}
+	return nil
+}
+
+// floatValues returns a slice of numbers decoded from JSON as float64s.
+// Returns false if any value is not a number.
+func floatValues(values []interface{}) ([]float64, bool) {
+	out := make([]float64, len(values))
+	for i, value := range values {
+		f, ok := value.(float64)
+		if !ok {
+			return nil, false
+		}
+		out[i] = f
+	}
+	return out, true
+}
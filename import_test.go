@@ -0,0 +1,98 @@
+package mbtiles
+
+import (
+	"encoding/hex"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// writeTestTile writes data to path, creating parent directories as needed.
+func writeTestTile(t *testing.T, path string, data []byte) {
+	t.Helper()
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		t.Fatal("Could not create tile directory:", err)
+	}
+	if err := os.WriteFile(path, data, 0644); err != nil {
+		t.Fatal("Could not write tile:", err)
+	}
+}
+
+func Test_ImportFromDir(t *testing.T) {
+	// first 20 bytes of tile 0/0/0 in geography-class-png.mbtiles
+	png, _ := hex.DecodeString("89504e470d0a1a0a0000000d4948445200000100")
+
+	srcDir := t.TempDir()
+	writeTestTile(t, filepath.Join(srcDir, "0", "0", "0.png"), png)
+	writeTestTile(t, filepath.Join(srcDir, "1", "1", "0.png"), png)
+	writeTestTile(t, filepath.Join(srcDir, "metadata.json"), []byte(`{
+		"name": "imported",
+		"minzoom": 0,
+		"maxzoom": 1,
+		"bounds": [-180, -85.0511, 180, 85.0511],
+		"vector_layers": [{"id": "test"}]
+	}`))
+
+	dst := filepath.Join(t.TempDir(), "imported.mbtiles")
+	err := ImportFromDir(dst, srcDir, "xyz", PNG)
+	if err != nil {
+		t.Fatal("Unexpected error importing tiles:", err)
+	}
+
+	db, err := Open(dst)
+	if err != nil {
+		t.Fatal("Could not open imported mbtiles:", err)
+	}
+	defer db.Close()
+
+	if db.GetTileFormat() != PNG {
+		t.Error("Tile format", db.GetTileFormat(), "does not match expected value", PNG)
+	}
+
+	// xyz 1/1/0 is tms 1/1/1
+	var data []byte
+	if err = db.ReadTile(1, 1, 1, &data); err != nil || len(data) != len(png) {
+		t.Error("Imported tile was not flipped to TMS scheme")
+	}
+
+	metadata, err := db.ReadMetadata()
+	if err != nil {
+		t.Fatal("Error raised when reading metadata:", err)
+	}
+	if metadata["name"] != "imported" || metadata["maxzoom"] != 1 || metadata["format"] != "png" {
+		t.Error("Imported metadata does not match expected values, got:", metadata)
+	}
+	if bounds, ok := metadata["bounds"].([]float64); !ok || len(bounds) != 4 {
+		t.Error("Imported bounds do not match expected values, got:", metadata["bounds"])
+	}
+	if _, ok := metadata["vector_layers"]; !ok {
+		t.Error("Imported metadata missing vector_layers from json")
+	}
+}
+
+func Test_ImportFromDir_invalid(t *testing.T) {
+	png, _ := hex.DecodeString("89504e470d0a1a0a0000000d4948445200000100")
+	srcDir := t.TempDir()
+	writeTestTile(t, filepath.Join(srcDir, "0", "0", "0.png"), png)
+
+	tests := []struct {
+		scheme string
+		format TileFormat
+		err    string
+	}{
+		{scheme: "xyz", format: JPG, err: "does not match tile format"},
+		{scheme: "other", format: PNG, err: "scheme must be one of"},
+	}
+
+	for _, tc := range tests {
+		dst := filepath.Join(t.TempDir(), "imported.mbtiles")
+		err := ImportFromDir(dst, srcDir, tc.scheme, tc.format)
+		if err == nil || !strings.Contains(err.Error(), tc.err) {
+			t.Error("ImportFromDir did not raise expected error:", tc.err, "instead raised:", err)
+		}
+		if _, err := os.Stat(dst); err == nil {
+			t.Error("ImportFromDir did not remove destination on error")
+		}
+	}
+}
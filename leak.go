@@ -0,0 +1,9 @@
+//go:build !mbtilesdebug
+
+package mbtiles
+
+// trackHandle is a no-op unless built with the mbtilesdebug build tag.
+func trackHandle(db *MBtiles) {}
+
+// untrackHandle is a no-op unless built with the mbtilesdebug build tag.
+func untrackHandle(db *MBtiles) {}
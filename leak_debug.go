@@ -0,0 +1,30 @@
+//go:build mbtilesdebug
+
+package mbtiles
+
+import (
+	"log"
+	"runtime"
+)
+
+// leakLogf is used to log handles that were not closed; it can be replaced
+// in tests.
+var leakLogf = log.Printf
+
+// trackHandle sets a finalizer on db that logs a warning if it is garbage
+// collected without Close being called.  The handle is unreachable by the time
+// the finalizer runs, so the pool can be closed without racing against reads;
+// otherwise the sqlite connections in the pool panic when they are collected.
+func trackHandle(db *MBtiles) {
+	runtime.SetFinalizer(db, func(db *MBtiles) {
+		leakLogf("mbtiles: handle for %q was garbage collected without calling Close", db.filename)
+		if db.pool != nil {
+			db.pool.Close()
+		}
+	})
+}
+
+// untrackHandle clears the finalizer set by trackHandle.
+func untrackHandle(db *MBtiles) {
+	runtime.SetFinalizer(db, nil)
+}
@@ -0,0 +1,38 @@
+//go:build mbtilesdebug
+
+package mbtiles
+
+import (
+	"runtime"
+	"testing"
+	"time"
+)
+
+func Test_LeakDetector(t *testing.T) {
+	leaked := make(chan struct{}, 1)
+	defer func(logf func(string, ...interface{})) { leakLogf = logf }(leakLogf)
+	leakLogf = func(format string, args ...interface{}) {
+		// other tests may also leak handles; don't block the finalizer
+		select {
+		case leaked <- struct{}{}:
+		default:
+		}
+	}
+
+	func() {
+		_, err := Open("./testdata/geography-class-png.mbtiles")
+		if err != nil {
+			t.Fatal("Could not open mbtiles:", err)
+		}
+	}()
+
+	for i := 0; i < 10; i++ {
+		runtime.GC()
+		select {
+		case <-leaked:
+			return
+		case <-time.After(50 * time.Millisecond):
+		}
+	}
+	t.Error("Leak detector did not report handle that was not closed")
+}
@@ -5,53 +5,151 @@ import (
 	"encoding/json"
 	"errors"
 	"fmt"
+	"io"
+	"io/fs"
 	"os"
+	"path"
 	"path/filepath"
+	"slices"
+	"sort"
 	"strconv"
 	"strings"
+	"sync"
+	"sync/atomic"
 	"time"
 
 	"crawshaw.io/sqlite"
 	"crawshaw.io/sqlite/sqlitex"
 )
 
+// defaultPoolSize is the number of connections opened for each mbtiles file
+// unless set using the PoolSize option.
+const defaultPoolSize = 10
+
+// defaultFlags are the flags used to open connections in the pool unless set
+// using the Flags option.
+const defaultFlags = sqlite.SQLITE_OPEN_READONLY | sqlite.SQLITE_OPEN_NOMUTEX
+
 // MBtiles provides a basic handle for an mbtiles file.
 type MBtiles struct {
 	filename  string
 	pool      *sqlitex.Pool
 	format    TileFormat
 	timestamp time.Time
+	file      os.FileInfo // file opened, to detect if it is replaced; nil if in memory
 	tilesize  uint32
+	scheme    string // "tms" or "xyz"
+	minZoom   int64
+	maxZoom   int64
+	inMemory  bool // opened using OpenInMemory
+	dedup     bool // tile data are stored in the 'images' table
+	opts      Options
+	// mu guards the pool and cached fields, which are replaced by Rebind.  It
+	// is only held briefly, never while a connection is checked out.
+	mu sync.RWMutex
+	// checkouts records the pool that each checked out connection belongs
+	// to, and refs the number of connections checked out of each pool, so
+	// that a pool replaced by Rebind or Close is closed once its last
+	// connection is returned.  Both are guarded by mu.
+	checkouts map[*sqlite.Conn]*sqlitex.Pool
+	refs      map[*sqlitex.Pool]int
+	// zoomMu guards minZoom and maxZoom, which are updated by the methods
+	// that write tiles or metadata using db.
+	zoomMu sync.Mutex
+	// metadataMu guards metadata and metadataWarnings, which are cached by
+	// ReadMetadata.
+	metadataMu       sync.Mutex
+	metadata         map[string]interface{}
+	metadataWarnings []error
+}
+
+// FindOption sets an option for FindMBtiles and FindMBtilesFS.
+type FindOption func(*findOptions)
+
+type findOptions struct {
+	includeJournaled bool
+}
+
+// WithJournaledFiles includes mbtiles files that have an associated -journal
+// file, which are otherwise skipped because they may be incomplete.
+func WithJournaledFiles() FindOption {
+	return func(o *findOptions) {
+		o.includeJournaled = true
+	}
 }
 
 // FindMBtiles recursively finds all mbtiles files within a given path.
-func FindMBtiles(path string) ([]string, error) {
+// See FindMBtilesFS.
+func FindMBtiles(path string, opts ...FindOption) ([]string, error) {
+	filenames, err := FindMBtilesFS(os.DirFS(path), ".", opts...)
+	for i, filename := range filenames {
+		filenames[i] = filepath.Join(path, filepath.FromSlash(filename))
+	}
+	return filenames, err
+}
+
+// FindMBtilesFS recursively finds all mbtiles files within root in fsys.
+// Files with an associated -journal file are skipped unless the
+// WithJournaledFiles option is set.  Errors reading subdirectories of root
+// (e.g., permission errors) do not stop the search; they are returned together
+// in a single error along with all files that were found.
+func FindMBtilesFS(fsys fs.FS, root string, opts ...FindOption) ([]string, error) {
+	var options findOptions
+	for _, opt := range opts {
+		opt(&options)
+	}
+
 	var filenames []string
-	err := filepath.Walk(path, func(p string, info os.FileInfo, err error) error {
+	var errs []error
+	err := fs.WalkDir(fsys, root, func(p string, d fs.DirEntry, err error) error {
 		if err != nil {
-			return err
+			if p == root {
+				return err
+			}
+			errs = append(errs, err)
+			return nil
 		}
-		// Ignore any that have an associated -journal file; these are incomplete
-		if _, err := os.Stat(p + "-journal"); err == nil {
+		if d.IsDir() || path.Ext(p) != ".mbtiles" {
 			return nil
 		}
-		if ext := filepath.Ext(p); ext == ".mbtiles" {
-			filenames = append(filenames, p)
-
+		// Ignore any that have an associated -journal file; these are incomplete
+		if !options.includeJournaled {
+			if _, err := fs.Stat(fsys, p+"-journal"); err == nil {
+				return nil
+			}
 		}
+		filenames = append(filenames, p)
 		return nil
 	})
 	if err != nil {
 		return nil, err
 	}
-	return filenames, err
+	return filenames, errors.Join(errs...)
 }
 
+// inMemoryCount is used to give each database opened using OpenInMemory a
+// unique name.
+var inMemoryCount atomic.Int64
+
 // OpenInMemory opens an MBtiles file for reading, and validates that it has the correct
 // structure. Then it loads it to in-memory database. Use this function only with files small enough to be
 // loaded in-memory.
 func OpenInMemory(path string) (*MBtiles, error) {
-	modTime, err := getModTime(path)
+	return OpenInMemoryWithProgress(context.Background(), path, -1, nil)
+}
+
+// OpenInMemoryWithProgress opens an MBtiles file into an in-memory database as
+// for OpenInMemory, but copies it pages at a time.  If fn is not nil, it is
+// called after each step with the number of pages remaining to copy and the
+// total number of pages.  Copying is stopped and ctx.Err() is returned if ctx
+// is cancelled between steps.  If pages is less than 1, the file is copied in
+// a single step.
+func OpenInMemoryWithProgress(ctx context.Context, path string, pages int, fn func(remaining, total int)) (*MBtiles, error) {
+	if pages < 1 {
+		pages = -1
+	}
+
+	modTime, err := getModTime(path, false, false)
 	if err != nil {
 		return nil, err
 	}
@@ -69,12 +167,26 @@ func OpenInMemory(path string) (*MBtiles, error) {
 	if err != nil {
 		return nil, err
 	}
+	err = validateTileColumnTypes(srcCon)
+	if err != nil {
+		return nil, err
+	}
 	format, tilesize, err := getTileFormatAndSize(srcCon)
 	if err != nil {
 		return nil, err
 	}
+	scheme, err := getScheme(srcCon)
+	if err != nil {
+		return nil, err
+	}
+	minZoom, maxZoom, err := getZoomRange(srcCon)
+	if err != nil {
+		return nil, err
+	}
 
-	inMemoryPath := "file::memory:?mode=memory"
+	// a named, shared cache in-memory database is shared by all connections
+	// in the pool; it is freed once the last connection is closed
+	inMemoryPath := fmt.Sprintf("file:mbtiles-memory-%d?mode=memory&cache=shared", inMemoryCount.Add(1))
 	dstCon, err := sqlite.OpenConn(inMemoryPath, sqlite.SQLITE_OPEN_CREATE|sqlite.SQLITE_OPEN_READWRITE|sqlite.SQLITE_OPEN_URI)
 	if err != nil {
 		return nil, err
@@ -87,66 +199,438 @@ func OpenInMemory(path string) (*MBtiles, error) {
 	}
 	defer bkp.Finish()
 
-	if err := bkp.Step(-1); err != nil {
-		return nil, fmt.Errorf("transfer whole db: %w", err)
+	for {
+		if err := ctx.Err(); err != nil {
+			return nil, err
+		}
+		if err := bkp.Step(pages); err != nil {
+			return nil, fmt.Errorf("transfer whole db: %w", err)
+		}
+		remaining := bkp.Remaining()
+		if fn != nil {
+			fn(remaining, bkp.PageCount())
+		}
+		if remaining == 0 {
+			break
+		}
 	}
 
-	pool, err := sqlitex.Open(inMemoryPath, sqlite.SQLITE_OPEN_READONLY|sqlite.SQLITE_OPEN_URI|sqlite.SQLITE_OPEN_NOMUTEX, 10)
+	pool, err := sqlitex.Open(inMemoryPath, sqlite.SQLITE_OPEN_READONLY|sqlite.SQLITE_OPEN_URI|sqlite.SQLITE_OPEN_NOMUTEX, defaultPoolSize)
 	if err != nil {
 		return nil, err
 	}
 
-	return &MBtiles{
+	db := &MBtiles{
 		filename:  inMemoryPath,
 		pool:      pool,
 		timestamp: modTime,
 		format:    format,
 		tilesize:  tilesize,
-	}, nil
+		scheme:    scheme,
+		minZoom:   minZoom,
+		maxZoom:   maxZoom,
+		inMemory:  true,
+	}
+	trackHandle(db)
+
+	return db, nil
+}
+
+// Options configures how an MBtiles file is opened.
+type Options struct {
+	// IgnoreJournal allows opening an mbtiles file that has an associated
+	// -journal file.  By default, these are refused because the tileset may
+	// still be in the process of being created; only set this if the journal
+	// is known to be a stale leftover.
+	IgnoreJournal bool
+
+	// AutoDecompress decompresses GZIP and ZLIB encoded tiles (e.g., PBF) when
+	// they are read, so that ReadTile returns the raw tile bytes.  Image tiles
+	// are not modified.  When serving decompressed PBF tiles, the
+	// Content-Encoding header must not be set to gzip.
+	AutoDecompress bool
+
+	// ForceScheme overrides the tile scheme used by ReadTileXYZ to determine if
+	// the y coordinate must be flipped.  Must be "tms", "xyz", or empty.  By
+	// default, the scheme is read from the 'scheme' metadata item, if present,
+	// or is otherwise TMS as required by the mbtiles specification.  Use this
+	// for files where stored tiles do not match their declared scheme.
+	ForceScheme string
+
+	// PoolSize is the number of connections opened in the connection pool.
+	// Defaults to 10 if 0.
+	PoolSize int
+
+	// Flags are used to open connections in the connection pool.  Defaults to
+	// SQLITE_OPEN_READONLY | SQLITE_OPEN_NOMUTEX if 0.
+	Flags sqlite.OpenFlags
+
+	// BusyRetryAttempts is the number of times ReadTile and ReadMetadata are
+	// retried if they fail because the database is busy or locked, e.g.,
+	// while the mbtiles file is being replaced.  Defaults to 0 (no retries).
+	BusyRetryAttempts int
+
+	// BusyRetryBackoff is the time to wait before the first retry; this is
+	// increased linearly for each subsequent retry.
+	BusyRetryBackoff time.Duration
+
+	// AutoReload checks the modification time of the mbtiles file each time a
+	// connection is requested, and reloads the file if it has changed; see
+	// Reload.
+	AutoReload bool
+
+	// TileNotFoundError causes ReadTile and related methods to return
+	// ErrTileNotFound for tiles that do not exist in the database.  By
+	// default, data is set to nil and no error is returned.
+	TileNotFoundError bool
+
+	// WALReadOnly allows opening an mbtiles file in WAL journal mode that has
+	// an associated -wal file, e.g., while it is written by another process.
+	// By default, these are refused.  Connections are opened read-write so
+	// that the WAL can be read consistently, but are restricted to queries
+	// that do not modify the database.  Unless Flags is set, connections are
+	// opened using SQLITE_OPEN_READWRITE | SQLITE_OPEN_NOMUTEX.
+	WALReadOnly bool
+
+	// Logger is called on events that may be useful for monitoring; see
+	// Logger.  By default, no events are logged.
+	Logger Logger
+
+	// StrictCoordinates causes ReadTile and related methods to return an
+	// error for tile coordinates outside the valid range at the zoom level,
+	// rather than reading no tile.
+	StrictCoordinates bool
+
+	// XYZ causes ReadTile and related methods that read tiles by coordinate,
+	// as well as EachTile, to use y in the XYZ tile scheme used by most web
+	// maps.  y is flipped unless tiles are stored in XYZ scheme according to
+	// the 'scheme' metadata item or the ForceScheme option.  By default, y is
+	// in the scheme used to store tiles, which is TMS unless otherwise
+	// specified.
+	XYZ bool
+
+	// HonorScheme causes ReadTile and related methods that read tiles by
+	// coordinate, as well as EachTile, to use y in the TMS scheme even if
+	// tiles are stored in XYZ scheme according to the 'scheme' metadata item
+	// or the ForceScheme option, in which case y is flipped.  By default, y is
+	// in the scheme used to store tiles.  Ignored if the XYZ option is set.
+	HonorScheme bool
+
+	// LenientMetadata causes ReadMetadata to skip metadata items that cannot
+	// be parsed (e.g., malformed bounds or json) rather than returning an
+	// error.  Skipped items are available from MetadataWarnings and are
+	// logged as "metadata_warning" events.
+	LenientMetadata bool
+
+	// SanitizeHTML removes HTML that is not allowed by SanitizeHTML from the
+	// description, attribution, and legend metadata items when they are read,
+	// for mbtiles files from untrusted sources.
+	SanitizeHTML bool
+
+	// WAL switches the mbtiles file to WAL journal mode when it is opened and
+	// configures each connection in the pool; see EnableWAL.  Flags must
+	// include SQLITE_OPEN_READWRITE, e.g., using OpenReadWrite.  Files with an
+	// associated -wal file are opened normally.
+	WAL *WALOptions
+}
+
+// Logger receives an event name and fields describing the event.  Events are:
+//   - "pool_wait": waiting for a connection from the pool took longer than
+//     100ms; fields: wait (time.Duration)
+//   - "tile_not_found": a tile read did not find the tile; fields: z, x, y
+//   - "busy_retry": a read is retried because the database is busy or locked;
+//     fields: attempt (int), error (error)
+//   - "reload": the mbtiles file was reloaded because it changed on disk;
+//     fields: filename (string), timestamp (time.Time)
+//   - "metadata_warning": a metadata item was skipped because it cannot be
+//     parsed, with the LenientMetadata option; fields: error (error)
+//
+// Logger may be called while a connection is held, so it must not call methods
+// of the MBtiles handle that read from the database, which may wait for a
+// connection.
+type Logger func(event string, fields map[string]interface{})
+
+// poolWaitThreshold is the time waiting for a connection from the pool after
+// which a "pool_wait" event is logged.
+const poolWaitThreshold = 100 * time.Millisecond
+
+// Option sets a value in Options; see Open.
+type Option func(*Options)
+
+// WithPoolSize sets the number of connections opened in the connection pool.
+func WithPoolSize(n int) Option {
+	return func(o *Options) {
+		o.PoolSize = n
+	}
+}
+
+// WithFlags sets the flags used to open connections in the connection pool,
+// e.g., to open the mbtiles file for read-write access.
+func WithFlags(flags sqlite.OpenFlags) Option {
+	return func(o *Options) {
+		o.Flags = flags
+	}
+}
+
+// WithBusyRetry retries ReadTile and ReadMetadata up to attempts times, waiting
+// backoff multiplied by the attempt number between each retry, if they fail
+// because the database is busy or locked.
+func WithBusyRetry(attempts int, backoff time.Duration) Option {
+	return func(o *Options) {
+		o.BusyRetryAttempts = attempts
+		o.BusyRetryBackoff = backoff
+	}
+}
+
+// WithAutoReload reloads the mbtiles file when it changes on disk; see Reload.
+func WithAutoReload() Option {
+	return func(o *Options) {
+		o.AutoReload = true
+	}
+}
+
+// WithTileNotFoundError returns ErrTileNotFound when reading a tile that does
+// not exist in the database, instead of setting data to nil.
+func WithTileNotFoundError() Option {
+	return func(o *Options) {
+		o.TileNotFoundError = true
+	}
+}
+
+// WithWALReadOnly allows opening an mbtiles file in WAL journal mode that has
+// an associated -wal file; see Options.WALReadOnly.
+func WithWALReadOnly() Option {
+	return func(o *Options) {
+		o.WALReadOnly = true
+	}
+}
+
+// WithLogger calls fn on events that may be useful for monitoring; see Logger.
+func WithLogger(fn Logger) Option {
+	return func(o *Options) {
+		o.Logger = fn
+	}
+}
+
+// WithXYZ sets the XYZ option to read tiles using y in the XYZ tile scheme.
+func WithXYZ() Option {
+	return func(o *Options) {
+		o.XYZ = true
+	}
+}
+
+// WithHonorScheme sets the HonorScheme option to read tiles using y in the TMS
+// scheme regardless of the scheme used to store tiles.
+func WithHonorScheme() Option {
+	return func(o *Options) {
+		o.HonorScheme = true
+	}
+}
+
+// WithLenientMetadata sets the LenientMetadata option to skip metadata items
+// that cannot be parsed.
+func WithLenientMetadata() Option {
+	return func(o *Options) {
+		o.LenientMetadata = true
+	}
+}
+
+// WithSanitizeHTML sets the SanitizeHTML option to sanitize HTML in the
+// description, attribution, and legend metadata items.
+func WithSanitizeHTML() Option {
+	return func(o *Options) {
+		o.SanitizeHTML = true
+	}
+}
+
+// WithStrictCoordinates returns an error when reading a tile with coordinates
+// outside the valid range at the zoom level; see Options.StrictCoordinates.
+func WithStrictCoordinates() Option {
+	return func(o *Options) {
+		o.StrictCoordinates = true
+	}
 }
 
 // Open opens an MBtiles file for reading, and validates that it has the correct
-// structure.
-func Open(path string) (*MBtiles, error) {
-	modTime, err := getModTime(path)
+// structure.  By default, a pool of 10 read-only connections is opened; this
+// can be changed using WithPoolSize and WithFlags.
+// Files with an associated -journal file (incomplete tileset) are refused
+// unless the IgnoreJournal option is set, and files with an associated -wal
+// file (WAL mode tileset being written) are refused unless WithWALReadOnly is
+// used.  Files in WAL mode without a -wal file are opened normally.
+func Open(path string, opts ...Option) (*MBtiles, error) {
+	var options Options
+	for _, opt := range opts {
+		opt(&options)
+	}
+	return OpenWithOptions(path, options)
+}
+
+// OpenContext opens an MBtiles file for reading as for Open.  Validating the
+// file and opening the connection pool are stopped and ctx.Err() is returned
+// if ctx is cancelled.
+func OpenContext(ctx context.Context, path string, opts ...Option) (*MBtiles, error) {
+	var options Options
+	for _, opt := range opts {
+		opt(&options)
+	}
+	return openWithOptions(ctx, path, options)
+}
+
+// OpenWithOptions opens an MBtiles file for reading using the provided Options,
+// and validates that it has the correct structure.
+func OpenWithOptions(path string, opts Options) (*MBtiles, error) {
+	return openWithOptions(context.Background(), path, opts)
+}
+
+// openWithOptions opens an MBtiles file for reading using the provided
+// Options.  Queries used to validate the file are interrupted if ctx is
+// cancelled.
+func openWithOptions(ctx context.Context, path string, opts Options) (*MBtiles, error) {
+	if opts.ForceScheme != "" && opts.ForceScheme != "tms" && opts.ForceScheme != "xyz" {
+		return nil, fmt.Errorf("ForceScheme must be one of tms, xyz, got: %q", opts.ForceScheme)
+	}
+	if opts.PoolSize < 0 {
+		return nil, fmt.Errorf("PoolSize must be at least 1, got: %d", opts.PoolSize)
+	}
+	if opts.PoolSize == 0 {
+		opts.PoolSize = defaultPoolSize
+	}
+	if opts.BusyRetryAttempts < 0 {
+		return nil, fmt.Errorf("BusyRetryAttempts must not be negative, got: %d", opts.BusyRetryAttempts)
+	}
+	if opts.WAL != nil {
+		if opts.WALReadOnly {
+			return nil, errors.New("WAL and WALReadOnly options cannot be used together")
+		}
+		if opts.Flags&sqlite.SQLITE_OPEN_READWRITE == 0 {
+			return nil, errors.New("WAL option requires Flags to include SQLITE_OPEN_READWRITE")
+		}
+		if err := opts.WAL.validate(); err != nil {
+			return nil, err
+		}
+	}
+	validateFlags := sqlite.SQLITE_OPEN_READONLY | sqlite.SQLITE_OPEN_NOMUTEX
+	if opts.WALReadOnly || opts.WAL != nil {
+		validateFlags = sqlite.SQLITE_OPEN_READWRITE | sqlite.SQLITE_OPEN_NOMUTEX
+	}
+	if opts.Flags == 0 {
+		opts.Flags = validateFlags
+	}
+
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+
+	modTime, err := getModTime(path, opts.IgnoreJournal, opts.WALReadOnly || opts.WAL != nil)
+	if err != nil {
+		return nil, err
+	}
+	file, err := os.Stat(path)
 	if err != nil {
 		return nil, err
 	}
 
 	// open a single connection first while we are verifying the database
 	// since there are issues closing out a connection pool on error here
-	con, err := sqlite.OpenConn(path, sqlite.SQLITE_OPEN_READONLY|sqlite.SQLITE_OPEN_NOMUTEX)
+	con, err := sqlite.OpenConn(path, validateFlags)
 	if err != nil {
 		return nil, err
 	}
 	defer con.Close()
+	con.SetInterrupt(ctx.Done())
 
-	err = validateRequiredTables(con)
-	if err != nil {
-		return nil, err
+	format, tilesize, scheme, err := validateTileset(con, opts)
+	var minZoom, maxZoom int64
+	var dedup bool
+	if err == nil {
+		minZoom, maxZoom, err = getZoomRange(con)
+	}
+	if err == nil {
+		dedup, err = hasDedupSchema(con)
 	}
-	format, tilesize, err := getTileFormatAndSize(con)
 	if err != nil {
+		// validation queries are interrupted when ctx is cancelled; report the
+		// cancellation rather than the interrupt
+		if ctxErr := ctx.Err(); ctxErr != nil {
+			return nil, ctxErr
+		}
 		return nil, err
 	}
 
-	pool, err := sqlitex.Open(path, sqlite.SQLITE_OPEN_READONLY|sqlite.SQLITE_OPEN_NOMUTEX, 10)
+	pool, err := sqlitex.Open(path, opts.Flags, opts.PoolSize)
 	if err != nil {
 		return nil, err
 	}
+	if opts.WALReadOnly {
+		if err = setPoolQueryOnly(pool, opts.PoolSize); err != nil {
+			pool.Close()
+			return nil, err
+		}
+	}
+	if opts.WAL != nil {
+		walOpts := *opts.WAL
+		err = configurePool(pool, opts.PoolSize, func(con *sqlite.Conn) error {
+			return setWAL(con, walOpts)
+		})
+		if err != nil {
+			pool.Close()
+			return nil, err
+		}
+	}
+	if err := ctx.Err(); err != nil {
+		pool.Close()
+		return nil, err
+	}
 
 	db := &MBtiles{
 		filename:  path,
 		pool:      pool,
 		timestamp: modTime,
+		file:      file,
 		format:    format,
 		tilesize:  tilesize,
+		scheme:    scheme,
+		minZoom:   minZoom,
+		maxZoom:   maxZoom,
+		dedup:     dedup,
+		opts:      opts,
 	}
+	trackHandle(db)
 
 	return db, nil
 }
 
-func getModTime(path string) (time.Time, error) {
+// validateTileset validates the structure of the mbtiles file using con, and
+// detects its tile format, size, and scheme.
+func validateTileset(con *sqlite.Conn, opts Options) (format TileFormat, tilesize uint32, scheme string, err error) {
+	if opts.WALReadOnly {
+		if err = setQueryOnly(con); err != nil {
+			return
+		}
+	}
+	if err = validateRequiredTables(con); err != nil {
+		return
+	}
+	if err = validateTileColumnTypes(con); err != nil {
+		return
+	}
+	if format, tilesize, err = getTileFormatAndSize(con); err != nil {
+		return
+	}
+	scheme = opts.ForceScheme
+	if scheme == "" {
+		scheme, err = getScheme(con)
+	}
+	return
+}
+
+// getModTime returns the modification time of path.  Unless ignoreJournal is
+// true, an error is returned if path has an associated -journal file.  Unless
+// allowWAL is true, an error is returned if path has an associated -wal file;
+// otherwise the later of the modification times of path and its -wal file is
+// returned, since commits in WAL mode modify only the -wal file.
+func getModTime(path string, ignoreJournal bool, allowWAL bool) (time.Time, error) {
 	stat, err := os.Stat(path)
 	if err != nil {
 		if errors.Is(err, os.ErrNotExist) {
@@ -155,181 +639,1617 @@ func getModTime(path string) (time.Time, error) {
 		return time.Time{}, err
 	}
 	// there must not be a corresponding *-journal file (tileset is still being created)
-	if _, err := os.Stat(path + "-journal"); err == nil {
-		return time.Time{}, fmt.Errorf("refusing to open mbtiles file with associated -journal file (incomplete tileset)")
+	if _, err := os.Stat(path + "-journal"); err == nil && !ignoreJournal {
+		return time.Time{}, ErrJournalPresent
+	}
+	modTime := stat.ModTime()
+	// a *-wal file indicates the tileset is open for writing in WAL mode
+	if walStat, err := os.Stat(path + "-wal"); err == nil {
+		if !allowWAL {
+			return time.Time{}, ErrWALPresent
+		}
+		if walStat.ModTime().After(modTime) {
+			modTime = walStat.ModTime()
+		}
+	}
+	return modTime.Round(time.Second), nil
+}
+
+// setQueryOnly prevents con from modifying the database.
+func setQueryOnly(con *sqlite.Conn) error {
+	return sqlitex.ExecTransient(con, "PRAGMA query_only = true", nil)
+}
+
+// setPoolQueryOnly prevents all size connections in pool from modifying the
+// database.
+func setPoolQueryOnly(pool *sqlitex.Pool, size int) error {
+	return configurePool(pool, size, setQueryOnly)
+}
+
+// configurePool calls fn with each of the size connections in pool.  All
+// connections must be available in the pool.
+func configurePool(pool *sqlitex.Pool, size int, fn func(*sqlite.Conn) error) error {
+	cons := make([]*sqlite.Conn, 0, size)
+	defer func() {
+		for _, con := range cons {
+			pool.Put(con)
+		}
+	}()
+	for i := 0; i < size; i++ {
+		con := pool.Get(context.Background())
+		if con == nil {
+			return errors.New("connection could not be opened")
+		}
+		cons = append(cons, con)
+		if err := fn(con); err != nil {
+			return err
+		}
 	}
-	return stat.ModTime().Round(time.Second), nil
+	return nil
 }
 
-// Close closes a MBtiles file
+// Close closes a MBtiles file.  Connections held by open Snapshots and
+// BatchWriters remain usable until they are released, after which they are
+// closed.
 func (db *MBtiles) Close() {
-	if db.pool != nil {
-		db.pool.Close()
+	db.mu.Lock()
+	pool := db.pool
+	db.pool = nil
+	closePool := pool != nil && db.refs[pool] == 0
+	db.mu.Unlock()
+
+	if closePool {
+		pool.Close()
+	}
+	untrackHandle(db)
+}
+
+// Rebind opens and validates the mbtiles file at path using the same Options
+// as the existing handle, and replaces the existing connection pool and
+// detected tile format, size, and scheme with those of the new file.  The
+// existing pool is closed once in-progress reads, open Snapshots, and open
+// BatchWriters have released their connections, which continue to read from
+// the previous file until then.  On error, the existing handle is left
+// unchanged.
+func (db *MBtiles) Rebind(path string) error {
+	db.mu.RLock()
+	opts := db.opts
+	db.mu.RUnlock()
+
+	next, err := OpenWithOptions(path, opts)
+	if err != nil {
+		return err
+	}
+	// the pool is transferred to db, so it must not be closed when next is
+	// garbage collected
+	untrackHandle(next)
+
+	db.mu.Lock()
+	prev := db.pool
+	closePool := prev != nil && db.refs[prev] == 0
+	db.filename = next.filename
+	db.pool = next.pool
+	db.timestamp = next.timestamp
+	db.file = next.file
+	db.format = next.format
+	db.tilesize = next.tilesize
+	db.scheme = next.scheme
+	db.inMemory = next.inMemory
+	db.dedup = next.dedup
+	db.mu.Unlock()
+	db.setZoomRange(next.minZoom, next.maxZoom)
+
+	if closePool {
+		prev.Close()
+	}
+	db.InvalidateMetadata()
+	// db may have been closed, in which case it is no longer tracked
+	untrackHandle(db)
+	trackHandle(db)
+
+	return nil
+}
+
+// Reload checks the modification time of the mbtiles file, and if it differs
+// from the timestamp of the open file, replaces the connection pool with one
+// opened against the new file, as for Rebind.  This supports mbtiles files that
+// are atomically replaced on disk while they are open.  Modification times are
+// compared at a precision of one second.
+func (db *MBtiles) Reload() error {
+	db.mu.RLock()
+	filename := db.filename
+	timestamp := db.timestamp
+	opts := db.opts
+	closed := db.pool == nil
+	db.mu.RUnlock()
+
+	if closed {
+		return fmt.Errorf("cannot reload: %w", ErrDatabaseClosed)
+	}
+
+	modTime, err := getModTime(filename, opts.IgnoreJournal, opts.WALReadOnly || opts.WAL != nil)
+	if err != nil {
+		return err
+	}
+	if modTime.Equal(timestamp) {
+		return nil
 	}
+	if err := db.Rebind(filename); err != nil {
+		return err
+	}
+	if opts.Logger != nil {
+		opts.Logger("reload", map[string]interface{}{"filename": filename, "timestamp": modTime})
+	}
+	return nil
 }
 
 // ReadTile reads a tile for z, x, y into the provided *[]byte.
-// data will be nil if the tile does not exist in the database
+// data will be nil if the tile does not exist in the database, unless the
+// TileNotFoundError option is set, in which case ErrTileNotFound is returned.
+// zoom_level, tile_column, and tile_row must be stored as integers; this is
+// validated when the mbtiles file is opened.
+// If the AutoDecompress option is set, GZIP and ZLIB encoded tiles are
+// decompressed.
 func (db *MBtiles) ReadTile(z int64, x int64, y int64, data *[]byte) error {
-	if db == nil || db.pool == nil {
-		return errors.New("cannot read tile from closed mbtiles database")
+	return db.ReadTileContext(context.Background(), z, x, y, data)
+}
+
+// GetTile reads and returns the tile for z, x, y, as for ReadTile.  data is nil
+// if the tile does not exist in the database, unless the TileNotFoundError
+// option is set, in which case ErrTileNotFound is returned.
+func (db *MBtiles) GetTile(z int64, x int64, y int64) ([]byte, error) {
+	var data []byte
+	err := db.ReadTile(z, x, y, &data)
+	if err != nil {
+		return nil, err
 	}
+	return data, nil
+}
 
-	con, err := db.getConnection(context.TODO())
+// ReadTileContext reads a tile for z, x, y into the provided *[]byte, as for
+// ReadTile.  Waiting for a connection from the pool and the query are
+// cancelled if ctx is cancelled.
+func (db *MBtiles) ReadTileContext(ctx context.Context, z int64, x int64, y int64, data *[]byte) error {
+	return db.readTileContext(ctx, z, x, y, db.opts.XYZ, data)
+}
+
+// readTileContext reads a tile as for ReadTileContext, where y is in the XYZ
+// tile scheme if xyz is true.
+func (db *MBtiles) readTileContext(ctx context.Context, z int64, x int64, y int64, xyz bool, data *[]byte) error {
+	if db == nil {
+		return fmt.Errorf("cannot read tile: %w", ErrDatabaseClosed)
+	}
+	if db.opts.StrictCoordinates {
+		if err := validateTileCoord(z, x, y); err != nil {
+			return err
+		}
+	}
+
+	con, err := db.getConnection(ctx)
 	defer db.closeConnection(con)
 	if err != nil {
 		return err
 	}
 
-	query, err := con.Prepare("select tile_data from tiles where zoom_level = $z and tile_column = $x and tile_row = $y")
+	return db.readTileWithOptions(ctx, con, z, x, y, xyz, data)
+}
+
+// readTileWithOptions reads the tile for z, x, y into data using con, as for
+// readStoredTile, and decompresses it with the AutoDecompress option.
+func (db *MBtiles) readTileWithOptions(ctx context.Context, con *sqlite.Conn, z int64, x int64, y int64, xyz bool, data *[]byte) error {
+	err := db.readStoredTile(ctx, con, z, x, y, xyz, data)
 	if err != nil {
 		return err
 	}
-	defer query.Reset()
 
-	query.SetInt64("$z", z)
-	query.SetInt64("$x", x)
-	query.SetInt64("$y", y)
+	if db.opts.AutoDecompress {
+		*data, err = decompressTile(*data)
+	}
+	return err
+}
 
-	hasRow, err := query.Step()
+// readStoredTile reads the tile for z, x, y into data as stored using con,
+// where y is in the XYZ tile scheme if xyz is true.  As for ReadTile, reads are
+// retried if the database is busy, and a "tile_not_found" event is logged and
+// ErrTileNotFound is returned with the TileNotFoundError option if the tile
+// does not exist.  Coordinates must be validated by the caller if the
+// StrictCoordinates option is set.
+func (db *MBtiles) readStoredTile(ctx context.Context, con *sqlite.Conn, z int64, x int64, y int64, xyz bool, data *[]byte) error {
+	err := retryBusy(ctx, db.opts.BusyRetryAttempts, db.opts.BusyRetryBackoff, db.opts.Logger, func() error {
+		return readTile(con, z, x, db.tileRow(z, y, xyz), data)
+	})
 	if err != nil {
 		return err
 	}
+	if *data == nil {
+		if db.opts.Logger != nil {
+			db.opts.Logger("tile_not_found", map[string]interface{}{"z": z, "x": x, "y": y})
+		}
+		if db.opts.TileNotFoundError {
+			return ErrTileNotFound
+		}
+	}
+	return nil
+}
 
-	// If this tile does not exist in the database, return empty bytes
-	if !hasRow {
-		*data = nil
-		return nil
+// ReadTileBuffer appends the tile for z, x, y to buf and returns the extended
+// slice, so that callers may reuse buffers across reads (e.g., from a
+// sync.Pool).  If the tile does not exist in the database, buf is returned
+// unchanged, unless the TileNotFoundError option is set, in which case
+// ErrTileNotFound is returned.  If the AutoDecompress option is set, GZIP and
+// ZLIB encoded tiles are decompressed before being appended.
+func (db *MBtiles) ReadTileBuffer(z int64, x int64, y int64, buf []byte) ([]byte, error) {
+	if db == nil {
+		return buf, fmt.Errorf("cannot read tile: %w", ErrDatabaseClosed)
+	}
+	if db.opts.StrictCoordinates {
+		if err := validateTileCoord(z, x, y); err != nil {
+			return buf, err
+		}
 	}
 
-	var tileData = make([]byte, query.ColumnLen(0))
-	query.ColumnBytes(0, tileData)
-	*data = tileData[:]
+	con, err := db.getConnection(context.TODO())
+	defer db.closeConnection(con)
+	if err != nil {
+		return buf, err
+	}
 
+	var out []byte
+	var found bool
+	err = retryBusy(context.TODO(), db.opts.BusyRetryAttempts, db.opts.BusyRetryBackoff, db.opts.Logger, func() error {
+		out, found, err = appendTile(con, z, x, db.tileRow(z, y, db.opts.XYZ), buf)
+		return err
+	})
 	if err != nil {
+		return buf, err
+	}
+	if !found {
+		if db.opts.Logger != nil {
+			db.opts.Logger("tile_not_found", map[string]interface{}{"z": z, "x": x, "y": y})
+		}
+		if db.opts.TileNotFoundError {
+			return buf, ErrTileNotFound
+		}
+		return buf, nil
+	}
+
+	if db.opts.AutoDecompress {
+		data, err := decompressTile(out[len(buf):])
+		if err != nil {
+			return buf, err
+		}
+		out = append(out[:len(buf)], data...)
+	}
+	return out, nil
+}
+
+// ReadTileDecoded reads a tile for z, x, y into the provided *[]byte, and
+// decompresses it if it is GZIP or ZLIB encoded, regardless of the
+// AutoDecompress option.  Other tiles are returned unmodified.
+// data will be nil if the tile does not exist in the database, unless the
+// TileNotFoundError option is set.
+func (db *MBtiles) ReadTileDecoded(z int64, x int64, y int64, data *[]byte) error {
+	err := db.readTileContext(context.TODO(), z, x, y, db.opts.XYZ, data)
+	if err != nil || db.opts.AutoDecompress {
+		// tiles have already been decompressed with AutoDecompress
 		return err
 	}
 
-	return nil
+	*data, err = decompressTile(*data)
+	return err
 }
 
-// ReadMetadata reads the metadata table into a map, casting their values into
-// the appropriate type
-func (db *MBtiles) ReadMetadata() (map[string]interface{}, error) {
-	if db == nil || db.pool == nil {
-		return nil, errors.New("cannot read tile from closed mbtiles database")
+// WriteTileTo writes the tile for z, x, y to w, streaming the tile data from
+// the database without copying it into a separate []byte.  Tile data are
+// written as stored, regardless of the AutoDecompress option.  Returns the
+// number of bytes written, or ErrTileNotFound if the tile does not exist in the
+// database.  A connection is held until the tile has been written.
+func (db *MBtiles) WriteTileTo(z int64, x int64, y int64, w io.Writer) (int64, error) {
+	if db == nil {
+		return 0, fmt.Errorf("cannot read tile: %w", ErrDatabaseClosed)
+	}
+	if db.opts.StrictCoordinates {
+		if err := validateTileCoord(z, x, y); err != nil {
+			return 0, err
+		}
 	}
 
 	con, err := db.getConnection(context.TODO())
 	defer db.closeConnection(con)
 	if err != nil {
-		return nil, err
+		return 0, err
 	}
 
-	var (
-		key   string
-		value string
-	)
-	metadata := make(map[string]interface{})
-
-	query, err := con.Prepare("select name, value from metadata where value is not ''")
+	query, err := con.Prepare(readTileQuery)
 	if err != nil {
-		return nil, err
+		return 0, err
 	}
 	defer query.Reset()
 
-	for {
-		hasRow, err := query.Step()
-		if err != nil {
-			return nil, err
-		}
-		if !hasRow {
-			break
+	query.SetInt64("$z", z)
+	query.SetInt64("$x", x)
+	query.SetInt64("$y", db.tileRow(z, y, db.opts.XYZ))
+
+	hasRow, err := query.Step()
+	if err != nil {
+		return 0, err
+	}
+	if !hasRow {
+		if db.opts.Logger != nil {
+			db.opts.Logger("tile_not_found", map[string]interface{}{"z": z, "x": x, "y": y})
 		}
+		return 0, ErrTileNotFound
+	}
 
-		key = query.GetText("name")
-		value = query.GetText("value")
+	return io.Copy(w, query.ColumnReader(0))
+}
 
-		switch key {
-		case "maxzoom", "minzoom":
-			metadata[key], err = strconv.Atoi(value)
-			if err != nil {
-				return nil, fmt.Errorf("cannot read metadata item %s: %v", key, err)
+// HasTile returns true if a tile for z, x, y exists in the database, without
+// reading its data.  If the StrictCoordinates option is set, an error is
+// returned for coordinates outside the valid range at the zoom level.
+func (db *MBtiles) HasTile(z int64, x int64, y int64) (bool, error) {
+	if db == nil {
+		return false, fmt.Errorf("cannot read tile: %w", ErrDatabaseClosed)
+	}
+	if db.opts.StrictCoordinates {
+		if err := validateTileCoord(z, x, y); err != nil {
+			return false, err
+		}
+	}
+
+	con, err := db.getConnection(context.TODO())
+	defer db.closeConnection(con)
+	if err != nil {
+		return false, err
+	}
+
+	query, err := con.Prepare("select 1 from tiles where zoom_level = $z and tile_column = $x and tile_row = $y limit 1")
+	if err != nil {
+		return false, err
+	}
+	defer query.Reset()
+
+	query.SetInt64("$z", z)
+	query.SetInt64("$x", x)
+	query.SetInt64("$y", db.tileRow(z, y, db.opts.XYZ))
+
+	return query.Step()
+}
+
+// ReadTiles reads the tiles for each z, x, y in coords using a single
+// connection from the pool, and calls handler with the data for each tile in
+// order.  data will be nil if the tile does not exist in the database, unless
+// the TileNotFoundError option is set, in which case reading stops and
+// ErrTileNotFound is returned.  Coordinates are validated before any tiles are
+// read if the StrictCoordinates option is set.  Reading stops at the first
+// error returned by handler.
+// If the AutoDecompress option is set, GZIP and ZLIB encoded tiles are
+// decompressed.
+func (db *MBtiles) ReadTiles(coords [][3]int64, handler func(z, x, y int64, data []byte) error) error {
+	if db == nil {
+		return fmt.Errorf("cannot read tile: %w", ErrDatabaseClosed)
+	}
+	if db.opts.StrictCoordinates {
+		for _, coord := range coords {
+			if err := validateTileCoord(coord[0], coord[1], coord[2]); err != nil {
+				return err
+			}
+		}
+	}
+
+	con, err := db.getConnection(context.TODO())
+	defer db.closeConnection(con)
+	if err != nil {
+		return err
+	}
+
+	var data []byte
+	for _, coord := range coords {
+		z, x, y := coord[0], coord[1], coord[2]
+
+		// readTile reuses the prepared statement cached on con
+		err = db.readTileWithOptions(context.TODO(), con, z, x, y, db.opts.XYZ, &data)
+		if err != nil {
+			return err
+		}
+
+		err = handler(z, x, y, data)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// GetTiles reads the tiles for each coordinate in coords using a single
+// connection from the pool, as for ReadTiles, and returns their data keyed by
+// coordinate.  Tiles that do not exist in the database are not present, unless
+// the TileNotFoundError option is set, in which case ErrTileNotFound is
+// returned.  Coordinates are validated if the StrictCoordinates option is set.
+func (db *MBtiles) GetTiles(coords []TileCoord) (map[TileCoord][]byte, error) {
+	zxy := make([][3]int64, len(coords))
+	for i, coord := range coords {
+		zxy[i] = [3]int64{coord.Z, coord.X, coord.Y}
+	}
+
+	tiles := make(map[TileCoord][]byte, len(coords))
+	err := db.ReadTiles(zxy, func(z, x, y int64, data []byte) error {
+		if data != nil {
+			tiles[TileCoord{Z: z, X: x, Y: y}] = data
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return tiles, nil
+}
+
+// EachTile calls fn with the coordinates and data of every tile in the
+// database, using a single connection from the pool.  y is in the TMS scheme
+// used by mbtiles, or the XYZ scheme if the XYZ option is set, as for
+// ReadTile.  Tiles are streamed from the database rather than loaded
+// into memory at once; data is a copy that fn may retain.  Iteration stops at
+// the first error returned by fn or when ctx is cancelled.
+// If the AutoDecompress option is set, GZIP and ZLIB encoded tiles are
+// decompressed.
+func (db *MBtiles) EachTile(ctx context.Context, fn func(z, x, y int64, data []byte) error) error {
+	if db == nil {
+		return fmt.Errorf("cannot read tile: %w", ErrDatabaseClosed)
+	}
+
+	con, err := db.getConnection(ctx)
+	defer db.closeConnection(con)
+	if err != nil {
+		return err
+	}
+
+	err = sqlitex.Exec(con, "select zoom_level, tile_column, tile_row, tile_data from tiles", func(stmt *sqlite.Stmt) error {
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+
+		var tileData = make([]byte, stmt.ColumnLen(3))
+		stmt.ColumnBytes(3, tileData)
+
+		if db.opts.AutoDecompress {
+			var err error
+			tileData, err = decompressTile(tileData)
+			if err != nil {
+				return err
+			}
+		}
+
+		z := stmt.ColumnInt64(0)
+		return fn(z, stmt.ColumnInt64(1), db.tileRow(z, stmt.ColumnInt64(2), db.opts.XYZ), tileData)
+	})
+
+	// the pool interrupts the query when ctx is cancelled; report the
+	// cancellation rather than the interrupt
+	if ctxErr := ctx.Err(); err != nil && ctxErr != nil {
+		return ctxErr
+	}
+	return err
+}
+
+// ReadTileXYZ reads a tile for z, x, y into the provided *[]byte, where y is in
+// the XYZ tile scheme used by most web maps.  y is flipped to the TMS scheme
+// unless tiles are stored in XYZ scheme according to the 'scheme' metadata item
+// or the ForceScheme option.
+// data will be nil if the tile does not exist in the database.  Returns an
+// error if z, x, or y are outside the valid range of tiles.
+func (db *MBtiles) ReadTileXYZ(z int64, x int64, y int64, data *[]byte) error {
+	if db == nil {
+		return fmt.Errorf("cannot read tile: %w", ErrDatabaseClosed)
+	}
+	if err := validateTileCoord(z, x, y); err != nil {
+		return err
+	}
+	return db.readTileContext(context.Background(), z, x, y, true, data)
+}
+
+// ReadTileQuadkey reads the tile for a Bing Maps quadkey into the provided
+// *[]byte.  data will be nil if the tile does not exist in the database.  The
+// tile is read from the row given by the scheme used to store tiles, as for
+// ReadTileXYZ.
+func (db *MBtiles) ReadTileQuadkey(quadkey string, data *[]byte) error {
+	z, x, y, err := QuadkeyToTile(quadkey)
+	if err != nil {
+		return err
+	}
+	// quadkeys are in the XYZ scheme, which is flipped to the stored row
+	return db.readTileContext(context.Background(), z, x, flipY(z, y), true, data)
+}
+
+// ReadTileWithNeighbors reads the tile for z, x, y and its eight neighbors in a
+// single query.  neighbors is keyed by the [x, y] coordinates of each neighbor;
+// neighbors that do not exist in the database are not present.  center will be
+// nil if the tile does not exist in the database.  y and the neighbor keys are
+// in the TMS scheme used by mbtiles, or the XYZ scheme if the XYZ option is
+// set, and z, x, y are validated if the StrictCoordinates option is set, as for
+// ReadTile.
+// If the AutoDecompress option is set, GZIP and ZLIB encoded tiles are
+// decompressed.
+func (db *MBtiles) ReadTileWithNeighbors(z int64, x int64, y int64) ([]byte, map[[2]int64][]byte, error) {
+	if db == nil {
+		return nil, nil, fmt.Errorf("cannot read tile: %w", ErrDatabaseClosed)
+	}
+	if db.opts.StrictCoordinates {
+		if err := validateTileCoord(z, x, y); err != nil {
+			return nil, nil, err
+		}
+	}
+
+	con, err := db.getConnection(context.TODO())
+	defer db.closeConnection(con)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	// flipping y preserves the range of neighboring rows
+	row := db.tileRow(z, y, db.opts.XYZ)
+	var center []byte
+	neighbors := make(map[[2]int64][]byte)
+	err = sqlitex.Exec(con, "select tile_column, tile_row, tile_data from tiles where zoom_level = ? and tile_column between ? and ? and tile_row between ? and ?", func(stmt *sqlite.Stmt) error {
+		var tileData = make([]byte, stmt.ColumnLen(2))
+		stmt.ColumnBytes(2, tileData)
+
+		if db.opts.AutoDecompress {
+			var err error
+			tileData, err = decompressTile(tileData)
+			if err != nil {
+				return err
 			}
+		}
+
+		key := [2]int64{stmt.ColumnInt64(0), db.tileRow(z, stmt.ColumnInt64(1), db.opts.XYZ)}
+		if key[0] == x && key[1] == y {
+			center = tileData
+		} else {
+			neighbors[key] = tileData
+		}
+		return nil
+	}, z, x-1, x+1, row-1, row+1)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	return center, neighbors, nil
+}
+
+// TileInfo describes a tile stored in the database without its data.  Y is in
+// the TMS scheme used by mbtiles.
+type TileInfo struct {
+	Z    int64
+	X    int64
+	Y    int64
+	Size int64 // number of bytes of tile data
+}
+
+// ListTiles returns up to limit tiles starting at offset, ordered by zoom
+// level, column, and row.  Only tile coordinates and sizes are read, not tile
+// data.
+func (db *MBtiles) ListTiles(limit int64, offset int64) ([]TileInfo, error) {
+	if db == nil {
+		return nil, fmt.Errorf("cannot read tile: %w", ErrDatabaseClosed)
+	}
+
+	con, err := db.getConnection(context.TODO())
+	defer db.closeConnection(con)
+	if err != nil {
+		return nil, err
+	}
+
+	var tiles []TileInfo
+	err = sqlitex.Exec(con, "select zoom_level, tile_column, tile_row, length(tile_data) from tiles order by zoom_level, tile_column, tile_row limit ? offset ?", func(stmt *sqlite.Stmt) error {
+		tiles = append(tiles, TileInfo{
+			Z:    stmt.ColumnInt64(0),
+			X:    stmt.ColumnInt64(1),
+			Y:    stmt.ColumnInt64(2),
+			Size: stmt.ColumnInt64(3),
+		})
+		return nil
+	}, limit, offset)
+	if err != nil {
+		return nil, err
+	}
+	return tiles, nil
+}
+
+// GetZoomLevels returns the distinct zoom levels that contain tiles, in
+// ascending order.
+func (db *MBtiles) GetZoomLevels() ([]int64, error) {
+	if db == nil {
+		return nil, fmt.Errorf("cannot read tile: %w", ErrDatabaseClosed)
+	}
+
+	con, err := db.getConnection(context.TODO())
+	defer db.closeConnection(con)
+	if err != nil {
+		return nil, err
+	}
+
+	var zooms []int64
+	err = sqlitex.Exec(con, "select distinct zoom_level from tiles order by zoom_level", func(stmt *sqlite.Stmt) error {
+		zooms = append(zooms, stmt.ColumnInt64(0))
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return zooms, nil
+}
+
+// CountTiles returns the total number of tiles in the database.
+func (db *MBtiles) CountTiles() (int64, error) {
+	if db == nil {
+		return 0, fmt.Errorf("cannot read tile: %w", ErrDatabaseClosed)
+	}
+
+	con, err := db.getConnection(context.TODO())
+	defer db.closeConnection(con)
+	if err != nil {
+		return 0, err
+	}
+
+	var count int64
+	err = sqlitex.Exec(con, "select count(*) from tiles", func(stmt *sqlite.Stmt) error {
+		count = stmt.ColumnInt64(0)
+		return nil
+	})
+	return count, err
+}
+
+// GetTileExtent returns the minimum and maximum tile column (x) and row (y) of
+// tiles at zoom level z.  y is in the TMS scheme used by mbtiles.  Returns an
+// error if there are no tiles at z.
+func (db *MBtiles) GetTileExtent(z int64) (minX, minY, maxX, maxY int64, err error) {
+	if db == nil {
+		return 0, 0, 0, 0, fmt.Errorf("cannot read tile: %w", ErrDatabaseClosed)
+	}
+
+	con, err := db.getConnection(context.TODO())
+	defer db.closeConnection(con)
+	if err != nil {
+		return 0, 0, 0, 0, err
+	}
+
+	hasTiles := false
+	err = sqlitex.Exec(con, "select min(tile_column), max(tile_column), min(tile_row), max(tile_row) from tiles where zoom_level = ?", func(stmt *sqlite.Stmt) error {
+		// aggregates are null if there are no tiles
+		if stmt.ColumnType(0) == sqlite.SQLITE_NULL {
+			return nil
+		}
+		hasTiles = true
+		minX, maxX = stmt.ColumnInt64(0), stmt.ColumnInt64(1)
+		minY, maxY = stmt.ColumnInt64(2), stmt.ColumnInt64(3)
+		return nil
+	}, z)
+	if err != nil {
+		return 0, 0, 0, 0, err
+	}
+	if !hasTiles {
+		return 0, 0, 0, 0, fmt.Errorf("no tiles at zoom level %d", z)
+	}
+	return minX, minY, maxX, maxY, nil
+}
+
+// ReadTileFull reads a tile for z, x, y and detects its tile format and size
+// from the tile data, which may differ from those of the tileset as a whole.
+// data will be nil and format will be UNKNOWN if the tile does not exist in the
+// database, unless the TileNotFoundError option is set, in which case
+// ErrTileNotFound is returned.  Format and size are detected before the tile
+// is decompressed by the AutoDecompress option.
+func (db *MBtiles) ReadTileFull(z int64, x int64, y int64) ([]byte, TileFormat, uint32, error) {
+	if db == nil {
+		return nil, UNKNOWN, 0, fmt.Errorf("cannot read tile: %w", ErrDatabaseClosed)
+	}
+	if db.opts.StrictCoordinates {
+		if err := validateTileCoord(z, x, y); err != nil {
+			return nil, UNKNOWN, 0, err
+		}
+	}
+
+	con, err := db.getConnection(context.TODO())
+	defer db.closeConnection(con)
+	if err != nil {
+		return nil, UNKNOWN, 0, err
+	}
+
+	var data []byte
+	err = db.readStoredTile(context.TODO(), con, z, x, y, db.opts.XYZ, &data)
+	if err != nil || data == nil {
+		return nil, UNKNOWN, 0, err
+	}
+
+	format, err := detectTileFormat(data)
+	if err != nil {
+		return data, UNKNOWN, 0, err
+	}
+
+	// GZIP masks PBF, which is only expected type for tiles in GZIP format
+	if format == GZIP {
+		format = PBF
+	}
+
+	tilesize, err := detectTileSize(format, data)
+	if err != nil {
+		return data, format, 0, err
+	}
+
+	if db.opts.AutoDecompress {
+		data, err = decompressTile(data)
+		if err != nil {
+			return nil, format, tilesize, err
+		}
+	}
+
+	return data, format, tilesize, nil
+}
+
+// ReadMetadata reads the metadata table into a map, casting their values into
+// the appropriate type.  Items in the 'json' metadata item are merged into the
+// map, and its original value is available as 'json_raw'.
+// The metadata are cached after they are first read; the cache is cleared by
+// InvalidateMetadata, RefreshMetadata, writing metadata, and Rebind.
+func (db *MBtiles) ReadMetadata() (map[string]interface{}, error) {
+	if db == nil {
+		return nil, fmt.Errorf("cannot read tile: %w", ErrDatabaseClosed)
+	}
+
+	db.metadataMu.Lock()
+	cached := db.metadata
+	db.metadataMu.Unlock()
+	if cached != nil {
+		return cloneMetadata(cached), nil
+	}
+
+	con, err := db.getConnection(context.TODO())
+	defer db.closeConnection(con)
+	if err != nil {
+		return nil, err
+	}
+
+	var (
+		metadata map[string]interface{}
+		warnings []error
+	)
+	err = retryBusy(context.TODO(), db.opts.BusyRetryAttempts, db.opts.BusyRetryBackoff, db.opts.Logger, func() (err error) {
+		metadata, warnings, err = readMetadata(con, db.opts.LenientMetadata)
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+	db.logMetadataWarnings(warnings)
+	if db.opts.SanitizeHTML {
+		sanitizeMetadata(metadata)
+	}
+
+	// metadata read from a pool that has since been replaced by Rebind are
+	// not cached; Rebind clears the cache after replacing the pool, so it
+	// waits for metadataMu if the pool is replaced after this check
+	db.metadataMu.Lock()
+	if db.isCurrent(con) {
+		db.metadata = metadata
+		db.metadataWarnings = warnings
+	}
+	db.metadataMu.Unlock()
+
+	// callers may modify the returned map, so it is not the cached map
+	return cloneMetadata(metadata), nil
+}
+
+// cloneMetadata returns a copy of metadata that does not share slices or maps
+// with it, including those merged from the 'json' metadata item.
+func cloneMetadata(metadata map[string]interface{}) map[string]interface{} {
+	clone := make(map[string]interface{}, len(metadata))
+	for key, value := range metadata {
+		clone[key] = cloneMetadataValue(value)
+	}
+	return clone
+}
+
+// cloneMetadataValue returns a copy of a metadata value, copying slices and
+// maps recursively.
+func cloneMetadataValue(value interface{}) interface{} {
+	switch v := value.(type) {
+	case []float64:
+		return slices.Clone(v)
+	case []interface{}:
+		clone := make([]interface{}, len(v))
+		for i, item := range v {
+			clone[i] = cloneMetadataValue(item)
+		}
+		return clone
+	case map[string]interface{}:
+		return cloneMetadata(v)
+	default:
+		return value
+	}
+}
+
+// InvalidateMetadata clears the metadata cached by ReadMetadata, so that the
+// metadata table is read again on the next call, e.g., after the metadata have
+// been modified by another process.
+func (db *MBtiles) InvalidateMetadata() {
+	if db == nil {
+		return
+	}
+	db.metadataMu.Lock()
+	db.metadata = nil
+	db.metadataWarnings = nil
+	db.metadataMu.Unlock()
+}
+
+// MetadataWarnings returns the metadata items that were skipped by the last
+// call to ReadMetadata because they cannot be parsed, with the LenientMetadata
+// option.
+func (db *MBtiles) MetadataWarnings() []error {
+	if db == nil {
+		return nil
+	}
+	db.metadataMu.Lock()
+	defer db.metadataMu.Unlock()
+	return slices.Clone(db.metadataWarnings)
+}
+
+// logMetadataWarnings logs each of warnings as a "metadata_warning" event.
+func (db *MBtiles) logMetadataWarnings(warnings []error) {
+	if db.opts.Logger == nil {
+		return
+	}
+	for _, warning := range warnings {
+		db.opts.Logger("metadata_warning", map[string]interface{}{"error": warning})
+	}
+}
+
+// readMetadata reads the metadata table using con into a map, casting their
+// values into the appropriate type.  If lenient is true, items that cannot be
+// parsed are skipped and returned as warnings rather than as an error.
+func readMetadata(con *sqlite.Conn, lenient bool) (metadata map[string]interface{}, warnings []error, err error) {
+	var (
+		key   string
+		value string
+	)
+	metadata = make(map[string]interface{})
+	// values from the json item are merged after all other items are read,
+	// so that they do not overwrite explicit metadata items
+	jsonMetadata := make(map[string]interface{})
+
+	// invalid reports an item that cannot be parsed, returning it as an error
+	// unless lenient is true
+	invalid := func(err error) error {
+		if !lenient {
+			return err
+		}
+		warnings = append(warnings, err)
+		return nil
+	}
+
+	query, err := con.Prepare("select name, value from metadata where value is not ''")
+	if err != nil {
+		return nil, nil, err
+	}
+	defer query.Reset()
+
+	for {
+		hasRow, err := query.Step()
+		if err != nil {
+			return nil, nil, err
+		}
+		if !hasRow {
+			break
+		}
+
+		key = query.GetText("name")
+		value = query.GetText("value")
+
+		switch key {
+		case "maxzoom", "minzoom":
+			zoom, err := strconv.Atoi(value)
+			if err != nil {
+				if err = invalid(fmt.Errorf("cannot read metadata item %s: %v", key, err)); err != nil {
+					return nil, nil, err
+				}
+				continue
+			}
+			metadata[key] = zoom
 		case "bounds", "center":
-			metadata[key], err = parseFloats(value)
+			values, err := parseFloats(value)
 			if err != nil {
-				return nil, fmt.Errorf("cannot read metadata item %s: %v", key, err)
+				if err = invalid(fmt.Errorf("cannot read metadata item %s: %v", key, err)); err != nil {
+					return nil, nil, err
+				}
+				continue
+			}
+			// bounds are west, south, east, north; center is longitude, latitude, zoom
+			expected := 4
+			if key == "center" {
+				expected = 3
 			}
+			if len(values) != expected {
+				if err = invalid(fmt.Errorf("cannot read metadata item %s: expected %d values, got %q", key, expected, value)); err != nil {
+					return nil, nil, err
+				}
+				continue
+			}
+			metadata[key] = values
 		case "json":
-			err = json.Unmarshal([]byte(value), &metadata)
+			parsed := make(map[string]interface{})
+			err = json.Unmarshal([]byte(value), &parsed)
 			if err != nil {
-				return nil, fmt.Errorf("unable to parse JSON metadata item: %v", err)
+				if err = invalid(fmt.Errorf("unable to parse JSON metadata item: %v", err)); err != nil {
+					return nil, nil, err
+				}
+				continue
 			}
+			jsonMetadata = parsed
+			// the original document is kept so that it can be reproduced exactly
+			metadata["json_raw"] = value
 		default:
 			metadata[key] = value
 		}
 	}
 
-	// Supplement missing values by inferring from available data
-	_, hasMinZoom := metadata["minzoom"]
-	_, hasMaxZoom := metadata["maxzoom"]
-	if !(hasMinZoom && hasMaxZoom) {
-		q2, err := con.Prepare("select min(zoom_level), max(zoom_level) from tiles")
+	for key, value := range jsonMetadata {
+		if _, ok := metadata[key]; !ok {
+			metadata[key] = value
+		}
+	}
+
+	// Supplement missing values by inferring from available data
+	_, hasMinZoom := metadata["minzoom"]
+	_, hasMaxZoom := metadata["maxzoom"]
+	if !(hasMinZoom && hasMaxZoom) {
+		q2, err := con.Prepare("select min(zoom_level), max(zoom_level) from tiles")
+		if err != nil {
+			return nil, nil, err
+		}
+		defer q2.Reset()
+		_, err = q2.Step()
+		if err != nil {
+			return nil, nil, err
+		}
+
+		metadata["minzoom"] = q2.ColumnInt(0)
+		metadata["maxzoom"] = q2.ColumnInt(1)
+	}
+	return metadata, warnings, nil
+}
+
+// RefreshMetadata re-reads the metadata table and updates the timestamp of the
+// mbtiles file from disk, so that edits made to the file after it was opened
+// are picked up.  If the file has been replaced on disk, the timestamp is not
+// updated, so that Reload still replaces the connection pool.  It is safe to
+// call concurrently with reads.
+func (db *MBtiles) RefreshMetadata() (map[string]interface{}, error) {
+	if db == nil {
+		return nil, fmt.Errorf("cannot refresh metadata: %w", ErrDatabaseClosed)
+	}
+
+	db.mu.RLock()
+	filename, file, pool, opts := db.filename, db.file, db.pool, db.opts
+	db.mu.RUnlock()
+	if pool == nil {
+		return nil, fmt.Errorf("cannot refresh metadata: %w", ErrDatabaseClosed)
+	}
+
+	// the modification time is read before the metadata, so that it does not
+	// include edits made after they are read
+	var modTime time.Time
+	var modErr error
+	if file != nil {
+		modTime, modErr = getModTime(filename, opts.IgnoreJournal, opts.WALReadOnly || opts.WAL != nil)
+	}
+
+	db.InvalidateMetadata()
+	metadata, err := db.ReadMetadata()
+	if err != nil {
+		return nil, err
+	}
+
+	// readMetadata sets both, inferring them from tiles if necessary
+	minZoom, minOK := metadata["minzoom"].(int)
+	maxZoom, maxOK := metadata["maxzoom"].(int)
+	if minOK && maxOK {
+		db.setZoomRange(int64(minZoom), int64(maxZoom))
+	}
+
+	// in-memory databases have no file on disk to check
+	if file == nil || modErr != nil {
+		return metadata, nil
+	}
+	if stat, err := os.Stat(filename); err == nil && os.SameFile(file, stat) {
+		db.mu.Lock()
+		// the pool may have been replaced by Rebind in the meantime
+		if db.pool == pool {
+			db.timestamp = modTime
+		}
+		db.mu.Unlock()
+	}
+	return metadata, nil
+}
+
+// GetTileSizeAtZoom detects the tile size from a tile at zoom level z, unlike
+// GetTileSize which is detected from the first tile in the database.  Returns
+// an error if there are no tiles at z.
+func (db *MBtiles) GetTileSizeAtZoom(z int64) (uint32, error) {
+	if db == nil {
+		return 0, fmt.Errorf("cannot read tile: %w", ErrDatabaseClosed)
+	}
+
+	con, err := db.getConnection(context.TODO())
+	defer db.closeConnection(con)
+	if err != nil {
+		return 0, err
+	}
+
+	var tileData []byte
+	err = sqlitex.Exec(con, "select tile_data from tiles where zoom_level = ? limit 1", func(stmt *sqlite.Stmt) error {
+		tileData = make([]byte, stmt.ColumnLen(0))
+		stmt.ColumnBytes(0, tileData)
+		return nil
+	}, z)
+	if err != nil {
+		return 0, err
+	}
+	if tileData == nil {
+		return 0, fmt.Errorf("no tiles at zoom level %d", z)
+	}
+
+	format, err := detectTileFormat(tileData)
+	if err != nil {
+		return 0, err
+	}
+	return detectTileSize(format, tileData)
+}
+
+// DetectMixedTileSizes samples up to sampleCount tiles spread across all zoom
+// levels and returns the distinct tile sizes detected, in ascending order.
+// More than one size indicates that the tileset mixes tile sizes, e.g., from
+// merging 256px and 512px sources.
+func (db *MBtiles) DetectMixedTileSizes(sampleCount int) ([]uint32, error) {
+	sizes := make(map[uint32]bool)
+	err := db.sampleTiles(sampleCount, func(tileData []byte) error {
+		format, err := detectTileFormat(tileData)
+		if err != nil {
+			return err
+		}
+		tilesize, err := detectTileSize(format, tileData)
+		if err != nil {
+			return err
+		}
+		sizes[tilesize] = true
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	out := make([]uint32, 0, len(sizes))
+	for size := range sizes {
+		out = append(out, size)
+	}
+	sort.Slice(out, func(i, j int) bool { return out[i] < out[j] })
+	return out, nil
+}
+
+// FormatDistribution samples up to sampleCount tiles spread across all zoom
+// levels and returns the number of sampled tiles of each detected tile format.
+// Tiles whose format cannot be detected are counted as UNKNOWN.  More than one
+// format indicates that tiles of different formats were merged into one
+// tileset.
+func (db *MBtiles) FormatDistribution(sampleCount int) (map[TileFormat]int, error) {
+	formats := make(map[TileFormat]int)
+	err := db.sampleTiles(sampleCount, func(tileData []byte) error {
+		format, _ := detectTileFormat(tileData)
+		// GZIP masks PBF, which is only expected type for tiles in GZIP format
+		if format == GZIP {
+			format = PBF
+		}
+		formats[format]++
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return formats, nil
+}
+
+// sampleTiles calls fn with the tile data of up to sampleCount tiles spread
+// evenly across all zoom levels, with at least one tile per zoom level.
+func (db *MBtiles) sampleTiles(sampleCount int, fn func(tileData []byte) error) error {
+	if db == nil {
+		return fmt.Errorf("cannot read tile: %w", ErrDatabaseClosed)
+	}
+	if sampleCount < 1 {
+		return errors.New("sampleCount must be at least 1")
+	}
+
+	con, err := db.getConnection(context.TODO())
+	defer db.closeConnection(con)
+	if err != nil {
+		return err
+	}
+
+	var zooms []int64
+	err = sqlitex.Exec(con, "select distinct zoom_level from tiles order by zoom_level", func(stmt *sqlite.Stmt) error {
+		zooms = append(zooms, stmt.ColumnInt64(0))
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+	if len(zooms) == 0 {
+		return nil
+	}
+
+	perZoom := sampleCount / len(zooms)
+	if perZoom < 1 {
+		perZoom = 1
+	}
+
+	for _, z := range zooms {
+		err = sqlitex.Exec(con, "select tile_data from tiles where zoom_level = ? limit ?", func(stmt *sqlite.Stmt) error {
+			var tileData = make([]byte, stmt.ColumnLen(0))
+			stmt.ColumnBytes(0, tileData)
+			return fn(tileData)
+		}, z, perZoom)
 		if err != nil {
-			return nil, err
+			return err
 		}
-		defer q2.Reset()
-		_, err = q2.Step()
-		if err != nil {
-			return nil, err
+	}
+	return nil
+}
+
+// NameAndDescription reads only the name and description from the metadata
+// table.  If name is not present, the base filename without extension is
+// returned instead.  description is empty if not present.
+func (db *MBtiles) NameAndDescription() (string, string, error) {
+	if db == nil {
+		return "", "", fmt.Errorf("cannot read metadata: %w", ErrDatabaseClosed)
+	}
+
+	con, err := db.getConnection(context.TODO())
+	defer db.closeConnection(con)
+	if err != nil {
+		return "", "", err
+	}
+
+	var name, description string
+	err = sqlitex.Exec(con, "select name, value from metadata where name in ('name', 'description')", func(stmt *sqlite.Stmt) error {
+		switch stmt.ColumnText(0) {
+		case "name":
+			name = stmt.ColumnText(1)
+		case "description":
+			description = stmt.ColumnText(1)
 		}
+		return nil
+	})
+	if err != nil {
+		return "", "", err
+	}
 
-		metadata["minzoom"] = q2.ColumnInt(0)
-		metadata["maxzoom"] = q2.ColumnInt(1)
+	if name == "" {
+		filename := db.GetFilename()
+		name = strings.TrimSuffix(filepath.Base(filename), filepath.Ext(filename))
 	}
-	return metadata, nil
+	if db.opts.SanitizeHTML {
+		description = SanitizeHTML(description)
+	}
+	return name, description, nil
+}
+
+// TemplateAndLegend reads only the UTFGrid interactivity template and the
+// legend from the metadata table.  Each is empty if not present.
+func (db *MBtiles) TemplateAndLegend() (string, string, error) {
+	if db == nil {
+		return "", "", fmt.Errorf("cannot read metadata: %w", ErrDatabaseClosed)
+	}
+
+	con, err := db.getConnection(context.TODO())
+	defer db.closeConnection(con)
+	if err != nil {
+		return "", "", err
+	}
+
+	var template, legend string
+	err = sqlitex.Exec(con, "select name, value from metadata where name in ('template', 'legend')", func(stmt *sqlite.Stmt) error {
+		switch stmt.ColumnText(0) {
+		case "template":
+			template = stmt.ColumnText(1)
+		case "legend":
+			legend = stmt.ColumnText(1)
+		}
+		return nil
+	})
+	if err != nil {
+		return "", "", err
+	}
+	if db.opts.SanitizeHTML {
+		legend = SanitizeHTML(legend)
+	}
+	return template, legend, nil
+}
+
+// TileContentEncoding detects the encoding of tiles from the first tile in the
+// database, for use as the Content-Encoding header when serving tiles.  Returns
+// "gzip" for GZIP encoded tiles (e.g., PBF), "deflate" for ZLIB encoded tiles,
+// or "" otherwise.
+func (db *MBtiles) TileContentEncoding() (string, error) {
+	if db == nil {
+		return "", fmt.Errorf("cannot read tile: %w", ErrDatabaseClosed)
+	}
+
+	con, err := db.getConnection(context.TODO())
+	defer db.closeConnection(con)
+	if err != nil {
+		return "", err
+	}
+
+	var format TileFormat
+	err = sqlitex.Exec(con, "select substr(tile_data, 1, 8) from tiles limit 1", func(stmt *sqlite.Stmt) error {
+		magicWord := make([]byte, stmt.ColumnLen(0))
+		stmt.ColumnBytes(0, magicWord)
+		// tiles that cannot be detected are not encoded
+		format, _ = detectTileFormat(magicWord)
+		return nil
+	})
+	if err != nil {
+		return "", err
+	}
+
+	switch format {
+	case GZIP:
+		return "gzip", nil
+	case ZLIB:
+		return "deflate", nil
+	default:
+		return "", nil
+	}
+}
+
+// WithConnection borrows a connection from the pool and calls fn with it, e.g.,
+// to run custom queries against nonstandard tables.  The connection is returned
+// to the pool when fn returns, even if fn returns an error or panics; fn must
+// not retain con.  Waiting for a connection is cancelled if ctx is cancelled.
+func (db *MBtiles) WithConnection(ctx context.Context, fn func(con *sqlite.Conn) error) error {
+	if db == nil {
+		return fmt.Errorf("cannot read: %w", ErrDatabaseClosed)
+	}
+
+	con, err := db.getConnection(ctx)
+	defer db.closeConnection(con)
+	if err != nil {
+		return err
+	}
+
+	return fn(con)
+}
+
+// ConnectionCount returns the number of connections held open by the
+// connection pool.  Each connection to an mbtiles file on disk uses a file
+// descriptor, which is useful for sizing deployments that open many tilesets.
+func (db *MBtiles) ConnectionCount() int {
+	if db == nil {
+		return 0
+	}
+
+	db.mu.RLock()
+	defer db.mu.RUnlock()
+	if db.pool == nil {
+		return 0
+	}
+	if db.opts.PoolSize == 0 {
+		return defaultPoolSize
+	}
+	return db.opts.PoolSize
 }
 
 func (db *MBtiles) GetFilename() string {
+	db.mu.RLock()
+	defer db.mu.RUnlock()
 	return db.filename
 }
 
 // GetTileFormat returns the TileFormat of the mbtiles file.
 func (db *MBtiles) GetTileFormat() TileFormat {
+	db.mu.RLock()
+	defer db.mu.RUnlock()
 	return db.format
 }
 
+// GetScheme returns the scheme used to store tiles in the mbtiles file, "tms"
+// or "xyz", read from the 'scheme' metadata item when it is opened or set using
+// the ForceScheme option.  Defaults to "tms" as required by the mbtiles
+// specification.
+func (db *MBtiles) GetScheme() string {
+	db.mu.RLock()
+	defer db.mu.RUnlock()
+	return db.scheme
+}
+
 // GetTileSize returns the tile size in pixels of the mbtiles file, if detected.
 // Returns 0 if tile size is not detected.
 func (db *MBtiles) GetTileSize() uint32 {
+	db.mu.RLock()
+	defer db.mu.RUnlock()
 	return db.tilesize
 }
 
+// GetMinZoom returns the minimum zoom level of the mbtiles file, read from the
+// 'minzoom' metadata item when it is opened, or otherwise from the tiles.  It
+// is updated when tiles or metadata are written using db, and by
+// RefreshMetadata.
+func (db *MBtiles) GetMinZoom() int64 {
+	db.zoomMu.Lock()
+	defer db.zoomMu.Unlock()
+	return db.minZoom
+}
+
+// GetMaxZoom returns the maximum zoom level of the mbtiles file, read from the
+// 'maxzoom' metadata item when it is opened, or otherwise from the tiles.  It
+// is updated when tiles or metadata are written using db, and by
+// RefreshMetadata.
+func (db *MBtiles) GetMaxZoom() int64 {
+	db.zoomMu.Lock()
+	defer db.zoomMu.Unlock()
+	return db.maxZoom
+}
+
+// setZoomRange updates the minimum and maximum zoom levels returned by
+// GetMinZoom and GetMaxZoom.
+func (db *MBtiles) setZoomRange(minZoom int64, maxZoom int64) {
+	db.zoomMu.Lock()
+	defer db.zoomMu.Unlock()
+	db.minZoom, db.maxZoom = minZoom, maxZoom
+}
+
+// updateZoomRange reads the minimum and maximum zoom levels using con as when
+// the file is opened, and updates those returned by GetMinZoom and GetMaxZoom.
+func (db *MBtiles) updateZoomRange(con *sqlite.Conn) error {
+	minZoom, maxZoom, err := getZoomRange(con)
+	if err != nil {
+		return err
+	}
+	db.setZoomRange(minZoom, maxZoom)
+	return nil
+}
+
+// isDedup returns true if the mbtiles file uses the deduplicated schema.
+func (db *MBtiles) isDedup() bool {
+	db.mu.RLock()
+	defer db.mu.RUnlock()
+	return db.dedup
+}
+
 // Timestamp returns the time stamp of the mbtiles file.
 func (db *MBtiles) GetTimestamp() time.Time {
+	db.mu.RLock()
+	defer db.mu.RUnlock()
 	return db.timestamp
 }
 
 // getConnection gets a sqlite.Conn from an open connection pool.
-// closeConnection(con) must be called to release the connection.
+// closeConnection(con) must be called to release the connection.  If the pool
+// is replaced by Rebind or Close while the connection is in use, it is closed
+// once the connection is released.  If the AutoReload option is set, the file
+// is first reloaded if it has changed on disk.
 func (db *MBtiles) getConnection(ctx context.Context) (*sqlite.Conn, error) {
-	con := db.pool.Get(ctx)
+	db.mu.RLock()
+	autoReload := db.opts.AutoReload && db.pool != nil
+	logger := db.opts.Logger
+	db.mu.RUnlock()
+	if autoReload {
+		if err := db.Reload(); err != nil {
+			return nil, err
+		}
+	}
+
+	pool := db.acquirePool()
+	if pool == nil {
+		return nil, fmt.Errorf("cannot read: %w", ErrDatabaseClosed)
+	}
+
+	start := time.Now()
+	con := pool.Get(ctx)
+	if wait := time.Since(start); logger != nil && wait > poolWaitThreshold {
+		logger("pool_wait", map[string]interface{}{"wait": wait})
+	}
 	if con == nil {
+		db.releasePool(pool)
 		return nil, errors.New("connection could not be opened")
 	}
+
+	db.mu.Lock()
+	if db.checkouts == nil {
+		db.checkouts = make(map[*sqlite.Conn]*sqlitex.Pool)
+	}
+	db.checkouts[con] = pool
+	db.mu.Unlock()
 	return con, nil
 }
 
 // closeConnection closes an open sqlite.Conn and returns it to the pool.
 func (db *MBtiles) closeConnection(con *sqlite.Conn) {
-	if con != nil {
-		db.pool.Put(con)
+	if con == nil {
+		return
+	}
+	db.mu.Lock()
+	pool := db.checkouts[con]
+	delete(db.checkouts, con)
+	db.mu.Unlock()
+
+	pool.Put(con)
+	db.releasePool(pool)
+}
+
+// isCurrent returns true if con was checked out of the open connection pool,
+// which has not been replaced by Rebind or Close.
+func (db *MBtiles) isCurrent(con *sqlite.Conn) bool {
+	db.mu.RLock()
+	defer db.mu.RUnlock()
+	return db.pool != nil && db.checkouts[con] == db.pool
+}
+
+// acquirePool returns the open connection pool, or nil if db is closed, and
+// counts a reference to it so that it is not closed by Rebind or Close until
+// the reference is released using releasePool.
+func (db *MBtiles) acquirePool() *sqlitex.Pool {
+	db.mu.Lock()
+	defer db.mu.Unlock()
+	if db.pool == nil {
+		return nil
+	}
+	if db.refs == nil {
+		db.refs = make(map[*sqlitex.Pool]int)
+	}
+	db.refs[db.pool]++
+	return db.pool
+}
+
+// releasePool releases a reference to pool counted by acquirePool, and closes
+// pool if it has been replaced by Rebind or Close and has no other references.
+func (db *MBtiles) releasePool(pool *sqlitex.Pool) {
+	db.mu.Lock()
+	db.refs[pool]--
+	unused := db.refs[pool] == 0
+	if unused {
+		delete(db.refs, pool)
+	}
+	closePool := unused && pool != db.pool
+	db.mu.Unlock()
+
+	if closePool {
+		pool.Close()
+	}
+}
+
+// isBusy returns true if err is a SQLITE_BUSY or SQLITE_LOCKED error.
+func isBusy(err error) bool {
+	var sqliteErr sqlite.Error
+	if !errors.As(err, &sqliteErr) {
+		return false
+	}
+	// extended error codes share the primary code in their lowest byte
+	code := sqliteErr.Code & 0xff
+	return code == sqlite.SQLITE_BUSY || code == sqlite.SQLITE_LOCKED
+}
+
+// retryBusy calls fn, and retries it up to attempts times if it fails because
+// the database is busy or locked.  The wait before each retry is backoff
+// multiplied by the retry number.  Waiting stops if ctx is cancelled.  If
+// logger is not nil, a "busy_retry" event is logged for each retry.
+func retryBusy(ctx context.Context, attempts int, backoff time.Duration, logger Logger, fn func() error) error {
+	err := fn()
+	for i := 1; i <= attempts && isBusy(err); i++ {
+		if logger != nil {
+			logger("busy_retry", map[string]interface{}{"attempt": i, "error": err})
+		}
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-time.After(backoff * time.Duration(i)):
+		}
+		err = fn()
+	}
+	if isBusy(err) {
+		return fmt.Errorf("database is busy or locked after %d retries: %w", attempts, err)
+	}
+	return err
+}
+
+// tileRow returns the row of tile y at zoom z as stored in the database, or
+// vice versa.  y is flipped if xyz is true and tiles are not stored in XYZ
+// scheme, or if xyz is false, the HonorScheme option is set, and tiles are
+// stored in XYZ scheme.
+func (db *MBtiles) tileRow(z int64, y int64, xyz bool) int64 {
+	if xyz != (db.GetScheme() == "xyz") && (xyz || db.opts.HonorScheme) {
+		return flipY(z, y)
+	}
+	return y
+}
+
+// isXYZ returns true if y passed to tileRow with xyz is in the XYZ scheme:
+// either xyz is true, or y is in the scheme used to store tiles, which is XYZ.
+func (db *MBtiles) isXYZ(xyz bool) bool {
+	return xyz || (!db.opts.HonorScheme && db.GetScheme() == "xyz")
+}
+
+// readTileQuery selects the tile data for a single tile.  Statements prepared
+// using con.Prepare are cached by each connection keyed on their SQL, so a
+// constant query is prepared only once per connection in the pool and reused
+// by all subsequent reads; see BenchmarkReadTile.
+const readTileQuery = "select tile_data from tiles where zoom_level = $z and tile_column = $x and tile_row = $y"
+
+// readTile reads a tile for z, x, y using con into the provided *[]byte.
+// data will be nil if the tile does not exist in the database.
+func readTile(con *sqlite.Conn, z int64, x int64, y int64, data *[]byte) error {
+	query, err := con.Prepare(readTileQuery)
+	if err != nil {
+		return err
+	}
+	defer query.Reset()
+
+	query.SetInt64("$z", z)
+	query.SetInt64("$x", x)
+	query.SetInt64("$y", y)
+
+	hasRow, err := query.Step()
+	if err != nil {
+		return err
+	}
+
+	// If this tile does not exist in the database, return empty bytes
+	if !hasRow {
+		*data = nil
+		return nil
+	}
+
+	var tileData = make([]byte, query.ColumnLen(0))
+	query.ColumnBytes(0, tileData)
+	*data = tileData[:]
+
+	return nil
+}
+
+// appendTile appends the tile data for z, x, y to buf, growing it only if its
+// capacity is insufficient.  found is false if the tile does not exist in the
+// database.
+func appendTile(con *sqlite.Conn, z int64, x int64, y int64, buf []byte) (out []byte, found bool, err error) {
+	query, err := con.Prepare(readTileQuery)
+	if err != nil {
+		return buf, false, err
+	}
+	defer query.Reset()
+
+	query.SetInt64("$z", z)
+	query.SetInt64("$x", x)
+	query.SetInt64("$y", y)
+
+	hasRow, err := query.Step()
+	if err != nil || !hasRow {
+		return buf, false, err
+	}
+
+	n := len(buf)
+	size := query.ColumnLen(0)
+	if cap(buf)-n < size {
+		out = make([]byte, n, n+size)
+		copy(out, buf)
+	} else {
+		out = buf
 	}
+	out = out[:n+size]
+	query.ColumnBytes(0, out[n:])
+	return out, true, nil
 }
 
 // validateRequiredTables checks that both 'tiles' and 'metadata' tables are
-// present in the database
+// present in the database.  'tiles' may be a view, as in the deduplicated
+// schema where tile data are stored in the 'images' table and referenced from
+// the 'map' table.
 func validateRequiredTables(con *sqlite.Conn) error {
 	query, _, err := con.PrepareTransient("SELECT count(*) as c FROM sqlite_master WHERE name in ('tiles', 'metadata')")
 	if err != nil {
@@ -343,11 +2263,92 @@ func validateRequiredTables(con *sqlite.Conn) error {
 	}
 
 	if query.ColumnInt32(0) < 2 {
-		return errors.New("missing one or more required tables: tiles, metadata")
+		// deduplicated files must provide tiles as a view joining map and images
+		isDedup, err := hasDedupSchema(con)
+		if err != nil {
+			return err
+		}
+		if isDedup {
+			return fmt.Errorf("%w: missing one or more required tables: tiles, metadata; deduplicated schema (map, images) must include a 'tiles' view", ErrInvalidTileset)
+		}
+		return fmt.Errorf("%w: missing one or more required tables: tiles, metadata", ErrInvalidTileset)
+	}
+	return nil
+}
+
+// validateTileColumnTypes checks that the zoom_level, tile_column, and tile_row
+// columns of the first tile in the 'tiles' table are stored as integers.
+// Tiles stored with other types (e.g., REAL) would not match integer lookups
+// in ReadTile.
+func validateTileColumnTypes(con *sqlite.Conn) error {
+	query, _, err := con.PrepareTransient("select typeof(zoom_level), typeof(tile_column), typeof(tile_row) from tiles limit 1")
+	if err != nil {
+		return err
+	}
+	defer query.Finalize()
+
+	hasRow, err := query.Step()
+	if err != nil {
+		return err
+	}
+	if !hasRow {
+		// empty tiles table is reported when detecting tile format
+		return nil
+	}
+
+	for i, column := range []string{"zoom_level", "tile_column", "tile_row"} {
+		if colType := query.ColumnText(i); colType != "integer" {
+			return fmt.Errorf("%w: 'tiles' column %s must be stored as integer, found %s", ErrInvalidTileset, column, colType)
+		}
 	}
 	return nil
 }
 
+// getScheme reads the tile scheme from the 'scheme' metadata item, if present.
+// Returns "tms" if not present, per the mbtiles specification.
+func getScheme(con *sqlite.Conn) (string, error) {
+	scheme := "tms"
+	err := sqlitex.ExecTransient(con, "select value from metadata where name = 'scheme'", func(stmt *sqlite.Stmt) error {
+		if value := strings.ToLower(strings.TrimSpace(stmt.ColumnText(0))); value == "xyz" {
+			scheme = value
+		}
+		return nil
+	})
+	if err != nil {
+		return "", err
+	}
+	return scheme, nil
+}
+
+// getZoomRange reads the minimum and maximum zoom levels from the 'minzoom'
+// and 'maxzoom' metadata items.  If either is missing or is not an integer,
+// both are read from the tiles instead, as for readMetadata.
+func getZoomRange(con *sqlite.Conn) (minzoom int64, maxzoom int64, err error) {
+	var hasMin, hasMax bool
+	err = sqlitex.ExecTransient(con, "select name, value from metadata where name in ('minzoom', 'maxzoom')", func(stmt *sqlite.Stmt) error {
+		value, err := strconv.ParseInt(strings.TrimSpace(stmt.ColumnText(1)), 10, 64)
+		if err != nil {
+			return nil
+		}
+		if stmt.ColumnText(0) == "minzoom" {
+			minzoom, hasMin = value, true
+		} else {
+			maxzoom, hasMax = value, true
+		}
+		return nil
+	})
+	if err != nil || (hasMin && hasMax) {
+		return minzoom, maxzoom, err
+	}
+
+	err = sqlitex.ExecTransient(con, "select min(zoom_level), max(zoom_level) from tiles", func(stmt *sqlite.Stmt) error {
+		minzoom = stmt.ColumnInt64(0)
+		maxzoom = stmt.ColumnInt64(1)
+		return nil
+	})
+	return minzoom, maxzoom, err
+}
+
 // getTileFormat reads the first 8 bytes of the first tile in the database.
 // See TileFormat for list of supported tile formats.
 func getTileFormat(con *sqlite.Conn) (TileFormat, error) {
@@ -389,40 +2390,66 @@ func getTileFormat(con *sqlite.Conn) (TileFormat, error) {
 	return format, nil
 }
 
-// getTileFormatAndSize reads the first tile in the database to detect the tile
-// format and if PNG also the size.
+// formatSampleSize is the maximum number of tiles read to detect the tile
+// format and size when opening an mbtiles file.
+const formatSampleSize = 10
+
+// getTileFormatAndSize reads up to formatSampleSize tiles, starting from the
+// lowest zoom level, to detect the tile format and size.  The most common
+// format among tiles that can be detected is used, so that an occasional empty
+// or corrupt tile does not prevent detection; the size is detected from the
+// first tile of that format.
 // See TileFormat for list of supported tile formats.
 func getTileFormatAndSize(con *sqlite.Conn) (TileFormat, uint32, error) {
-	var tilesize uint32 = 0 // not detected for all formats
+	var (
+		tilesize uint32 = 0 // not detected for all formats
+		hasRows  bool
+		counts   = make(map[TileFormat]int)
+		samples  = make(map[TileFormat][]byte)
+	)
 
-	query, _, err := con.PrepareTransient("select tile_data from tiles limit 1")
-	if err != nil {
-		return UNKNOWN, tilesize, err
-	}
-	defer query.Finalize()
+	err := sqlitex.Exec(con, "select tile_data from tiles order by zoom_level limit ?", func(stmt *sqlite.Stmt) error {
+		hasRows = true
 
-	hasRow, err := query.Step()
-	if err != nil {
-		return UNKNOWN, tilesize, err
-	}
-	if !hasRow {
-		return UNKNOWN, tilesize, errors.New("'tiles' table must be non-empty")
-	}
+		var tileData = make([]byte, stmt.ColumnLen(0))
+		stmt.ColumnBytes(0, tileData)
 
-	var tileData = make([]byte, query.ColumnLen(0))
-	query.ColumnBytes(0, tileData)
+		format, err := detectTileFormat(tileData)
+		if err != nil {
+			// skip tiles that cannot be detected
+			return nil
+		}
 
-	format, err := detectTileFormat(tileData)
+		// GZIP masks PBF, which is only expected type for tiles in GZIP format
+		if format == GZIP {
+			format = PBF
+		}
+
+		counts[format]++
+		if _, ok := samples[format]; !ok {
+			samples[format] = tileData
+		}
+		return nil
+	}, formatSampleSize)
 	if err != nil {
 		return UNKNOWN, tilesize, err
 	}
+	if !hasRows {
+		return UNKNOWN, tilesize, fmt.Errorf("%w: 'tiles' table must be non-empty", ErrInvalidTileset)
+	}
+	if len(counts) == 0 {
+		return UNKNOWN, tilesize, fmt.Errorf("%w: could not detect tile format", ErrInvalidTileset)
+	}
 
-	// GZIP masks PBF, which is only expected type for tiles in GZIP format
-	if format == GZIP {
-		format = PBF
+	format := UNKNOWN
+	for f, count := range counts {
+		// break ties consistently using the TileFormat order
+		if count > counts[format] || (count == counts[format] && f < format) {
+			format = f
+		}
 	}
 
-	tilesize, err = detectTileSize(format, tileData)
+	tilesize, err = detectTileSize(format, samples[format])
 	if err != nil {
 		return format, tilesize, err
 	}
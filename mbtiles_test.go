@@ -1,10 +1,20 @@
 package mbtiles
 
 import (
+	"bytes"
+	"context"
+	"errors"
+	"io/fs"
 	"os"
+	"path/filepath"
 	"strings"
+	"sync"
 	"testing"
+	"testing/fstest"
 	"time"
+
+	"crawshaw.io/sqlite"
+	"crawshaw.io/sqlite/sqlitex"
 )
 
 func Test_FindMBtiles(t *testing.T) {
@@ -42,6 +52,58 @@ func Test_FindMBtiles_invalid_dir(t *testing.T) {
 	}
 }
 
+// errFS returns a permission error when opening the directory named bad.
+type errFS struct {
+	fs.FS
+	bad string
+}
+
+func (f errFS) Open(name string) (fs.File, error) {
+	if name == f.bad {
+		return nil, &fs.PathError{Op: "open", Path: name, Err: fs.ErrPermission}
+	}
+	return f.FS.Open(name)
+}
+
+func Test_FindMBtilesFS(t *testing.T) {
+	fsys := errFS{
+		FS: fstest.MapFS{
+			"a.mbtiles":               {},
+			"b/c.mbtiles":             {},
+			"d.mbtiles":               {},
+			"d.mbtiles-journal":       {},
+			"e.txt":                   {},
+			"restricted/f.mbtiles":    {},
+			"restricted/g/h.mbtiles":  {},
+			"subdir/nested/i.mbtiles": {},
+		},
+		bad: "restricted",
+	}
+
+	tests := []struct {
+		opts     []FindOption
+		expected []string
+	}{
+		{expected: []string{"a.mbtiles", "b/c.mbtiles", "subdir/nested/i.mbtiles"}},
+		{opts: []FindOption{WithJournaledFiles()}, expected: []string{"a.mbtiles", "b/c.mbtiles", "d.mbtiles", "subdir/nested/i.mbtiles"}},
+	}
+
+	for _, tc := range tests {
+		filenames, err := FindMBtilesFS(fsys, ".", tc.opts...)
+		if !errors.Is(err, fs.ErrPermission) {
+			t.Error("FindMBtilesFS did not return permission error, got:", err)
+		}
+		if strings.Join(filenames, ",") != strings.Join(tc.expected, ",") {
+			t.Error("Found files", filenames, "do not match expected value", tc.expected)
+		}
+	}
+
+	_, err := FindMBtilesFS(fsys, "missing")
+	if err == nil {
+		t.Error("FindMBtilesFS did not fail for missing root")
+	}
+}
+
 func Test_OpenMBtiles(t *testing.T) {
 	tests := []struct {
 		path     string
@@ -60,6 +122,7 @@ func Test_OpenMBtiles(t *testing.T) {
 			t.Error("Could not open:", tc.path)
 			continue
 		}
+		defer db.Close()
 
 		if db.GetTileFormat() != tc.format {
 			t.Error("Tile format", db.GetTileFormat(), "does not match expected value", tc.format, "for:", tc.path)
@@ -91,6 +154,7 @@ func Test_OpenInMemoryMBtiles(t *testing.T) {
 			t.Error("Could not open:", tc.path)
 			continue
 		}
+		defer db.Close()
 
 		if db.GetTileFormat() != tc.format {
 			t.Error("Tile format", db.GetTileFormat(), "does not match expected value", tc.format, "for:", tc.path)
@@ -130,6 +194,37 @@ func Test_OpenMBtiles_invalid(t *testing.T) {
 	}
 }
 
+func Test_OpenInMemoryWithProgress(t *testing.T) {
+	var steps, total int
+	remaining := -1
+	db, err := OpenInMemoryWithProgress(context.Background(), "./testdata/world_cities.mbtiles", 2, func(r, n int) {
+		steps++
+		remaining, total = r, n
+	})
+	if err != nil {
+		t.Fatal("Could not open mbtiles:", err)
+	}
+	defer db.Close()
+
+	// 2 pages are copied in each step
+	if steps != (total+1)/2 || remaining != 0 || total == 0 {
+		t.Error("Progress was not reported for each step, got steps:", steps, "remaining:", remaining, "total:", total)
+	}
+
+	var data []byte
+	if err := db.ReadTile(0, 0, 0, &data); err != nil || len(data) == 0 {
+		t.Error("Could not read tile from in-memory database:", err)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	_, err = OpenInMemoryWithProgress(ctx, "./testdata/world_cities.mbtiles", 1, func(r, n int) {
+		cancel()
+	})
+	if !errors.Is(err, context.Canceled) {
+		t.Error("OpenInMemoryWithProgress did not return context.Canceled, got:", err)
+	}
+}
+
 func Test_OpenInMemoryMBtiles_invalid(t *testing.T) {
 	tests := []struct {
 		path string
@@ -185,6 +280,7 @@ func Test_ReadMetadata(t *testing.T) {
 			t.Error("Could not open:", tc.path)
 			continue
 		}
+		defer db.Close()
 		metadata, err := db.ReadMetadata()
 
 		if err != nil {
@@ -212,6 +308,7 @@ func Test_ReadMetadata(t *testing.T) {
 
 func Test_ReadMetadata_contents(t *testing.T) {
 	db, _ := Open("./testdata/geography-class-png.mbtiles")
+	defer db.Close()
 
 	expectedMetadata := map[string]interface{}{
 		"name":        "Geography Class",
@@ -248,6 +345,105 @@ func Test_ReadMetadata_contents(t *testing.T) {
 	}
 }
 
+func Test_ReadMetadata_boundsCenter(t *testing.T) {
+	tests := []struct {
+		bounds string
+		center string
+		err    string
+	}{
+		{bounds: "-180, -85.0511 , 180,85.0511", center: " 0,20 , 2"},
+		{bounds: "-180,-85.0511,180", center: "0,20,2", err: "bounds: expected 4 values"},
+		{bounds: "-180,-85.0511,180,85.0511,0", center: "0,20,2", err: "bounds: expected 4 values"},
+		{bounds: "-180,-85.0511,180,85.0511", center: "0,20", err: "center: expected 3 values"},
+		{bounds: "-180,-85.0511,180,85.0511", center: "0,20,2,0", err: "center: expected 3 values"},
+	}
+
+	for _, tc := range tests {
+		path := createTestMBtiles(t, `
+			INSERT INTO metadata VALUES ('bounds', '`+tc.bounds+`'), ('center', '`+tc.center+`');
+			CREATE TABLE tiles (zoom_level integer, tile_column integer, tile_row integer, tile_data blob);
+			INSERT INTO tiles VALUES (0, 0, 0, x'1f8b0800000000000000');
+		`)
+		db, err := Open(path)
+		if err != nil {
+			t.Fatal("Could not open:", path, err)
+		}
+		defer db.Close()
+
+		metadata, err := db.ReadMetadata()
+		if tc.err != "" {
+			if err == nil || !strings.Contains(err.Error(), tc.err) {
+				t.Error("ReadMetadata did not raise expected error for:", tc.bounds, tc.center, "got:", err)
+			}
+			continue
+		}
+		if err != nil {
+			t.Error("Unexpected error reading metadata for:", tc.bounds, tc.center, err)
+			continue
+		}
+
+		bounds := metadata["bounds"].([]float64)
+		if len(bounds) != 4 || bounds[1] != -85.0511 || bounds[3] != 85.0511 {
+			t.Error("Bounds", bounds, "do not match expected value for:", tc.bounds)
+		}
+		center := metadata["center"].([]float64)
+		if len(center) != 3 || center[0] != 0 || center[1] != 20 || center[2] != 2 {
+			t.Error("Center", center, "does not match expected value for:", tc.center)
+		}
+	}
+}
+
+func Test_ReadMetadata_json(t *testing.T) {
+	// json is inserted after name, so that it is read last
+	path := createTestMBtiles(t, `
+		INSERT INTO metadata VALUES ('json', '{"name": "from json", "vector_layers": [{"id": "cities", "fields": {"name": "String"}}], "tilestats": {"layerCount": 1}}');
+		CREATE TABLE tiles (zoom_level integer, tile_column integer, tile_row integer, tile_data blob);
+		INSERT INTO tiles VALUES (0, 0, 0, x'1f8b0800000000000000');
+	`)
+
+	db, err := Open(path)
+	if err != nil {
+		t.Fatal("Could not open:", path, err)
+	}
+	defer db.Close()
+
+	metadata, err := db.ReadMetadata()
+	if err != nil {
+		t.Fatal("Unexpected error reading metadata:", err)
+	}
+	if metadata["name"] != "test" {
+		t.Error("Explicit name was overwritten by json, got:", metadata["name"])
+	}
+	layers, ok := metadata["vector_layers"].([]interface{})
+	if !ok || len(layers) != 1 {
+		t.Fatal("vector_layers was not preserved, got:", metadata["vector_layers"])
+	}
+	if layer, ok := layers[0].(map[string]interface{}); !ok || layer["id"] != "cities" {
+		t.Error("vector_layers does not match expected value, got:", layers[0])
+	}
+	if tilestats, ok := metadata["tilestats"].(map[string]interface{}); !ok || tilestats["layerCount"] != float64(1) {
+		t.Error("tilestats was not preserved, got:", metadata["tilestats"])
+	}
+	if _, ok := metadata["json"]; ok {
+		t.Error("json item should not be present in metadata")
+	}
+	raw := `{"name": "from json", "vector_layers": [{"id": "cities", "fields": {"name": "String"}}], "tilestats": {"layerCount": 1}}`
+	if metadata["json_raw"] != raw {
+		t.Error("json_raw does not match original json item, got:", metadata["json_raw"])
+	}
+
+	typed, err := db.GetMetadata()
+	if err != nil {
+		t.Fatal("Unexpected error reading metadata:", err)
+	}
+	if typed.RawJSON != raw {
+		t.Error("RawJSON does not match original json item, got:", typed.RawJSON)
+	}
+	if _, ok := typed.JSON["json_raw"]; ok {
+		t.Error("json_raw should not be present in JSON")
+	}
+}
+
 func Test_ReadTile(t *testing.T) {
 	tests := []struct {
 		z     int64
@@ -262,6 +458,7 @@ func Test_ReadTile(t *testing.T) {
 	}
 
 	db, _ := Open("./testdata/geography-class-png.mbtiles")
+	defer db.Close()
 
 	for _, tc := range tests {
 		var data []byte
@@ -299,3 +496,2028 @@ func Test_GetTimestamp(t *testing.T) {
 		t.Error("Timestamp does not match value from os.Stat, got:", db.GetTimestamp())
 	}
 }
+
+func Test_RefreshMetadata(t *testing.T) {
+	filename := "./testdata/geography-class-png.mbtiles"
+	stat, _ := os.Stat(filename)
+	expected := stat.ModTime().Round(time.Second)
+
+	db, _ := Open(filename)
+	defer db.Close()
+
+	metadata, err := db.RefreshMetadata()
+	if err != nil {
+		t.Error("Error raised when refreshing metadata:", err)
+	}
+	if metadata["name"] != "Geography Class" {
+		t.Error("RefreshMetadata did not return expected name, got:", metadata["name"])
+	}
+	if db.GetTimestamp() != expected {
+		t.Error("Timestamp does not match value from os.Stat, got:", db.GetTimestamp())
+	}
+}
+
+func Test_RefreshMetadata_edited(t *testing.T) {
+	path := createTestMBtiles(t, `
+		CREATE TABLE tiles (zoom_level integer, tile_column integer, tile_row integer, tile_data blob);
+		INSERT INTO tiles VALUES (0, 0, 0, x'89504e470d0a1a0a0000000d4948445200000100');
+	`)
+
+	db, err := Open(path)
+	if err != nil {
+		t.Fatal("Could not open:", path, err)
+	}
+	defer db.Close()
+	if _, err := db.ReadMetadata(); err != nil {
+		t.Fatal("Unexpected error reading metadata:", err)
+	}
+
+	// edit the file in place using another connection
+	con, err := sqlite.OpenConn(path, sqlite.SQLITE_OPEN_READWRITE)
+	if err != nil {
+		t.Fatal("Could not open connection:", err)
+	}
+	defer con.Close()
+	err = sqlitex.ExecScript(con, `
+		UPDATE metadata SET value = 'edited' WHERE name = 'name';
+		INSERT INTO metadata (name, value) VALUES ('minzoom', '1'), ('maxzoom', '4');
+	`)
+	if err != nil {
+		t.Fatal("Could not update metadata:", err)
+	}
+
+	metadata, err := db.RefreshMetadata()
+	if err != nil {
+		t.Fatal("Error raised when refreshing metadata:", err)
+	}
+	if metadata["name"] != "edited" {
+		t.Error("RefreshMetadata did not return edited name, got:", metadata["name"])
+	}
+	if db.GetMinZoom() != 1 || db.GetMaxZoom() != 4 {
+		t.Error("Zoom range", db.GetMinZoom(), db.GetMaxZoom(), "was not refreshed from edited metadata")
+	}
+
+	db.Close()
+	if _, err := db.RefreshMetadata(); !errors.Is(err, ErrDatabaseClosed) {
+		t.Error("RefreshMetadata did not return ErrDatabaseClosed for closed database, got:", err)
+	}
+	var nilDB *MBtiles
+	if _, err := nilDB.RefreshMetadata(); !errors.Is(err, ErrDatabaseClosed) {
+		t.Error("RefreshMetadata did not return ErrDatabaseClosed for nil database, got:", err)
+	}
+}
+
+func Test_RefreshMetadata_replaced(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "test.mbtiles")
+	modTime := time.Now().Add(-time.Hour).Round(time.Second)
+	replaceTestFile(t, "./testdata/geography-class-png.mbtiles", path, modTime)
+
+	db, err := Open(path)
+	if err != nil {
+		t.Fatal("Could not open mbtiles:", err)
+	}
+	defer db.Close()
+
+	// timestamp is not updated from a file that replaced the open file
+	replaceTestFile(t, "./testdata/geography-class-jpg.mbtiles", path, modTime.Add(time.Minute))
+	if _, err := db.RefreshMetadata(); err != nil {
+		t.Fatal("Error raised when refreshing metadata:", err)
+	}
+	if !db.GetTimestamp().Equal(modTime) {
+		t.Error("Timestamp", db.GetTimestamp(), "was updated from replaced file")
+	}
+	if err := db.Reload(); err != nil {
+		t.Fatal("Unexpected error reloading:", err)
+	}
+	if db.GetTileFormat() != JPG {
+		t.Error("Tile format", db.GetTileFormat(), "does not match expected value", JPG)
+	}
+}
+
+// createTestMBtiles creates a minimal mbtiles file in a temporary directory
+// with a metadata table, and a tiles table created and populated by the
+// provided SQL statements, and returns its path.
+func createTestMBtiles(t *testing.T, tiles string) string {
+	t.Helper()
+
+	path := filepath.Join(t.TempDir(), "test.mbtiles")
+	con, err := sqlite.OpenConn(path, sqlite.SQLITE_OPEN_CREATE|sqlite.SQLITE_OPEN_READWRITE)
+	if err != nil {
+		t.Fatal("Could not create test mbtiles:", err)
+	}
+	defer con.Close()
+
+	err = sqlitex.ExecScript(con, `
+		CREATE TABLE metadata (name text, value text);
+		INSERT INTO metadata (name, value) VALUES ('name', 'test');
+	`+tiles)
+	if err != nil {
+		t.Fatal("Could not create test mbtiles:", err)
+	}
+	return path
+}
+
+func Test_ReadTile_high_zoom(t *testing.T) {
+	// first 20 bytes of tile 0/0/0 in geography-class-png.mbtiles
+	path := createTestMBtiles(t, `
+		CREATE TABLE tiles (zoom_level integer, tile_column integer, tile_row integer, tile_data blob);
+		INSERT INTO tiles VALUES (22, 4194303, 4194303, x'89504e470d0a1a0a0000000d4948445200000100');
+	`)
+
+	db, err := Open(path)
+	if err != nil {
+		t.Fatal("Could not open:", path, err)
+	}
+	defer db.Close()
+
+	var data []byte
+	err = db.ReadTile(22, 4194303, 4194303, &data)
+	if err != nil {
+		t.Error("Unexpected error reading tile:", err)
+	}
+	if len(data) != 20 {
+		t.Error("ReadTile returned different number of bytes than expected, got:", len(data))
+	}
+}
+
+func Test_OpenMBtiles_invalid_column_types(t *testing.T) {
+	path := createTestMBtiles(t, `
+		CREATE TABLE tiles (zoom_level real, tile_column real, tile_row real, tile_data blob);
+		INSERT INTO tiles VALUES (20.0, 1.0, 1.0, x'89504e470d0a1a0a0000000d4948445200000100');
+	`)
+
+	db, err := Open(path)
+	if err == nil {
+		db.Close()
+		t.Fatal("mbtiles with REAL tile coordinates did not raise error on open")
+	}
+	if !strings.Contains(err.Error(), "must be stored as integer") {
+		t.Error("mbtiles with REAL tile coordinates did not raise expected error, instead raised:", err)
+	}
+}
+
+func Test_DetectMixedTileSizes(t *testing.T) {
+	tests := []struct {
+		path     string
+		tilesize uint32
+	}{
+		{path: "geography-class-jpg.mbtiles", tilesize: 256},
+		{path: "geography-class-png.mbtiles", tilesize: 256},
+		{path: "world_cities.mbtiles", tilesize: 512},
+	}
+
+	for _, tc := range tests {
+		db, err := Open("./testdata/" + tc.path)
+		if err != nil {
+			t.Error("Could not open:", tc.path)
+			continue
+		}
+		defer db.Close()
+
+		sizes, err := db.DetectMixedTileSizes(10)
+		if err != nil {
+			t.Error("Unexpected error detecting tile sizes for:", tc.path, err)
+			continue
+		}
+		if len(sizes) != 1 || sizes[0] != tc.tilesize {
+			t.Error("Tile sizes", sizes, "do not match expected value", tc.tilesize, "for:", tc.path)
+		}
+	}
+}
+
+func Test_DetectMixedTileSizes_mixed(t *testing.T) {
+	// PNG headers with widths of 256 and 512
+	path := createTestMBtiles(t, `
+		CREATE TABLE tiles (zoom_level integer, tile_column integer, tile_row integer, tile_data blob);
+		INSERT INTO tiles VALUES (0, 0, 0, x'89504e470d0a1a0a0000000d4948445200000100');
+		INSERT INTO tiles VALUES (1, 0, 0, x'89504e470d0a1a0a0000000d4948445200000200');
+	`)
+
+	db, err := Open(path)
+	if err != nil {
+		t.Fatal("Could not open:", path, err)
+	}
+	defer db.Close()
+
+	sizes, err := db.DetectMixedTileSizes(2)
+	if err != nil {
+		t.Fatal("Unexpected error detecting tile sizes:", err)
+	}
+	if len(sizes) != 2 || sizes[0] != 256 || sizes[1] != 512 {
+		t.Error("Tile sizes do not match expected values, got:", sizes)
+	}
+}
+
+func Test_ReadTileFull(t *testing.T) {
+	tests := []struct {
+		path     string
+		format   TileFormat
+		tilesize uint32
+	}{
+		{path: "geography-class-jpg.mbtiles", format: JPG, tilesize: 256},
+		{path: "geography-class-png.mbtiles", format: PNG, tilesize: 256},
+		{path: "world_cities.mbtiles", format: PBF, tilesize: 512},
+	}
+
+	for _, tc := range tests {
+		db, err := Open("./testdata/" + tc.path)
+		if err != nil {
+			t.Error("Could not open:", tc.path)
+			continue
+		}
+		defer db.Close()
+
+		data, format, tilesize, err := db.ReadTileFull(0, 0, 0)
+		if err != nil {
+			t.Error("Unexpected error reading tile for:", tc.path, err)
+			continue
+		}
+		if len(data) == 0 {
+			t.Error("ReadTileFull returned no data for:", tc.path)
+		}
+		if format != tc.format {
+			t.Error("Tile format", format, "does not match expected value", tc.format, "for:", tc.path)
+		}
+		if tilesize != tc.tilesize {
+			t.Error("Tile size", tilesize, "does not match expected value", tc.tilesize, "for:", tc.path)
+		}
+
+		// nonexistent tile
+		data, format, tilesize, err = db.ReadTileFull(10, 0, 0)
+		if err != nil || data != nil || format != UNKNOWN || tilesize != 0 {
+			t.Error("ReadTileFull returned unexpected values for nonexistent tile for:", tc.path)
+		}
+	}
+}
+
+func Test_ReadTileFull_options(t *testing.T) {
+	var events []string
+	db, err := Open("./testdata/geography-class-png.mbtiles", WithStrictCoordinates(), WithTileNotFoundError(),
+		WithLogger(func(event string, fields map[string]interface{}) {
+			events = append(events, event)
+		}))
+	if err != nil {
+		t.Fatal("Could not open mbtiles:", err)
+	}
+	defer db.Close()
+
+	if _, _, _, err = db.ReadTileFull(1, 2, 0); err == nil {
+		t.Error("ReadTileFull did not raise error for invalid coordinates")
+	}
+	data, format, _, err := db.ReadTileFull(0, 0, 0)
+	if err != nil || data == nil || format != PNG {
+		t.Error("ReadTileFull returned unexpected values for existing tile:", format, err)
+	}
+	if _, _, _, err = db.ReadTileFull(10, 0, 0); !errors.Is(err, ErrTileNotFound) {
+		t.Error("ReadTileFull did not return ErrTileNotFound for nonexistent tile, got:", err)
+	}
+	if len(events) != 1 || events[0] != "tile_not_found" {
+		t.Error("ReadTileFull did not log tile_not_found event, got:", events)
+	}
+}
+
+func Test_OpenWithOptions_IgnoreJournal(t *testing.T) {
+	// copy a valid mbtiles file alongside a stale -journal file
+	data, err := os.ReadFile("./testdata/geography-class-png.mbtiles")
+	if err != nil {
+		t.Fatal("Could not read mbtiles:", err)
+	}
+	path := filepath.Join(t.TempDir(), "stale.mbtiles")
+	if err := os.WriteFile(path, data, 0644); err != nil {
+		t.Fatal("Could not write mbtiles:", err)
+	}
+	if err := os.WriteFile(path+"-journal", nil, 0644); err != nil {
+		t.Fatal("Could not write -journal:", err)
+	}
+
+	db, err := OpenWithOptions(path, Options{})
+	if err == nil {
+		db.Close()
+		t.Error("mbtiles with -journal file did not raise error on open without IgnoreJournal")
+	}
+
+	db, err = OpenWithOptions(path, Options{IgnoreJournal: true})
+	if err != nil {
+		t.Fatal("IgnoreJournal did not allow opening mbtiles with -journal file:", err)
+	}
+	db.Close()
+}
+
+func Test_WithWALReadOnly(t *testing.T) {
+	path := createTestMBtiles(t, `
+		CREATE TABLE tiles (zoom_level integer, tile_column integer, tile_row integer, tile_data blob);
+		INSERT INTO tiles VALUES (0, 0, 0, x'1f8b0800000000000000');
+	`)
+
+	// writer keeps the database open in WAL mode, so the -wal file is present
+	writer, err := sqlite.OpenConn(path, sqlite.SQLITE_OPEN_READWRITE)
+	if err != nil {
+		t.Fatal("Could not open writer:", err)
+	}
+	defer writer.Close()
+	for _, query := range []string{
+		"PRAGMA journal_mode = WAL",
+		"PRAGMA wal_autocheckpoint = 0",
+		"INSERT INTO tiles VALUES (1, 0, 0, x'1f8b0800000000000001')",
+	} {
+		if err := sqlitex.ExecTransient(writer, query, nil); err != nil {
+			t.Fatal("Could not write in WAL mode:", err)
+		}
+	}
+	if _, err := os.Stat(path + "-wal"); err != nil {
+		t.Fatal("-wal file was not created:", err)
+	}
+
+	_, err = Open(path)
+	if err == nil || !strings.Contains(err.Error(), "-wal file") {
+		t.Error("mbtiles with -wal file did not raise expected error on open, got:", err)
+	}
+
+	db, err := Open(path, WithWALReadOnly())
+	if err != nil {
+		t.Fatal("WithWALReadOnly did not allow opening mbtiles with -wal file:", err)
+	}
+	defer db.Close()
+
+	// tile committed to the WAL but not checkpointed is visible
+	var data []byte
+	if err := db.ReadTile(1, 0, 0, &data); err != nil || len(data) != 10 {
+		t.Error("Could not read tile from WAL:", err)
+	}
+
+	err = db.WithConnection(context.Background(), func(con *sqlite.Conn) error {
+		return sqlitex.Exec(con, "DELETE FROM tiles", nil)
+	})
+	if err == nil {
+		t.Error("WALReadOnly connection allowed modifying the database")
+	}
+}
+
+func Test_FormatDistribution(t *testing.T) {
+	db, err := Open("./testdata/world_cities.mbtiles")
+	if err != nil {
+		t.Fatal("Could not open mbtiles:", err)
+	}
+	defer db.Close()
+
+	formats, err := db.FormatDistribution(10)
+	if err != nil {
+		t.Fatal("Unexpected error detecting tile formats:", err)
+	}
+	if len(formats) != 1 || formats[PBF] == 0 {
+		t.Error("Tile formats do not match expected values, got:", formats)
+	}
+}
+
+func Test_FormatDistribution_mixed(t *testing.T) {
+	path := createTestMBtiles(t, `
+		CREATE TABLE tiles (zoom_level integer, tile_column integer, tile_row integer, tile_data blob);
+		INSERT INTO tiles VALUES (0, 0, 0, x'89504e470d0a1a0a0000000d4948445200000100');
+		INSERT INTO tiles VALUES (1, 0, 0, x'89504e470d0a1a0a0000000d4948445200000100');
+		INSERT INTO tiles VALUES (1, 1, 0, x'ffd8ffe000104a46494600010100000100010000');
+		INSERT INTO tiles VALUES (1, 1, 1, x'0000000000000000');
+	`)
+
+	db, err := Open(path)
+	if err != nil {
+		t.Fatal("Could not open:", path, err)
+	}
+	defer db.Close()
+
+	formats, err := db.FormatDistribution(10)
+	if err != nil {
+		t.Fatal("Unexpected error detecting tile formats:", err)
+	}
+	if formats[PNG] != 2 || formats[JPG] != 1 || formats[UNKNOWN] != 1 {
+		t.Error("Tile formats do not match expected values, got:", formats)
+	}
+}
+
+func Test_ReadTile_AutoDecompress(t *testing.T) {
+	db, err := OpenWithOptions("./testdata/world_cities.mbtiles", Options{AutoDecompress: true})
+	if err != nil {
+		t.Fatal("Could not open mbtiles:", err)
+	}
+	defer db.Close()
+
+	var data []byte
+	err = db.ReadTile(0, 0, 0, &data)
+	if err != nil {
+		t.Fatal("Unexpected error reading tile:", err)
+	}
+	if len(data) == 0 {
+		t.Fatal("ReadTile returned no data")
+	}
+	if format, _ := detectTileFormat(data); format == GZIP {
+		t.Error("ReadTile did not decompress tile")
+	}
+
+	_, format, _, err := db.ReadTileFull(0, 0, 0)
+	if err != nil {
+		t.Error("Unexpected error reading tile:", err)
+	}
+	if format != PBF {
+		t.Error("Tile format", format, "does not match expected value", PBF)
+	}
+}
+
+func Test_NameAndDescription(t *testing.T) {
+	db, err := Open("./testdata/geography-class-png.mbtiles")
+	if err != nil {
+		t.Fatal("Could not open mbtiles:", err)
+	}
+	defer db.Close()
+
+	name, description, err := db.NameAndDescription()
+	if err != nil {
+		t.Fatal("Unexpected error reading name and description:", err)
+	}
+	if name != "Geography Class" {
+		t.Error("Name does not match expected value, got:", name)
+	}
+	if !strings.HasPrefix(description, "One of the example maps") {
+		t.Error("Description does not match expected value, got:", description)
+	}
+}
+
+func Test_TemplateAndLegend(t *testing.T) {
+	db, err := Open("./testdata/geography-class-png.mbtiles")
+	if err != nil {
+		t.Fatal("Could not open mbtiles:", err)
+	}
+	defer db.Close()
+
+	template, legend, err := db.TemplateAndLegend()
+	if err != nil {
+		t.Fatal("Unexpected error reading template and legend:", err)
+	}
+	if len(template) != 315 || !strings.Contains(template, "{{") {
+		t.Error("Template does not match expected value, got:", template)
+	}
+	if len(legend) != 12047 {
+		t.Error("Legend does not match expected length, got:", len(legend))
+	}
+
+	metadata, err := db.GetMetadata()
+	if err != nil {
+		t.Fatal("Unexpected error reading metadata:", err)
+	}
+	if metadata.Template != template || metadata.Legend != legend {
+		t.Error("Metadata template and legend do not match TemplateAndLegend")
+	}
+}
+
+func Test_NameAndDescription_missing(t *testing.T) {
+	path := createTestMBtiles(t, `
+		CREATE TABLE tiles (zoom_level integer, tile_column integer, tile_row integer, tile_data blob);
+		INSERT INTO tiles VALUES (0, 0, 0, x'89504e470d0a1a0a0000000d4948445200000100');
+		DELETE FROM metadata WHERE name = 'name';
+	`)
+
+	db, err := Open(path)
+	if err != nil {
+		t.Fatal("Could not open:", path, err)
+	}
+	defer db.Close()
+
+	name, description, err := db.NameAndDescription()
+	if err != nil {
+		t.Fatal("Unexpected error reading name and description:", err)
+	}
+	if name != "test" {
+		t.Error("Name does not fall back to filename, got:", name)
+	}
+	if description != "" {
+		t.Error("Description is not empty, got:", description)
+	}
+}
+
+func Test_ConnectionCount(t *testing.T) {
+	db, err := Open("./testdata/geography-class-png.mbtiles")
+	if err != nil {
+		t.Fatal("Could not open mbtiles:", err)
+	}
+	defer db.Close()
+
+	if db.ConnectionCount() != 10 {
+		t.Error("ConnectionCount does not match expected value, got:", db.ConnectionCount())
+	}
+
+	fakeDB := &MBtiles{}
+	if fakeDB.ConnectionCount() != 0 {
+		t.Error("ConnectionCount of unopened handle is not 0, got:", fakeDB.ConnectionCount())
+	}
+}
+
+func Test_ReadTileXYZ(t *testing.T) {
+	// xyz 1/0/0 is tms 1/0/1
+	path := createTestMBtiles(t, `
+		CREATE TABLE tiles (zoom_level integer, tile_column integer, tile_row integer, tile_data blob);
+		INSERT INTO tiles VALUES (1, 0, 1, x'89504e470d0a1a0a0000000d4948445200000100');
+	`)
+
+	tests := []struct {
+		scheme string
+		y      int64
+	}{
+		{scheme: "", y: 0},
+		{scheme: "tms", y: 0},
+		// stored tiles are known to be in XYZ scheme, so don't flip
+		{scheme: "xyz", y: 1},
+	}
+
+	for _, tc := range tests {
+		db, err := OpenWithOptions(path, Options{ForceScheme: tc.scheme})
+		if err != nil {
+			t.Fatal("Could not open:", path, err)
+		}
+		defer db.Close()
+
+		var data []byte
+		err = db.ReadTileXYZ(1, 0, tc.y, &data)
+		if err != nil {
+			t.Error("Unexpected error reading tile:", err)
+		}
+		if len(data) != 20 {
+			t.Error("ReadTileXYZ did not return expected tile for scheme:", tc.scheme)
+		}
+	}
+
+	_, err := OpenWithOptions(path, Options{ForceScheme: "other"})
+	if err == nil {
+		t.Error("Invalid ForceScheme did not raise error on open")
+	}
+}
+
+func Test_ReadTileXYZ_scheme_metadata(t *testing.T) {
+	path := createTestMBtiles(t, `
+		CREATE TABLE tiles (zoom_level integer, tile_column integer, tile_row integer, tile_data blob);
+		INSERT INTO tiles VALUES (1, 0, 0, x'89504e470d0a1a0a0000000d4948445200000100');
+		INSERT INTO metadata (name, value) VALUES ('scheme', 'xyz');
+	`)
+
+	db, err := Open(path)
+	if err != nil {
+		t.Fatal("Could not open:", path, err)
+	}
+	defer db.Close()
+
+	var data []byte
+	err = db.ReadTileXYZ(1, 0, 0, &data)
+	if err != nil {
+		t.Error("Unexpected error reading tile:", err)
+	}
+	if len(data) != 20 {
+		t.Error("ReadTileXYZ flipped tile stored in xyz scheme")
+	}
+
+	// ForceScheme overrides metadata
+	db2, err := OpenWithOptions(path, Options{ForceScheme: "tms"})
+	if err != nil {
+		t.Fatal("Could not open:", path, err)
+	}
+	defer db2.Close()
+
+	err = db2.ReadTileXYZ(1, 0, 1, &data)
+	if err != nil {
+		t.Error("Unexpected error reading tile:", err)
+	}
+	if len(data) != 20 {
+		t.Error("ReadTileXYZ did not flip tile with ForceScheme tms")
+	}
+}
+
+func Test_ReadTileWithNeighbors(t *testing.T) {
+	db, err := Open("./testdata/geography-class-png.mbtiles")
+	if err != nil {
+		t.Fatal("Could not open mbtiles:", err)
+	}
+	defer db.Close()
+
+	center, neighbors, err := db.ReadTileWithNeighbors(1, 0, 0)
+	if err != nil {
+		t.Fatal("Unexpected error reading tile with neighbors:", err)
+	}
+	if len(center) != 13843 {
+		t.Error("Center tile has different number of bytes than expected, got:", len(center))
+	}
+	// zoom 1 has 4 tiles, so there are only 3 neighbors
+	if len(neighbors) != 3 {
+		t.Error("Did not return expected number of neighbors, got:", len(neighbors))
+	}
+	for _, key := range [][2]int64{{0, 1}, {1, 0}, {1, 1}} {
+		if len(neighbors[key]) == 0 {
+			t.Error("Missing expected neighbor:", key)
+		}
+	}
+
+	// nonexistent tile
+	center, neighbors, err = db.ReadTileWithNeighbors(10, 0, 0)
+	if err != nil || center != nil || len(neighbors) != 0 {
+		t.Error("ReadTileWithNeighbors returned unexpected values for nonexistent tile")
+	}
+
+	// y and neighbor keys are flipped with the XYZ option; xyz 1/0/1 is tms 1/0/0
+	var tmsNeighbor []byte
+	if err := db.ReadTile(1, 0, 1, &tmsNeighbor); err != nil {
+		t.Fatal("Could not read tile:", err)
+	}
+	xyzDB, err := Open("./testdata/geography-class-png.mbtiles", WithXYZ(), WithStrictCoordinates())
+	if err != nil {
+		t.Fatal("Could not open mbtiles:", err)
+	}
+	defer xyzDB.Close()
+	center, neighbors, err = xyzDB.ReadTileWithNeighbors(1, 0, 1)
+	if err != nil {
+		t.Fatal("Unexpected error reading tile with neighbors:", err)
+	}
+	if len(center) != 13843 {
+		t.Error("Center tile has different number of bytes than expected, got:", len(center))
+	}
+	if !bytes.Equal(neighbors[[2]int64{0, 0}], tmsNeighbor) {
+		t.Error("XYZ neighbor 0, 0 does not match TMS tile 1/0/1")
+	}
+	if _, _, err := xyzDB.ReadTileWithNeighbors(1, 0, 2); err == nil {
+		t.Error("ReadTileWithNeighbors did not raise error for invalid coordinates")
+	}
+}
+
+func Test_Rebind(t *testing.T) {
+	db, err := Open("./testdata/geography-class-png.mbtiles")
+	if err != nil {
+		t.Fatal("Could not open mbtiles:", err)
+	}
+	defer db.Close()
+
+	// reads run concurrently with Rebind
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		var data []byte
+		for i := 0; i < 100; i++ {
+			if err := db.ReadTile(0, 0, 0, &data); err != nil {
+				t.Error("Unexpected error reading tile during Rebind:", err)
+				return
+			}
+		}
+	}()
+
+	err = db.Rebind("./testdata/world_cities.mbtiles")
+	<-done
+	if err != nil {
+		t.Fatal("Unexpected error rebinding:", err)
+	}
+
+	if db.GetTileFormat() != PBF {
+		t.Error("Tile format", db.GetTileFormat(), "does not match expected value", PBF)
+	}
+	if db.GetFilename() != "./testdata/world_cities.mbtiles" {
+		t.Error("GetFilename does not match expected value, got:", db.GetFilename())
+	}
+
+	// invalid file leaves the handle unchanged
+	err = db.Rebind("./testdata/invalid.mbtiles")
+	if err == nil {
+		t.Error("Rebind to invalid mbtiles did not raise error")
+	}
+	if db.GetTileFormat() != PBF {
+		t.Error("Failed Rebind modified handle")
+	}
+
+	// closed handles can be rebound
+	db.Close()
+	var data []byte
+	if err := db.ReadTile(0, 0, 0, &data); err == nil {
+		t.Error("Closed handle did not raise error on read")
+	}
+	if err := db.Rebind("./testdata/geography-class-png.mbtiles"); err != nil {
+		t.Fatal("Unexpected error rebinding closed handle:", err)
+	}
+	if err := db.ReadTile(0, 0, 0, &data); err != nil || len(data) != 21246 {
+		t.Error("Could not read tile after rebinding closed handle:", err)
+	}
+}
+
+func Test_ListTiles(t *testing.T) {
+	db, err := Open("./testdata/geography-class-png.mbtiles")
+	if err != nil {
+		t.Fatal("Could not open mbtiles:", err)
+	}
+	defer db.Close()
+
+	tests := []struct {
+		limit  int64
+		offset int64
+		tiles  []TileInfo
+	}{
+		{limit: 2, offset: 0, tiles: []TileInfo{{Z: 0, X: 0, Y: 0, Size: 21246}, {Z: 1, X: 0, Y: 0, Size: 13843}}},
+		{limit: 10, offset: 4, tiles: []TileInfo{{Z: 1, X: 1, Y: 1}}},
+		{limit: 10, offset: 5, tiles: nil},
+	}
+
+	for _, tc := range tests {
+		tiles, err := db.ListTiles(tc.limit, tc.offset)
+		if err != nil {
+			t.Error("Unexpected error listing tiles:", err)
+			continue
+		}
+		if len(tiles) != len(tc.tiles) {
+			t.Error("ListTiles returned", len(tiles), "tiles, expected", len(tc.tiles))
+			continue
+		}
+		for i, expected := range tc.tiles {
+			tile := tiles[i]
+			if tile.Z != expected.Z || tile.X != expected.X || tile.Y != expected.Y {
+				t.Error("Tile", tile, "does not match expected value", expected)
+			}
+			if expected.Size > 0 && tile.Size != expected.Size {
+				t.Error("Tile size", tile.Size, "does not match expected value", expected.Size)
+			}
+		}
+	}
+}
+
+func Test_ReadTiles(t *testing.T) {
+	db, err := Open("./testdata/geography-class-png.mbtiles")
+	if err != nil {
+		t.Fatal("Could not open mbtiles:", err)
+	}
+	defer db.Close()
+
+	coords := [][3]int64{{0, 0, 0}, {1, 0, 0}, {10, 0, 0}}
+	expected := []int{21246, 13843, 0}
+
+	i := 0
+	err = db.ReadTiles(coords, func(z, x, y int64, data []byte) error {
+		if [3]int64{z, x, y} != coords[i] {
+			t.Error("ReadTiles returned tile", z, x, y, "out of order")
+		}
+		if len(data) != expected[i] {
+			t.Error("ReadTiles returned different number of bytes than expected for tile:", z, x, y, "got:", len(data))
+		}
+		if expected[i] == 0 && data != nil {
+			t.Error("ReadTiles did not return nil data for nonexistent tile")
+		}
+		i++
+		return nil
+	})
+	if err != nil {
+		t.Error("Unexpected error reading tiles:", err)
+	}
+	if i != len(coords) {
+		t.Error("ReadTiles did not call handler for each tile, got:", i)
+	}
+
+	// errors from handler stop reading
+	calls := 0
+	err = db.ReadTiles(coords, func(z, x, y int64, data []byte) error {
+		calls++
+		return errors.New("stop")
+	})
+	if err == nil || calls != 1 {
+		t.Error("ReadTiles did not stop on handler error")
+	}
+
+	// options are applied as for ReadTile
+	var events []string
+	strictDB, err := Open("./testdata/geography-class-png.mbtiles", WithStrictCoordinates(), WithTileNotFoundError(),
+		WithLogger(func(event string, fields map[string]interface{}) {
+			events = append(events, event)
+		}))
+	if err != nil {
+		t.Fatal("Could not open mbtiles:", err)
+	}
+	defer strictDB.Close()
+	err = strictDB.ReadTiles([][3]int64{{0, 0, 0}, {1, 2, 0}}, func(z, x, y int64, data []byte) error {
+		t.Error("ReadTiles called handler before validating coordinates")
+		return nil
+	})
+	if err == nil {
+		t.Error("ReadTiles did not raise error for invalid coordinates")
+	}
+	if err = strictDB.ReadTiles(coords, func(z, x, y int64, data []byte) error { return nil }); !errors.Is(err, ErrTileNotFound) {
+		t.Error("ReadTiles did not return ErrTileNotFound for nonexistent tile, got:", err)
+	}
+	if len(events) != 1 || events[0] != "tile_not_found" {
+		t.Error("ReadTiles did not log tile_not_found event, got:", events)
+	}
+}
+
+func Test_EachTile(t *testing.T) {
+	db, err := Open("./testdata/geography-class-png.mbtiles")
+	if err != nil {
+		t.Fatal("Could not open mbtiles:", err)
+	}
+	defer db.Close()
+
+	count := 0
+	err = db.EachTile(context.Background(), func(z, x, y int64, data []byte) error {
+		if len(data) == 0 {
+			t.Error("EachTile returned no data for tile:", z, x, y)
+		}
+		count++
+		return nil
+	})
+	if err != nil {
+		t.Error("Unexpected error iterating tiles:", err)
+	}
+	if count != 5 {
+		t.Error("EachTile did not visit all tiles, got:", count)
+	}
+
+	// errors from fn stop iteration
+	count = 0
+	err = db.EachTile(context.Background(), func(z, x, y int64, data []byte) error {
+		count++
+		return errors.New("stop")
+	})
+	if err == nil || count != 1 {
+		t.Error("EachTile did not stop on error")
+	}
+
+	// cancelled context stops iteration
+	ctx, cancel := context.WithCancel(context.Background())
+	count = 0
+	err = db.EachTile(ctx, func(z, x, y int64, data []byte) error {
+		count++
+		cancel()
+		return nil
+	})
+	if !errors.Is(err, context.Canceled) || count != 1 {
+		t.Error("EachTile did not stop when context was cancelled, raised:", err)
+	}
+
+	// connection is returned to the pool after errors
+	var data []byte
+	if err := db.ReadTile(0, 0, 0, &data); err != nil {
+		t.Error("Unexpected error reading tile after EachTile:", err)
+	}
+}
+
+func Test_HasTile(t *testing.T) {
+	tests := []struct {
+		z      int64
+		x      int64
+		y      int64
+		exists bool
+	}{
+		{z: 0, x: 0, y: 0, exists: true},
+		{z: 1, x: 1, y: 1, exists: true},
+		{z: 10, x: 0, y: 0, exists: false},
+	}
+
+	db, err := Open("./testdata/geography-class-png.mbtiles")
+	if err != nil {
+		t.Fatal("Could not open mbtiles:", err)
+	}
+	defer db.Close()
+
+	for _, tc := range tests {
+		exists, err := db.HasTile(tc.z, tc.x, tc.y)
+		if err != nil {
+			t.Error("Unexpected error checking tile:", tc.z, tc.x, tc.y)
+			continue
+		}
+		if exists != tc.exists {
+			t.Error("HasTile returned", exists, "for tile:", tc.z, tc.x, tc.y)
+		}
+	}
+
+	strict, err := Open("./testdata/geography-class-png.mbtiles", WithStrictCoordinates())
+	if err != nil {
+		t.Fatal("Could not open mbtiles:", err)
+	}
+	defer strict.Close()
+	if _, err := strict.HasTile(1, 2, 0); err == nil {
+		t.Error("HasTile did not raise error for invalid tile with StrictCoordinates")
+	}
+}
+
+func Test_Open_options(t *testing.T) {
+	path := "./testdata/geography-class-png.mbtiles"
+
+	db, err := Open(path, WithPoolSize(2), WithFlags(sqlite.SQLITE_OPEN_READONLY|sqlite.SQLITE_OPEN_NOMUTEX))
+	if err != nil {
+		t.Fatal("Could not open mbtiles:", err)
+	}
+	defer db.Close()
+
+	if db.ConnectionCount() != 2 {
+		t.Error("ConnectionCount does not match expected value, got:", db.ConnectionCount())
+	}
+
+	var data []byte
+	if err := db.ReadTile(0, 0, 0, &data); err != nil || len(data) != 21246 {
+		t.Error("Could not read tile:", err)
+	}
+
+	_, err = Open(path, WithPoolSize(-1))
+	if err == nil {
+		t.Error("Invalid pool size did not raise error on open")
+	}
+}
+
+func Test_ReadTileContext(t *testing.T) {
+	db, err := Open("./testdata/geography-class-png.mbtiles", WithPoolSize(1))
+	if err != nil {
+		t.Fatal("Could not open mbtiles:", err)
+	}
+	defer db.Close()
+
+	var data []byte
+	err = db.ReadTileContext(context.Background(), 0, 0, 0, &data)
+	if err != nil || len(data) != 21246 {
+		t.Error("Could not read tile:", err)
+	}
+
+	// hold the only connection so that reads must wait for it
+	snapshot, err := db.Snapshot(context.Background())
+	if err != nil {
+		t.Fatal("Could not create snapshot:", err)
+	}
+	defer snapshot.Close()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+	err = db.ReadTileContext(ctx, 0, 0, 0, &data)
+	if err == nil {
+		t.Error("ReadTileContext did not raise error when context was cancelled")
+	}
+}
+
+func Test_ReadTileXYZ_invalid(t *testing.T) {
+	db, err := Open("./testdata/geography-class-png.mbtiles")
+	if err != nil {
+		t.Fatal("Could not open mbtiles:", err)
+	}
+	defer db.Close()
+
+	tests := [][3]int64{{-1, 0, 0}, {63, 0, 0}, {1, 2, 0}, {1, 0, 2}, {1, -1, 0}, {1, 0, -1}}
+	for _, tc := range tests {
+		var data []byte
+		if err := db.ReadTileXYZ(tc[0], tc[1], tc[2], &data); err == nil {
+			t.Error("ReadTileXYZ did not raise error for invalid tile:", tc)
+		}
+	}
+}
+
+func Test_ReadTileQuadkey(t *testing.T) {
+	db, err := Open("./testdata/geography-class-png.mbtiles")
+	if err != nil {
+		t.Fatal("Could not open mbtiles:", err)
+	}
+	defer db.Close()
+
+	var data []byte
+	// quadkey 2 is xyz 1/0/1, tms 1/0/0
+	err = db.ReadTileQuadkey("2", &data)
+	if err != nil {
+		t.Error("Unexpected error reading tile:", err)
+	}
+	if len(data) != 13843 {
+		t.Error("ReadTileQuadkey returned different number of bytes than expected, got:", len(data))
+	}
+
+	if err := db.ReadTileQuadkey("9", &data); err == nil {
+		t.Error("Invalid quadkey did not raise error")
+	}
+
+	// quadkey 2 is row 1 when tiles are stored in XYZ scheme
+	path := createTestMBtiles(t, `
+		CREATE TABLE tiles (zoom_level integer, tile_column integer, tile_row integer, tile_data blob);
+		INSERT INTO tiles VALUES (1, 0, 1, x'89504e470d0a1a0a0000000d4948445200000100');
+		INSERT INTO metadata (name, value) VALUES ('scheme', 'xyz');
+	`)
+	xyzDB, err := Open(path)
+	if err != nil {
+		t.Fatal("Could not open:", path, err)
+	}
+	defer xyzDB.Close()
+	if err := xyzDB.ReadTileQuadkey("2", &data); err != nil || data == nil {
+		t.Error("ReadTileQuadkey did not read tile stored in XYZ scheme:", err)
+	}
+}
+
+func Test_ReadTileDecoded(t *testing.T) {
+	tests := []struct {
+		path   string
+		format TileFormat
+	}{
+		{path: "geography-class-png.mbtiles", format: PNG},
+		{path: "world_cities.mbtiles", format: UNKNOWN},
+	}
+
+	for _, tc := range tests {
+		db, err := Open("./testdata/" + tc.path)
+		if err != nil {
+			t.Error("Could not open:", tc.path)
+			continue
+		}
+		defer db.Close()
+
+		var data []byte
+		err = db.ReadTileDecoded(0, 0, 0, &data)
+		if err != nil {
+			t.Error("Unexpected error reading tile for:", tc.path, err)
+			continue
+		}
+		if len(data) == 0 {
+			t.Error("ReadTileDecoded returned no data for:", tc.path)
+		}
+		if format, _ := detectTileFormat(data); format != tc.format {
+			t.Error("Decoded tile format", format, "does not match expected value", tc.format, "for:", tc.path)
+		}
+	}
+
+	// tiles are not decompressed twice with AutoDecompress
+	db, err := OpenWithOptions("./testdata/world_cities.mbtiles", Options{AutoDecompress: true})
+	if err != nil {
+		t.Fatal("Could not open mbtiles:", err)
+	}
+	defer db.Close()
+	var decoded, expected []byte
+	if err := db.ReadTileDecoded(0, 0, 0, &decoded); err != nil {
+		t.Error("Unexpected error reading tile with AutoDecompress:", err)
+	}
+	if err := db.ReadTile(0, 0, 0, &expected); err != nil {
+		t.Error("Unexpected error reading tile:", err)
+	}
+	if !bytes.Equal(decoded, expected) {
+		t.Error("ReadTileDecoded with AutoDecompress does not match ReadTile")
+	}
+}
+
+func Test_ReadTileDecoded_corrupt(t *testing.T) {
+	// gzip header followed by invalid data
+	path := createTestMBtiles(t, `
+		CREATE TABLE tiles (zoom_level integer, tile_column integer, tile_row integer, tile_data blob);
+		INSERT INTO tiles VALUES (0, 0, 0, x'1f8b080000000000020300ffffffffffffff');
+	`)
+
+	db, err := Open(path)
+	if err != nil {
+		t.Fatal("Could not open:", path, err)
+	}
+	defer db.Close()
+
+	var data []byte
+	err = db.ReadTileDecoded(0, 0, 0, &data)
+	if err == nil {
+		t.Error("ReadTileDecoded did not raise error for corrupt tile")
+	}
+	if data != nil {
+		t.Error("ReadTileDecoded returned partial data for corrupt tile")
+	}
+}
+
+func Test_retryBusy(t *testing.T) {
+	busy := sqlite.Error{Code: sqlite.SQLITE_BUSY}
+	locked := sqlite.Error{Code: sqlite.SQLITE_LOCKED_SHAREDCACHE}
+
+	tests := []struct {
+		errs     []error // errors returned by successive calls
+		attempts int
+		calls    int
+		isBusy   bool
+	}{
+		{errs: []error{nil}, attempts: 3, calls: 1, isBusy: false},
+		{errs: []error{busy, locked, nil}, attempts: 3, calls: 3, isBusy: false},
+		{errs: []error{busy, busy, busy}, attempts: 2, calls: 3, isBusy: true},
+		{errs: []error{busy}, attempts: 0, calls: 1, isBusy: true},
+		{errs: []error{errors.New("other")}, attempts: 3, calls: 1, isBusy: false},
+	}
+
+	for _, tc := range tests {
+		calls := 0
+		err := retryBusy(context.Background(), tc.attempts, time.Millisecond, nil, func() error {
+			err := tc.errs[calls]
+			calls++
+			return err
+		})
+		if calls != tc.calls {
+			t.Error("Number of calls", calls, "does not match expected value", tc.calls, "for:", tc.errs)
+		}
+		if isBusy(err) != tc.isBusy {
+			t.Error("Unexpected error", err, "for:", tc.errs)
+		}
+		if tc.isBusy && !strings.Contains(err.Error(), "busy or locked") {
+			t.Error("Error", err, "does not indicate database is busy or locked")
+		}
+	}
+}
+
+func Test_WithBusyRetry(t *testing.T) {
+	db, err := Open("./testdata/geography-class-png.mbtiles", WithBusyRetry(3, time.Millisecond))
+	if err != nil {
+		t.Fatal("Could not open mbtiles:", err)
+	}
+	defer db.Close()
+
+	if db.opts.BusyRetryAttempts != 3 || db.opts.BusyRetryBackoff != time.Millisecond {
+		t.Error("Busy retry options were not set:", db.opts.BusyRetryAttempts, db.opts.BusyRetryBackoff)
+	}
+
+	var data []byte
+	err = db.ReadTile(0, 0, 0, &data)
+	if err != nil || len(data) == 0 {
+		t.Error("Could not read tile with busy retry set:", err)
+	}
+
+	_, err = Open("./testdata/geography-class-png.mbtiles", WithBusyRetry(-1, time.Millisecond))
+	if err == nil {
+		t.Error("Open did not raise error for negative busy retry attempts")
+	}
+}
+
+// replaceTestFile copies src over dst and sets its modification time to
+// modTime.
+func replaceTestFile(t *testing.T, src, dst string, modTime time.Time) {
+	data, err := os.ReadFile(src)
+	if err != nil {
+		t.Fatal("Could not read:", src, err)
+	}
+	tmp := dst + ".tmp"
+	if err := os.WriteFile(tmp, data, 0644); err != nil {
+		t.Fatal("Could not write:", tmp, err)
+	}
+	if err := os.Chtimes(tmp, modTime, modTime); err != nil {
+		t.Fatal("Could not set modification time:", tmp, err)
+	}
+	if err := os.Rename(tmp, dst); err != nil {
+		t.Fatal("Could not replace:", dst, err)
+	}
+}
+
+func Test_Reload(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "test.mbtiles")
+	modTime := time.Now().Add(-time.Hour).Round(time.Second)
+	replaceTestFile(t, "./testdata/geography-class-png.mbtiles", path, modTime)
+
+	db, err := Open(path)
+	if err != nil {
+		t.Fatal("Could not open mbtiles:", err)
+	}
+	defer db.Close()
+
+	// unchanged file is not reloaded
+	if err := db.Reload(); err != nil {
+		t.Fatal("Unexpected error reloading:", err)
+	}
+	if db.GetTileFormat() != PNG {
+		t.Error("Tile format", db.GetTileFormat(), "does not match expected value", PNG)
+	}
+
+	replaceTestFile(t, "./testdata/geography-class-jpg.mbtiles", path, modTime.Add(time.Minute))
+	if err := db.Reload(); err != nil {
+		t.Fatal("Unexpected error reloading:", err)
+	}
+	if db.GetTileFormat() != JPG {
+		t.Error("Tile format", db.GetTileFormat(), "does not match expected value", JPG)
+	}
+	if !db.GetTimestamp().Equal(modTime.Add(time.Minute)) {
+		t.Error("Timestamp", db.GetTimestamp(), "was not updated")
+	}
+
+	db.Close()
+	if err := db.Reload(); err == nil {
+		t.Error("Reload did not raise error for closed database")
+	}
+}
+
+func Test_WithAutoReload(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "test.mbtiles")
+	modTime := time.Now().Add(-time.Hour).Round(time.Second)
+	replaceTestFile(t, "./testdata/geography-class-png.mbtiles", path, modTime)
+
+	db, err := Open(path, WithAutoReload())
+	if err != nil {
+		t.Fatal("Could not open mbtiles:", err)
+	}
+	defer db.Close()
+
+	replaceTestFile(t, "./testdata/world_cities.mbtiles", path, modTime.Add(time.Minute))
+
+	var data []byte
+	if err := db.ReadTile(0, 0, 0, &data); err != nil {
+		t.Fatal("Unexpected error reading tile:", err)
+	}
+	if format, _ := detectTileFormat(data); format != GZIP {
+		t.Error("Tile was not read from reloaded file, got format:", format)
+	}
+	if db.GetTileFormat() != PBF {
+		t.Error("Tile format", db.GetTileFormat(), "does not match expected value", PBF)
+	}
+}
+
+func Test_GetZoomLevels(t *testing.T) {
+	tests := []struct {
+		path     string
+		expected []int64
+		count    int64
+	}{
+		{path: "geography-class-png.mbtiles", expected: []int64{0, 1}, count: 5},
+		{path: "world_cities.mbtiles", expected: []int64{0, 1, 2, 3, 4, 5, 6}, count: 196},
+	}
+
+	for _, tc := range tests {
+		db, err := Open("./testdata/" + tc.path)
+		if err != nil {
+			t.Fatal("Could not open:", tc.path, err)
+		}
+		defer db.Close()
+
+		zooms, err := db.GetZoomLevels()
+		if err != nil {
+			t.Fatal("Unexpected error getting zoom levels for:", tc.path, err)
+		}
+		if len(zooms) != len(tc.expected) {
+			t.Fatal("Zoom levels", zooms, "do not match expected value", tc.expected, "for:", tc.path)
+		}
+		for i := range zooms {
+			if zooms[i] != tc.expected[i] {
+				t.Error("Zoom levels", zooms, "do not match expected value", tc.expected, "for:", tc.path)
+				break
+			}
+		}
+
+		count, err := db.CountTiles()
+		if err != nil {
+			t.Fatal("Unexpected error counting tiles for:", tc.path, err)
+		}
+		if count != tc.count {
+			t.Error("Tile count", count, "does not match expected value", tc.count, "for:", tc.path)
+		}
+	}
+}
+
+func BenchmarkReadTile(b *testing.B) {
+	db, err := Open("./testdata/geography-class-png.mbtiles")
+	if err != nil {
+		b.Fatal("Could not open mbtiles:", err)
+	}
+	defer db.Close()
+
+	b.ResetTimer()
+	var data []byte
+	for i := 0; i < b.N; i++ {
+		if err := db.ReadTile(0, 0, 0, &data); err != nil {
+			b.Fatal("Could not read tile:", err)
+		}
+	}
+}
+
+func BenchmarkReadTileParallel(b *testing.B) {
+	db, err := Open("./testdata/geography-class-png.mbtiles")
+	if err != nil {
+		b.Fatal("Could not open mbtiles:", err)
+	}
+	defer db.Close()
+
+	b.ResetTimer()
+	b.RunParallel(func(pb *testing.PB) {
+		var data []byte
+		for pb.Next() {
+			if err := db.ReadTile(0, 0, 0, &data); err != nil {
+				b.Error("Could not read tile:", err)
+				return
+			}
+		}
+	})
+}
+
+// BenchmarkReadTileTransient prepares the query for each read, for comparison
+// with the cached statement used by ReadTile.
+func BenchmarkReadTileTransient(b *testing.B) {
+	con, err := sqlite.OpenConn("./testdata/geography-class-png.mbtiles", defaultFlags)
+	if err != nil {
+		b.Fatal("Could not open mbtiles:", err)
+	}
+	defer con.Close()
+
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		query, _, err := con.PrepareTransient(readTileQuery)
+		if err != nil {
+			b.Fatal("Could not prepare query:", err)
+		}
+		query.SetInt64("$z", 0)
+		query.SetInt64("$x", 0)
+		query.SetInt64("$y", 0)
+		if _, err := query.Step(); err != nil {
+			b.Fatal("Could not read tile:", err)
+		}
+		data := make([]byte, query.ColumnLen(0))
+		query.ColumnBytes(0, data)
+		query.Finalize()
+	}
+}
+
+func Test_WithConnection(t *testing.T) {
+	db, err := Open("./testdata/geography-class-png.mbtiles", WithPoolSize(1))
+	if err != nil {
+		t.Fatal("Could not open mbtiles:", err)
+	}
+	defer db.Close()
+
+	var count int64
+	err = db.WithConnection(context.Background(), func(con *sqlite.Conn) error {
+		return sqlitex.Exec(con, "select count(*) from grid_utfgrid", func(stmt *sqlite.Stmt) error {
+			count = stmt.ColumnInt64(0)
+			return nil
+		})
+	})
+	if err != nil {
+		t.Fatal("Unexpected error running query:", err)
+	}
+	if count == 0 {
+		t.Error("No rows returned from custom query")
+	}
+
+	expected := errors.New("callback error")
+	err = db.WithConnection(context.Background(), func(con *sqlite.Conn) error {
+		return expected
+	})
+	if err != expected {
+		t.Error("Callback error was not returned, got:", err)
+	}
+
+	// connection is returned to the pool on panic
+	func() {
+		defer func() { recover() }()
+		db.WithConnection(context.Background(), func(con *sqlite.Conn) error {
+			panic("callback panic")
+		})
+	}()
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+	var data []byte
+	if err := db.ReadTileContext(ctx, 0, 0, 0, &data); err != nil {
+		t.Error("Connection was not returned to pool:", err)
+	}
+}
+
+func Test_TileContentEncoding(t *testing.T) {
+	tests := []struct {
+		path     string
+		expected string
+	}{
+		{path: "./testdata/world_cities.mbtiles", expected: "gzip"},
+		{path: "./testdata/geography-class-png.mbtiles", expected: ""},
+		{path: createTestMBtiles(t, `
+			CREATE TABLE tiles (zoom_level integer, tile_column integer, tile_row integer, tile_data blob);
+			INSERT INTO tiles VALUES (0, 0, 0, x'789c030000000001');
+		`), expected: "deflate"},
+	}
+
+	for _, tc := range tests {
+		db, err := Open(tc.path)
+		if err != nil {
+			t.Fatal("Could not open:", tc.path, err)
+		}
+		defer db.Close()
+
+		encoding, err := db.TileContentEncoding()
+		if err != nil {
+			t.Error("Unexpected error detecting content encoding for:", tc.path, err)
+		}
+		if encoding != tc.expected {
+			t.Error("Content encoding", encoding, "does not match expected value", tc.expected, "for:", tc.path)
+		}
+	}
+}
+
+func Test_GetTileSizeAtZoom(t *testing.T) {
+	// 256px tile at zoom 0, 512px tile at zoom 1
+	path := createTestMBtiles(t, `
+		CREATE TABLE tiles (zoom_level integer, tile_column integer, tile_row integer, tile_data blob);
+		INSERT INTO tiles VALUES (0, 0, 0, x'89504e470d0a1a0a0000000d4948445200000100000001000806000000');
+		INSERT INTO tiles VALUES (1, 0, 0, x'89504e470d0a1a0a0000000d4948445200000200000002000806000000');
+	`)
+
+	db, err := Open(path)
+	if err != nil {
+		t.Fatal("Could not open:", path, err)
+	}
+	defer db.Close()
+
+	tests := []struct {
+		z        int64
+		expected uint32
+	}{
+		{z: 0, expected: 256},
+		{z: 1, expected: 512},
+	}
+	for _, tc := range tests {
+		tilesize, err := db.GetTileSizeAtZoom(tc.z)
+		if err != nil {
+			t.Error("Unexpected error detecting tile size at zoom:", tc.z, err)
+		}
+		if tilesize != tc.expected {
+			t.Error("Tile size", tilesize, "does not match expected value", tc.expected, "at zoom:", tc.z)
+		}
+	}
+
+	if _, err := db.GetTileSizeAtZoom(2); err == nil {
+		t.Error("GetTileSizeAtZoom did not raise error for zoom level without tiles")
+	}
+}
+
+func Test_WithTileNotFoundError(t *testing.T) {
+	db, err := Open("./testdata/geography-class-png.mbtiles", WithTileNotFoundError())
+	if err != nil {
+		t.Fatal("Could not open mbtiles:", err)
+	}
+	defer db.Close()
+
+	var data []byte
+	if err := db.ReadTile(0, 0, 0, &data); err != nil || len(data) == 0 {
+		t.Error("Could not read existing tile:", err)
+	}
+
+	err = db.ReadTile(5, 0, 0, &data)
+	if !errors.Is(err, ErrTileNotFound) {
+		t.Error("ReadTile did not return ErrTileNotFound for missing tile, got:", err)
+	}
+	err = db.ReadTileXYZ(1, 1, 1, &data)
+	if err != nil {
+		t.Error("Unexpected error reading existing tile:", err)
+	}
+	err = db.ReadTileDecoded(5, 0, 0, &data)
+	if !errors.Is(err, ErrTileNotFound) {
+		t.Error("ReadTileDecoded did not return ErrTileNotFound for missing tile, got:", err)
+	}
+
+	// default behavior is unchanged
+	db2, err := Open("./testdata/geography-class-png.mbtiles")
+	if err != nil {
+		t.Fatal("Could not open mbtiles:", err)
+	}
+	defer db2.Close()
+	if err := db2.ReadTile(5, 0, 0, &data); err != nil || data != nil {
+		t.Error("ReadTile did not return nil data for missing tile by default:", err)
+	}
+}
+
+func Test_GetTileExtent(t *testing.T) {
+	db, err := Open("./testdata/geography-class-png.mbtiles")
+	if err != nil {
+		t.Fatal("Could not open mbtiles:", err)
+	}
+	defer db.Close()
+
+	tests := []struct {
+		z        int64
+		expected [4]int64 // minX, minY, maxX, maxY
+	}{
+		{z: 0, expected: [4]int64{0, 0, 0, 0}},
+		{z: 1, expected: [4]int64{0, 0, 1, 1}},
+	}
+	for _, tc := range tests {
+		minX, minY, maxX, maxY, err := db.GetTileExtent(tc.z)
+		if err != nil {
+			t.Error("Unexpected error reading tile extent at zoom:", tc.z, err)
+			continue
+		}
+		if extent := [4]int64{minX, minY, maxX, maxY}; extent != tc.expected {
+			t.Error("Tile extent", extent, "does not match expected value", tc.expected, "at zoom:", tc.z)
+		}
+	}
+
+	if _, _, _, _, err := db.GetTileExtent(5); err == nil {
+		t.Error("GetTileExtent did not raise error for zoom level without tiles")
+	}
+}
+
+func Test_Open_sampledFormat(t *testing.T) {
+	png := "x'89504e470d0a1a0a0000000d4948445200000100000001000806000000'"
+	jpg := "x'ffd8ffe000104a464946'"
+
+	tests := []struct {
+		name   string
+		tiles  string
+		format TileFormat
+	}{
+		{
+			name: "empty first tile",
+			tiles: `INSERT INTO tiles VALUES (0, 0, 0, x'');
+				INSERT INTO tiles VALUES (1, 0, 0, ` + png + `);`,
+			format: PNG,
+		},
+		{
+			name: "stray tile of different format",
+			tiles: `INSERT INTO tiles VALUES (0, 0, 0, ` + jpg + `);
+				INSERT INTO tiles VALUES (1, 0, 0, ` + png + `);
+				INSERT INTO tiles VALUES (1, 0, 1, ` + png + `);`,
+			format: PNG,
+		},
+	}
+
+	for _, tc := range tests {
+		path := createTestMBtiles(t, `
+			CREATE TABLE tiles (zoom_level integer, tile_column integer, tile_row integer, tile_data blob);
+		`+tc.tiles)
+
+		db, err := Open(path)
+		if err != nil {
+			t.Error("Could not open mbtiles with", tc.name, err)
+			continue
+		}
+		defer db.Close()
+
+		if db.GetTileFormat() != tc.format {
+			t.Error("Tile format", db.GetTileFormat(), "does not match expected value", tc.format, "for", tc.name)
+		}
+		if db.GetTileSize() != 256 {
+			t.Error("Tile size", db.GetTileSize(), "does not match expected value 256 for", tc.name)
+		}
+	}
+}
+
+func Test_WithLogger(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "test.mbtiles")
+	modTime := time.Now().Add(-time.Hour).Round(time.Second)
+	replaceTestFile(t, "./testdata/geography-class-png.mbtiles", path, modTime)
+
+	var mu sync.Mutex
+	events := make(map[string][]map[string]interface{})
+	logger := func(event string, fields map[string]interface{}) {
+		mu.Lock()
+		defer mu.Unlock()
+		events[event] = append(events[event], fields)
+	}
+
+	db, err := Open(path, WithLogger(logger), WithPoolSize(1))
+	if err != nil {
+		t.Fatal("Could not open mbtiles:", err)
+	}
+	defer db.Close()
+
+	var data []byte
+	db.ReadTile(5, 1, 2, &data)
+	if len(events["tile_not_found"]) != 1 || events["tile_not_found"][0]["y"] != int64(2) {
+		t.Error("tile_not_found event was not logged, got:", events)
+	}
+
+	// hold the only connection so that the next read waits for it
+	held := make(chan struct{})
+	go db.WithConnection(context.Background(), func(con *sqlite.Conn) error {
+		close(held)
+		time.Sleep(2 * poolWaitThreshold)
+		return nil
+	})
+	<-held
+	db.ReadTile(0, 0, 0, &data)
+	mu.Lock()
+	if len(events["pool_wait"]) != 1 {
+		t.Error("pool_wait event was not logged, got:", events)
+	}
+	mu.Unlock()
+
+	replaceTestFile(t, "./testdata/geography-class-jpg.mbtiles", path, modTime.Add(time.Minute))
+	if err := db.Reload(); err != nil {
+		t.Fatal("Unexpected error reloading:", err)
+	}
+	if len(events["reload"]) != 1 || events["reload"][0]["filename"] != path {
+		t.Error("reload event was not logged, got:", events)
+	}
+
+	busy := sqlite.Error{Code: sqlite.SQLITE_BUSY}
+	retryBusy(context.Background(), 2, time.Millisecond, logger, func() error { return busy })
+	if len(events["busy_retry"]) != 2 || events["busy_retry"][1]["attempt"] != 2 {
+		t.Error("busy_retry events were not logged, got:", events)
+	}
+}
+
+func Test_WithStrictCoordinates(t *testing.T) {
+	db, err := Open("./testdata/geography-class-png.mbtiles", WithStrictCoordinates())
+	if err != nil {
+		t.Fatal("Could not open mbtiles:", err)
+	}
+	defer db.Close()
+
+	tests := []struct {
+		z     int64
+		x     int64
+		y     int64
+		valid bool
+	}{
+		{z: 0, x: 0, y: 0, valid: true},
+		{z: 1, x: 1, y: 1, valid: true},
+		// valid but missing tile
+		{z: 5, x: 31, y: 31, valid: true},
+		{z: -1, x: 0, y: 0},
+		{z: 1, x: 2, y: 0},
+		{z: 1, x: 0, y: -1},
+		{z: 64, x: 0, y: 0},
+	}
+
+	for _, tc := range tests {
+		var data []byte
+		err := db.ReadTile(tc.z, tc.x, tc.y, &data)
+		if tc.valid && err != nil {
+			t.Error("Unexpected error reading tile:", tc.z, tc.x, tc.y, err)
+		}
+		if !tc.valid && err == nil {
+			t.Error("ReadTile did not raise error for invalid tile:", tc.z, tc.x, tc.y)
+		}
+	}
+
+	// default behavior is unchanged
+	db2, err := Open("./testdata/geography-class-png.mbtiles")
+	if err != nil {
+		t.Fatal("Could not open mbtiles:", err)
+	}
+	defer db2.Close()
+	var data []byte
+	if err := db2.ReadTile(1, 2, 0, &data); err != nil || data != nil {
+		t.Error("ReadTile did not return nil data for invalid tile by default:", err)
+	}
+}
+
+func Test_WriteTileTo(t *testing.T) {
+	db, err := Open("./testdata/geography-class-png.mbtiles")
+	if err != nil {
+		t.Fatal("Could not open mbtiles:", err)
+	}
+	defer db.Close()
+
+	var expected []byte
+	if err := db.ReadTile(1, 0, 0, &expected); err != nil {
+		t.Fatal("Could not read tile:", err)
+	}
+
+	var buf bytes.Buffer
+	n, err := db.WriteTileTo(1, 0, 0, &buf)
+	if err != nil {
+		t.Fatal("Unexpected error writing tile:", err)
+	}
+	if n != int64(len(expected)) || !bytes.Equal(buf.Bytes(), expected) {
+		t.Error("Written tile does not match tile data, got bytes:", n)
+	}
+
+	buf.Reset()
+	n, err = db.WriteTileTo(10, 0, 0, &buf)
+	if !errors.Is(err, ErrTileNotFound) || n != 0 || buf.Len() != 0 {
+		t.Error("WriteTileTo did not return ErrTileNotFound for missing tile, got:", n, err)
+	}
+}
+
+func Test_GetTile(t *testing.T) {
+	db, err := Open("./testdata/geography-class-png.mbtiles")
+	if err != nil {
+		t.Fatal("Could not open mbtiles:", err)
+	}
+	defer db.Close()
+
+	data, err := db.GetTile(0, 0, 0)
+	if err != nil || len(data) != 21246 {
+		t.Error("Could not get tile, got bytes:", len(data), err)
+	}
+
+	data, err = db.GetTile(10, 0, 0)
+	if err != nil || data != nil {
+		t.Error("GetTile did not return nil data for missing tile:", err)
+	}
+
+	db.Close()
+	if _, err := db.GetTile(0, 0, 0); err == nil {
+		t.Error("GetTile did not raise error for closed database")
+	}
+}
+
+func Test_GetTiles(t *testing.T) {
+	db, err := Open("./testdata/geography-class-png.mbtiles")
+	if err != nil {
+		t.Fatal("Could not open mbtiles:", err)
+	}
+	defer db.Close()
+
+	coords := []TileCoord{
+		{Z: 1, X: 0, Y: 0},
+		{Z: 1, X: 0, Y: 1},
+		{Z: 1, X: 1, Y: 0},
+		{Z: 1, X: 1, Y: 1},
+		{Z: 10, X: 0, Y: 0},
+	}
+	tiles, err := db.GetTiles(coords)
+	if err != nil {
+		t.Fatal("Unexpected error reading tiles:", err)
+	}
+	if len(tiles) != 4 {
+		t.Error("Number of tiles", len(tiles), "does not match expected value: 4")
+	}
+	if len(tiles[TileCoord{Z: 1, X: 0, Y: 0}]) != 13843 {
+		t.Error("Tile 1/0/0 does not have expected number of bytes, got:", len(tiles[TileCoord{Z: 1, X: 0, Y: 0}]))
+	}
+	if _, ok := tiles[TileCoord{Z: 10, X: 0, Y: 0}]; ok {
+		t.Error("Missing tile is present in results")
+	}
+
+	strictDB, err := Open("./testdata/geography-class-png.mbtiles", WithStrictCoordinates(), WithTileNotFoundError())
+	if err != nil {
+		t.Fatal("Could not open mbtiles:", err)
+	}
+	defer strictDB.Close()
+	if _, err := strictDB.GetTiles(coords); !errors.Is(err, ErrTileNotFound) {
+		t.Error("GetTiles did not return ErrTileNotFound for nonexistent tile, got:", err)
+	}
+	if _, err := strictDB.GetTiles([]TileCoord{{Z: 1, X: 2, Y: 0}}); err == nil || errors.Is(err, ErrTileNotFound) {
+		t.Error("GetTiles did not raise error for invalid coordinates, got:", err)
+	}
+}
+
+func Test_OpenContext(t *testing.T) {
+	db, err := OpenContext(context.Background(), "./testdata/geography-class-png.mbtiles", WithPoolSize(2))
+	if err != nil {
+		t.Fatal("Could not open mbtiles:", err)
+	}
+	defer db.Close()
+	if db.GetTileFormat() != PNG || db.ConnectionCount() != 2 {
+		t.Error("OpenContext did not open mbtiles with expected options")
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	_, err = OpenContext(ctx, "./testdata/geography-class-png.mbtiles")
+	if !errors.Is(err, context.Canceled) {
+		t.Error("OpenContext did not return context.Canceled, got:", err)
+	}
+}
+
+func Test_ReadTileBuffer(t *testing.T) {
+	db, err := Open("./testdata/geography-class-png.mbtiles")
+	if err != nil {
+		t.Fatal("Could not open mbtiles:", err)
+	}
+	defer db.Close()
+
+	var expected []byte
+	if err = db.ReadTile(0, 0, 0, &expected); err != nil {
+		t.Fatal("Could not read tile:", err)
+	}
+
+	buf := make([]byte, 0, 32*1024)
+	data, err := db.ReadTileBuffer(0, 0, 0, buf)
+	if err != nil {
+		t.Fatal("ReadTileBuffer returned error:", err)
+	}
+	if !bytes.Equal(data, expected) {
+		t.Error("ReadTileBuffer did not return expected tile data")
+	}
+	if &data[:1][0] != &buf[:1][0] {
+		t.Error("ReadTileBuffer did not reuse buffer with sufficient capacity")
+	}
+
+	// data are appended to existing contents
+	data, err = db.ReadTileBuffer(0, 0, 0, []byte("prefix"))
+	if err != nil {
+		t.Fatal("ReadTileBuffer returned error:", err)
+	}
+	if !bytes.HasPrefix(data, []byte("prefix")) || !bytes.Equal(data[6:], expected) {
+		t.Error("ReadTileBuffer did not append tile data to buffer")
+	}
+
+	// missing tile returns buffer unchanged
+	data, err = db.ReadTileBuffer(10, 0, 0, buf[:0])
+	if err != nil || len(data) != 0 {
+		t.Error("ReadTileBuffer did not return empty buffer for missing tile:", len(data), err)
+	}
+}
+
+func Test_WithXYZ(t *testing.T) {
+	// xyz 1/0/0 is tms 1/0/1
+	path := createTestMBtiles(t, `
+		CREATE TABLE tiles (zoom_level integer, tile_column integer, tile_row integer, tile_data blob);
+		INSERT INTO tiles VALUES (1, 0, 1, x'89504e470d0a1a0a0000000d4948445200000100');
+	`)
+
+	db, err := Open(path, WithXYZ())
+	if err != nil {
+		t.Fatal("Could not open:", path, err)
+	}
+	defer db.Close()
+
+	var data []byte
+	if err = db.ReadTile(1, 0, 0, &data); err != nil || len(data) != 20 {
+		t.Error("ReadTile did not flip y with XYZ option:", err)
+	}
+	if err = db.ReadTileXYZ(1, 0, 0, &data); err != nil || len(data) != 20 {
+		t.Error("ReadTileXYZ flipped y twice with XYZ option:", err)
+	}
+	if found, err := db.HasTile(1, 0, 0); err != nil || !found {
+		t.Error("HasTile did not flip y with XYZ option:", err)
+	}
+	if tiles, err := db.GetTiles([]TileCoord{{Z: 1, X: 0, Y: 0}}); err != nil || len(tiles[TileCoord{Z: 1, X: 0, Y: 0}]) != 20 {
+		t.Error("GetTiles did not flip y with XYZ option:", err)
+	}
+
+	err = db.EachTile(context.Background(), func(z, x, y int64, data []byte) error {
+		if y != 0 {
+			t.Error("EachTile did not flip y with XYZ option, got:", y)
+		}
+		return nil
+	})
+	if err != nil {
+		t.Error("EachTile returned error:", err)
+	}
+
+	// stored tiles are known to be in XYZ scheme, so don't flip
+	xyzDB, err := Open(path, WithXYZ(), func(o *Options) { o.ForceScheme = "xyz" })
+	if err != nil {
+		t.Fatal("Could not open:", path, err)
+	}
+	defer xyzDB.Close()
+	if err = xyzDB.ReadTile(1, 0, 1, &data); err != nil || len(data) != 20 {
+		t.Error("ReadTile flipped y for tiles stored in XYZ scheme:", err)
+	}
+}
+
+func Test_GetMinZoom_GetMaxZoom(t *testing.T) {
+	db, err := Open("./testdata/world_cities.mbtiles")
+	if err != nil {
+		t.Fatal("Could not open mbtiles:", err)
+	}
+	defer db.Close()
+	if db.GetMinZoom() != 0 || db.GetMaxZoom() != 6 {
+		t.Error("GetMinZoom / GetMaxZoom returned", db.GetMinZoom(), db.GetMaxZoom())
+	}
+
+	// inferred from tiles if metadata items are missing or invalid
+	path := createTestMBtiles(t, `
+		CREATE TABLE tiles (zoom_level integer, tile_column integer, tile_row integer, tile_data blob);
+		INSERT INTO tiles VALUES (2, 0, 0, x'89504e470d0a1a0a0000000d4948445200000100');
+		INSERT INTO tiles VALUES (4, 0, 0, x'89504e470d0a1a0a0000000d4948445200000100');
+		INSERT INTO metadata VALUES ('minzoom', 'invalid');
+		INSERT INTO metadata VALUES ('maxzoom', '10');
+	`)
+	db2, err := Open(path)
+	if err != nil {
+		t.Fatal("Could not open:", path, err)
+	}
+	defer db2.Close()
+	if db2.GetMinZoom() != 2 || db2.GetMaxZoom() != 4 {
+		t.Error("GetMinZoom / GetMaxZoom did not infer zoom levels from tiles, got:", db2.GetMinZoom(), db2.GetMaxZoom())
+	}
+}
+
+func Test_ReadMetadata_cache(t *testing.T) {
+	path := createTestMBtiles(t, `
+		CREATE TABLE tiles (zoom_level integer, tile_column integer, tile_row integer, tile_data blob);
+		INSERT INTO tiles VALUES (0, 0, 0, x'89504e470d0a1a0a0000000d4948445200000100');
+		INSERT INTO metadata (name, value) VALUES ('bounds', '-10,-10,10,10');
+		INSERT INTO metadata (name, value) VALUES ('json', '{"vector_layers": [{"id": "a"}]}');
+	`)
+
+	db, err := Open(path)
+	if err != nil {
+		t.Fatal("Could not open:", path, err)
+	}
+	defer db.Close()
+
+	metadata, err := db.ReadMetadata()
+	if err != nil {
+		t.Fatal("Unexpected error reading metadata:", err)
+	}
+	// modifying the returned map or its values does not modify the cache
+	metadata["name"] = "modified"
+	metadata["bounds"].([]float64)[0] = 0
+	metadata["vector_layers"].([]interface{})[0].(map[string]interface{})["id"] = "modified"
+
+	con, err := sqlite.OpenConn(path, sqlite.SQLITE_OPEN_READWRITE)
+	if err != nil {
+		t.Fatal("Could not open connection:", err)
+	}
+	defer con.Close()
+	if err = sqlitex.ExecTransient(con, "UPDATE metadata SET value = 'updated' WHERE name = 'name'", nil); err != nil {
+		t.Fatal("Could not update metadata:", err)
+	}
+
+	metadata, err = db.ReadMetadata()
+	if err != nil {
+		t.Fatal("Unexpected error reading metadata:", err)
+	}
+	if metadata["name"] != "test" {
+		t.Error("ReadMetadata did not return cached metadata, got:", metadata["name"])
+	}
+	if metadata["bounds"].([]float64)[0] != -10 {
+		t.Error("Modifying returned bounds modified cached metadata, got:", metadata["bounds"])
+	}
+	if id := metadata["vector_layers"].([]interface{})[0].(map[string]interface{})["id"]; id != "a" {
+		t.Error("Modifying returned vector_layers modified cached metadata, got:", id)
+	}
+
+	db.InvalidateMetadata()
+	metadata, err = db.ReadMetadata()
+	if err != nil {
+		t.Fatal("Unexpected error reading metadata:", err)
+	}
+	if metadata["name"] != "updated" {
+		t.Error("ReadMetadata did not read metadata after InvalidateMetadata, got:", metadata["name"])
+	}
+}
+
+func Test_WithHonorScheme(t *testing.T) {
+	// xyz 1/0/0 is tms 1/0/1
+	path := createTestMBtiles(t, `
+		CREATE TABLE tiles (zoom_level integer, tile_column integer, tile_row integer, tile_data blob);
+		INSERT INTO tiles VALUES (1, 0, 0, x'89504e470d0a1a0a0000000d4948445200000100');
+		INSERT INTO metadata (name, value) VALUES ('scheme', 'xyz');
+	`)
+
+	db, err := Open(path, WithHonorScheme())
+	if err != nil {
+		t.Fatal("Could not open:", path, err)
+	}
+	defer db.Close()
+
+	if db.GetScheme() != "xyz" {
+		t.Error("GetScheme did not return scheme from metadata, got:", db.GetScheme())
+	}
+
+	var data []byte
+	if err = db.ReadTile(1, 0, 1, &data); err != nil || len(data) != 20 {
+		t.Error("ReadTile did not flip y for tiles stored in XYZ scheme:", err)
+	}
+	if err = db.ReadTileXYZ(1, 0, 0, &data); err != nil || len(data) != 20 {
+		t.Error("ReadTileXYZ flipped y for tiles stored in XYZ scheme:", err)
+	}
+	err = db.EachTile(context.Background(), func(z, x, y int64, data []byte) error {
+		if y != 1 {
+			t.Error("EachTile did not flip y for tiles stored in XYZ scheme, got:", y)
+		}
+		return nil
+	})
+	if err != nil {
+		t.Error("EachTile returned error:", err)
+	}
+
+	// tiles stored in TMS scheme are not flipped
+	tms, err := Open(path, WithHonorScheme(), func(o *Options) { o.ForceScheme = "tms" })
+	if err != nil {
+		t.Fatal("Could not open:", path, err)
+	}
+	defer tms.Close()
+	if tms.GetScheme() != "tms" {
+		t.Error("GetScheme did not return ForceScheme, got:", tms.GetScheme())
+	}
+	if err = tms.ReadTile(1, 0, 0, &data); err != nil || len(data) != 20 {
+		t.Error("ReadTile flipped y for tiles stored in TMS scheme:", err)
+	}
+}
+
+func Test_ReadMetadata_lenient(t *testing.T) {
+	path := createTestMBtiles(t, `
+		CREATE TABLE tiles (zoom_level integer, tile_column integer, tile_row integer, tile_data blob);
+		INSERT INTO tiles VALUES (0, 0, 0, x'89504e470d0a1a0a0000000d4948445200000100');
+		INSERT INTO metadata VALUES ('bounds', '-180,-85');
+		INSERT INTO metadata VALUES ('minzoom', 'a');
+		INSERT INTO metadata VALUES ('json', '{invalid');
+		INSERT INTO metadata VALUES ('attribution', 'test attribution');
+	`)
+
+	strict, err := Open(path)
+	if err != nil {
+		t.Fatal("Could not open:", path, err)
+	}
+	defer strict.Close()
+	if _, err = strict.ReadMetadata(); err == nil {
+		t.Error("ReadMetadata did not raise error for malformed metadata")
+	}
+
+	var logged []string
+	db, err := Open(path, WithLenientMetadata(), WithLogger(func(event string, fields map[string]interface{}) {
+		if event == "metadata_warning" {
+			logged = append(logged, fields["error"].(error).Error())
+		}
+	}))
+	if err != nil {
+		t.Fatal("Could not open:", path, err)
+	}
+	defer db.Close()
+
+	metadata, err := db.ReadMetadata()
+	if err != nil {
+		t.Fatal("Unexpected error reading metadata:", err)
+	}
+	if metadata["name"] != "test" || metadata["attribution"] != "test attribution" {
+		t.Error("Valid metadata items were not read, got:", metadata)
+	}
+	if _, ok := metadata["bounds"]; ok {
+		t.Error("Malformed bounds were not skipped")
+	}
+	// inferred from tiles
+	if metadata["minzoom"] != 0 {
+		t.Error("minzoom was not inferred from tiles, got:", metadata["minzoom"])
+	}
+
+	warnings := db.MetadataWarnings()
+	if len(warnings) != 3 || len(logged) != 3 {
+		t.Fatal("Expected 3 warnings, got:", warnings, logged)
+	}
+	for i, expected := range []string{"bounds", "minzoom", "JSON"} {
+		if !strings.Contains(warnings[i].Error(), expected) {
+			t.Error("Warning", warnings[i], "does not contain expected value", expected)
+		}
+	}
+}
@@ -0,0 +1,486 @@
+package mbtiles
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+
+	"crawshaw.io/sqlite"
+	"crawshaw.io/sqlite/sqlitex"
+)
+
+// Metadata provides typed access to the standard items in the metadata table.
+// Optional items that are not present are zero values.
+type Metadata struct {
+	Name        string
+	Format      string
+	MinZoom     int
+	MaxZoom     int
+	Bounds      [4]float64 // west, south, east, north
+	Center      [3]float64 // longitude, latitude, zoom
+	Attribution string
+	Description string
+	Type        string
+	Version     string
+	Template    string // UTFGrid interactivity template
+	Legend      string
+
+	// JSON contains all other metadata items, including those parsed from the
+	// 'json' metadata item (e.g., vector_layers).
+	JSON map[string]interface{}
+
+	// RawJSON is the unparsed value of the 'json' metadata item, if present.
+	RawJSON string
+
+	// VectorLayers are the layers of a vector tileset, parsed from the
+	// 'json' metadata item.
+	VectorLayers []VectorLayer
+}
+
+// VectorLayer describes a layer in a vector tileset, as listed in the
+// vector_layers of the 'json' metadata item.
+type VectorLayer struct {
+	ID          string            `json:"id"`
+	Description string            `json:"description,omitempty"`
+	MinZoom     int               `json:"minzoom"`
+	MaxZoom     int               `json:"maxzoom"`
+	Fields      map[string]string `json:"fields"`
+}
+
+// GetMetadata reads the metadata table into a Metadata struct.
+func (db *MBtiles) GetMetadata() (*Metadata, error) {
+	values, err := db.ReadMetadata()
+	if err != nil {
+		return nil, err
+	}
+	return newMetadata(values)
+}
+
+// newMetadata creates a Metadata struct from the values returned by
+// ReadMetadata.
+func newMetadata(values map[string]interface{}) (*Metadata, error) {
+	metadata := &Metadata{
+		JSON: make(map[string]interface{}),
+	}
+
+	for key, value := range values {
+		switch key {
+		case "name":
+			metadata.Name, _ = value.(string)
+		case "format":
+			metadata.Format, _ = value.(string)
+		case "attribution":
+			metadata.Attribution, _ = value.(string)
+		case "description":
+			metadata.Description, _ = value.(string)
+		case "type":
+			metadata.Type, _ = value.(string)
+		case "version":
+			metadata.Version, _ = value.(string)
+		case "template":
+			metadata.Template, _ = value.(string)
+		case "legend":
+			metadata.Legend, _ = value.(string)
+		case "json_raw":
+			metadata.RawJSON, _ = value.(string)
+			var parsed struct {
+				VectorLayers []VectorLayer `json:"vector_layers"`
+			}
+			if err := json.Unmarshal([]byte(metadata.RawJSON), &parsed); err != nil {
+				return nil, fmt.Errorf("cannot read vector_layers from JSON metadata item: %v", err)
+			}
+			metadata.VectorLayers = parsed.VectorLayers
+		case "minzoom":
+			metadata.MinZoom, _ = value.(int)
+		case "maxzoom":
+			metadata.MaxZoom, _ = value.(int)
+		case "bounds":
+			bounds, _ := value.([]float64)
+			if len(bounds) != 4 {
+				return nil, fmt.Errorf("cannot read metadata item bounds: expected 4 values, got %v", value)
+			}
+			copy(metadata.Bounds[:], bounds)
+		case "center":
+			center, _ := value.([]float64)
+			if len(center) != 3 {
+				return nil, fmt.Errorf("cannot read metadata item center: expected 3 values, got %v", value)
+			}
+			copy(metadata.Center[:], center)
+		default:
+			metadata.JSON[key] = value
+		}
+	}
+
+	return metadata, nil
+}
+
+// GetBounds returns the bounds (west, south, east, north) from the metadata.
+// If bounds are not present in the metadata or are not valid, present is false
+// and the bounds are instead calculated from the extent of tiles at the
+// maximum zoom level.
+func (db *MBtiles) GetBounds() (bounds [4]float64, present bool, err error) {
+	if db == nil {
+		return bounds, false, fmt.Errorf("cannot read metadata: %w", ErrDatabaseClosed)
+	}
+
+	con, err := db.getConnection(context.TODO())
+	defer db.closeConnection(con)
+	if err != nil {
+		return bounds, false, err
+	}
+
+	return readBounds(con)
+}
+
+// GetCenter returns the center (longitude, latitude, zoom) from the metadata.
+// zoom is 0 if the center does not include it.  If center is not present in
+// the metadata or is not valid, present is false and the center is instead
+// calculated as the middle of the bounds (see GetBounds) at the minimum zoom
+// level.
+func (db *MBtiles) GetCenter() (center [3]float64, present bool, err error) {
+	if db == nil {
+		return center, false, fmt.Errorf("cannot read metadata: %w", ErrDatabaseClosed)
+	}
+
+	con, err := db.getConnection(context.TODO())
+	defer db.closeConnection(con)
+	if err != nil {
+		return center, false, err
+	}
+
+	return readCenter(con, db.GetMinZoom())
+}
+
+// readCenter reads the center from the metadata using con, as for GetCenter.
+// If the center is calculated, its zoom is minZoom.
+func readCenter(con *sqlite.Conn, minZoom int64) (center [3]float64, present bool, err error) {
+	value, present, err := readMetadataValue(con, "center")
+	if err != nil {
+		return center, false, err
+	}
+	if present {
+		values, err := parseFloats(value)
+		if err == nil && (len(values) == 2 || len(values) == 3) && validLonLat(values[0], values[1]) {
+			copy(center[:], values)
+			return center, true, nil
+		}
+	}
+
+	bounds, _, err := readBounds(con)
+	if err != nil {
+		return center, false, err
+	}
+	west, south, east, north := bounds[0], bounds[1], bounds[2], bounds[3]
+	lon := (west + east) / 2
+	// bounds that cross the antimeridian have west greater than east
+	if west > east {
+		lon = (west + east + 360) / 2
+		if lon > 180 {
+			lon -= 360
+		}
+	}
+	return [3]float64{lon, (south + north) / 2, float64(minZoom)}, false, nil
+}
+
+// readBounds reads the bounds from the metadata using con, as for GetBounds.
+func readBounds(con *sqlite.Conn) (bounds [4]float64, present bool, err error) {
+	value, present, err := readMetadataValue(con, "bounds")
+	if err != nil {
+		return bounds, false, err
+	}
+	if present {
+		values, err := parseFloats(value)
+		if err == nil && len(values) == 4 && validLonLat(values[0], values[1]) && validLonLat(values[2], values[3]) && values[1] <= values[3] {
+			copy(bounds[:], values)
+			return bounds, true, nil
+		}
+	}
+
+	bounds, err = getTileExtent(con)
+	return bounds, false, err
+}
+
+// validLonLat returns true if lon is within -180 to 180 and lat is within -90
+// to 90.
+func validLonLat(lon float64, lat float64) bool {
+	return lon >= -180 && lon <= 180 && lat >= -90 && lat <= 90
+}
+
+// GetSpecVersion detects the version of the mbtiles specification followed by
+// the mbtiles file from the features it uses, since the version is not stored
+// in the file:
+//   - "1.3": the 'json' metadata item is present, or format is pbf
+//   - "1.2": UTFGrid 'grids' or 'grid_data' are present
+//   - "1.1": the 'format' metadata item is present
+//   - "1.0": none of the above
+//
+// Files may follow a later version without using any of its features.
+func (db *MBtiles) GetSpecVersion() (string, error) {
+	if db == nil {
+		return "", fmt.Errorf("cannot read metadata: %w", ErrDatabaseClosed)
+	}
+
+	con, err := db.getConnection(context.TODO())
+	defer db.closeConnection(con)
+	if err != nil {
+		return "", err
+	}
+
+	_, hasJSON, err := readMetadataValue(con, "json")
+	if err != nil {
+		return "", err
+	}
+	format, hasFormat, err := readMetadataValue(con, "format")
+	if err != nil {
+		return "", err
+	}
+	if hasJSON || format == "pbf" {
+		return "1.3", nil
+	}
+
+	hasGrids := false
+	err = sqlitex.Exec(con, "select 1 from sqlite_master where name in ('grids', 'grid_data') limit 1", func(stmt *sqlite.Stmt) error {
+		hasGrids = true
+		return nil
+	})
+	if err != nil {
+		return "", err
+	}
+	switch {
+	case hasGrids:
+		return "1.2", nil
+	case hasFormat:
+		return "1.1", nil
+	default:
+		return "1.0", nil
+	}
+}
+
+// RepairMetadata calculates minzoom, maxzoom, and format from the tiles and
+// writes them to the metadata table, along with bounds and center if they are
+// missing or not valid (see GetBounds and GetCenter).  Returns the metadata
+// items that were written.  db must have been opened for writing, using Create
+// or the SQLITE_OPEN_READWRITE flag.
+func (db *MBtiles) RepairMetadata() (map[string]string, error) {
+	if db == nil {
+		return nil, fmt.Errorf("cannot write metadata: %w", ErrDatabaseClosed)
+	}
+
+	values, err := db.calculateMetadata()
+	if err != nil {
+		return nil, err
+	}
+	if err = db.SetMetadata(values); err != nil {
+		return nil, err
+	}
+
+	minZoom, _ := strconv.ParseInt(values["minzoom"], 10, 64)
+	maxZoom, _ := strconv.ParseInt(values["maxzoom"], 10, 64)
+	db.setZoomRange(minZoom, maxZoom)
+
+	return values, nil
+}
+
+// calculateMetadata calculates the metadata items written by RepairMetadata.
+func (db *MBtiles) calculateMetadata() (map[string]string, error) {
+	con, err := db.getConnection(context.TODO())
+	defer db.closeConnection(con)
+	if err != nil {
+		return nil, err
+	}
+
+	var minZoom, maxZoom int64
+	hasTiles := false
+	err = sqlitex.Exec(con, "select min(zoom_level), max(zoom_level) from tiles", func(stmt *sqlite.Stmt) error {
+		// aggregates are null if there are no tiles
+		if stmt.ColumnType(0) != sqlite.SQLITE_NULL {
+			hasTiles = true
+			minZoom, maxZoom = stmt.ColumnInt64(0), stmt.ColumnInt64(1)
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	if !hasTiles {
+		return nil, errors.New("'tiles' table must be non-empty")
+	}
+
+	values := map[string]string{
+		"minzoom": strconv.FormatInt(minZoom, 10),
+		"maxzoom": strconv.FormatInt(maxZoom, 10),
+	}
+
+	format := db.GetTileFormat()
+	switch format {
+	case UNKNOWN, ZLIB:
+	default:
+		values["format"] = format.String()
+	}
+
+	bounds, present, err := readBounds(con)
+	if err != nil {
+		return nil, err
+	}
+	if !present {
+		values["bounds"] = formatFloats(bounds[:])
+	}
+
+	center, present, err := readCenter(con, minZoom)
+	if err != nil {
+		return nil, err
+	}
+	if !present {
+		values["center"] = formatFloats(center[:])
+	}
+
+	return values, nil
+}
+
+// formatFloats joins values into a comma-delimited string, as used by the
+// bounds and center metadata items.
+func formatFloats(values []float64) string {
+	out := make([]string, len(values))
+	for i, value := range values {
+		out[i] = strconv.FormatFloat(value, 'f', -1, 64)
+	}
+	return strings.Join(out, ",")
+}
+
+// ValidateMetadata checks the metadata against the mbtiles specification: name
+// and format must be present, format must match the detected tile format,
+// bounds must be 4 values within the valid range of longitude and latitude,
+// and minzoom must not be greater than maxzoom.  All problems found are
+// returned together in a single error.
+func (db *MBtiles) ValidateMetadata() error {
+	if db == nil {
+		return fmt.Errorf("cannot read metadata: %w", ErrDatabaseClosed)
+	}
+
+	detectedFormat := db.GetTileFormat()
+
+	con, err := db.getConnection(context.TODO())
+	defer db.closeConnection(con)
+	if err != nil {
+		return err
+	}
+
+	errs, err := validateMetadata(con, detectedFormat)
+	if err != nil {
+		return err
+	}
+	return errors.Join(errs...)
+}
+
+// validateMetadata checks the metadata using con, as for ValidateMetadata, and
+// returns each problem found as a separate error.  err is set only if the
+// metadata cannot be read.
+func validateMetadata(con *sqlite.Conn, detectedFormat TileFormat) (errs []error, err error) {
+	values := make(map[string]string)
+	for _, name := range []string{"name", "format", "bounds", "minzoom", "maxzoom"} {
+		value, present, err := readMetadataValue(con, name)
+		if err != nil {
+			return nil, err
+		}
+		if present {
+			values[name] = value
+		}
+	}
+
+	if _, ok := values["name"]; !ok {
+		errs = append(errs, errors.New("metadata item name is required"))
+	}
+
+	if format, ok := values["format"]; !ok {
+		errs = append(errs, errors.New("metadata item format is required"))
+	} else if format != detectedFormat.String() {
+		errs = append(errs, fmt.Errorf("metadata item format %q does not match detected tile format %q", format, detectedFormat))
+	}
+
+	if value, ok := values["bounds"]; ok {
+		bounds, err := parseFloats(value)
+		switch {
+		case err != nil:
+			errs = append(errs, fmt.Errorf("cannot read metadata item bounds: %v", err))
+		case len(bounds) != 4:
+			errs = append(errs, fmt.Errorf("metadata item bounds must have 4 values, got %q", value))
+		case bounds[0] < -180 || bounds[0] > 180 || bounds[2] < -180 || bounds[2] > 180:
+			errs = append(errs, fmt.Errorf("metadata item bounds has longitude outside -180 to 180: %q", value))
+		case bounds[1] < -90 || bounds[1] > 90 || bounds[3] < -90 || bounds[3] > 90:
+			errs = append(errs, fmt.Errorf("metadata item bounds has latitude outside -90 to 90: %q", value))
+		case bounds[1] > bounds[3]:
+			errs = append(errs, fmt.Errorf("metadata item bounds has south greater than north: %q", value))
+		}
+	}
+
+	zooms := make(map[string]int)
+	for _, name := range []string{"minzoom", "maxzoom"} {
+		value, ok := values[name]
+		if !ok {
+			continue
+		}
+		zoom, err := strconv.Atoi(value)
+		if err != nil {
+			errs = append(errs, fmt.Errorf("cannot read metadata item %s: %v", name, err))
+			continue
+		}
+		zooms[name] = zoom
+	}
+	minZoom, hasMinZoom := zooms["minzoom"]
+	maxZoom, hasMaxZoom := zooms["maxzoom"]
+	if hasMinZoom && hasMaxZoom && minZoom > maxZoom {
+		errs = append(errs, fmt.Errorf("metadata item minzoom %d is greater than maxzoom %d", minZoom, maxZoom))
+	}
+
+	return errs, nil
+}
+
+// readMetadataValue reads a single non-empty metadata item using con.
+func readMetadataValue(con *sqlite.Conn, name string) (value string, present bool, err error) {
+	err = sqlitex.Exec(con, "select value from metadata where name = ? and value is not ''", func(stmt *sqlite.Stmt) error {
+		value = stmt.ColumnText(0)
+		present = true
+		return nil
+	}, name)
+	return value, present, err
+}
+
+// getTileExtent calculates the bounds (west, south, east, north) of the tiles
+// at the maximum zoom level using con.
+func getTileExtent(con *sqlite.Conn) ([4]float64, error) {
+	var (
+		bounds   [4]float64
+		hasTiles bool
+	)
+	err := sqlitex.Exec(con, `select zoom_level, min(tile_column), max(tile_column), min(tile_row), max(tile_row) from tiles
+		where zoom_level = (select max(zoom_level) from tiles)`, func(stmt *sqlite.Stmt) error {
+		if stmt.ColumnType(0) == sqlite.SQLITE_NULL {
+			return nil
+		}
+		hasTiles = true
+
+		z := stmt.ColumnInt64(0)
+		minX, maxX := stmt.ColumnInt64(1), stmt.ColumnInt64(2)
+		// rows are in TMS scheme
+		_, _, top := TMSToXYZ(z, 0, stmt.ColumnInt64(4))
+		_, _, bottom := TMSToXYZ(z, 0, stmt.ColumnInt64(3))
+
+		bounds = [4]float64{
+			tileXToLon(minX, z),
+			tileYToLat(bottom+1, z),
+			tileXToLon(maxX+1, z),
+			tileYToLat(top, z),
+		}
+		return nil
+	})
+	if err != nil {
+		return bounds, err
+	}
+	if !hasTiles {
+		return bounds, errors.New("'tiles' table must be non-empty")
+	}
+	return bounds, nil
+}
@@ -0,0 +1,324 @@
+package mbtiles
+
+import (
+	"math"
+	"strings"
+	"testing"
+
+	"crawshaw.io/sqlite"
+)
+
+func Test_GetMetadata(t *testing.T) {
+	db, err := Open("./testdata/geography-class-png.mbtiles")
+	if err != nil {
+		t.Fatal("Could not open mbtiles:", err)
+	}
+	defer db.Close()
+
+	metadata, err := db.GetMetadata()
+	if err != nil {
+		t.Fatal("Error raised when reading metadata:", err)
+	}
+
+	if metadata.Name != "Geography Class" {
+		t.Error("Name does not match expected value, got:", metadata.Name)
+	}
+	if metadata.MinZoom != 0 || metadata.MaxZoom != 1 {
+		t.Error("Zoom levels do not match expected values, got:", metadata.MinZoom, metadata.MaxZoom)
+	}
+	if metadata.Bounds != [4]float64{-180, -85.0511, 180, 85.0511} {
+		t.Error("Bounds do not match expected values, got:", metadata.Bounds)
+	}
+	if metadata.Description == "" {
+		t.Error("Description is empty")
+	}
+}
+
+func Test_GetMetadata_json(t *testing.T) {
+	db, err := Open("./testdata/world_cities.mbtiles")
+	if err != nil {
+		t.Fatal("Could not open mbtiles:", err)
+	}
+	defer db.Close()
+
+	metadata, err := db.GetMetadata()
+	if err != nil {
+		t.Fatal("Error raised when reading metadata:", err)
+	}
+	if metadata.Format != "pbf" {
+		t.Error("Format does not match expected value, got:", metadata.Format)
+	}
+	if metadata.MaxZoom != 6 {
+		t.Error("MaxZoom does not match expected value, got:", metadata.MaxZoom)
+	}
+	if _, ok := metadata.JSON["vector_layers"]; !ok {
+		t.Error("JSON missing vector_layers")
+	}
+	if _, ok := metadata.JSON["name"]; ok {
+		t.Error("JSON contains typed metadata item name")
+	}
+
+	if len(metadata.VectorLayers) != 1 {
+		t.Fatal("VectorLayers does not have expected length, got:", metadata.VectorLayers)
+	}
+	layer := metadata.VectorLayers[0]
+	if layer.ID != "cities" || layer.MinZoom != 0 || layer.MaxZoom != 6 || layer.Fields["name"] != "String" {
+		t.Error("VectorLayer does not match expected values, got:", layer)
+	}
+}
+
+func Test_GetBounds(t *testing.T) {
+	db, err := Open("./testdata/geography-class-png.mbtiles")
+	if err != nil {
+		t.Fatal("Could not open mbtiles:", err)
+	}
+	defer db.Close()
+
+	bounds, present, err := db.GetBounds()
+	if err != nil {
+		t.Fatal("Unexpected error reading bounds:", err)
+	}
+	if !present {
+		t.Error("GetBounds did not find bounds in metadata")
+	}
+	if bounds != [4]float64{-180, -85.0511, 180, 85.0511} {
+		t.Error("Bounds do not match expected values, got:", bounds)
+	}
+}
+
+func Test_GetBounds_from_tiles(t *testing.T) {
+	// single tile in the northwest quadrant at zoom 1
+	path := createTestMBtiles(t, `
+		CREATE TABLE tiles (zoom_level integer, tile_column integer, tile_row integer, tile_data blob);
+		INSERT INTO tiles VALUES (0, 0, 0, x'89504e470d0a1a0a0000000d4948445200000100');
+		INSERT INTO tiles VALUES (1, 0, 1, x'89504e470d0a1a0a0000000d4948445200000100');
+	`)
+
+	db, err := Open(path)
+	if err != nil {
+		t.Fatal("Could not open:", path, err)
+	}
+	defer db.Close()
+
+	bounds, present, err := db.GetBounds()
+	if err != nil {
+		t.Fatal("Unexpected error reading bounds:", err)
+	}
+	if present {
+		t.Error("GetBounds reported bounds present in metadata")
+	}
+	expected := [4]float64{-180, 0, 0, maxMercatorLatitude}
+	for i := range expected {
+		if math.Abs(bounds[i]-expected[i]) > 1e-9 {
+			t.Error("Bounds", bounds, "do not match expected values", expected)
+			break
+		}
+	}
+}
+
+func Test_GetBounds_GetCenter_invalid_metadata(t *testing.T) {
+	// single tile in the northwest quadrant at zoom 1
+	path := createTestMBtiles(t, `
+		CREATE TABLE tiles (zoom_level integer, tile_column integer, tile_row integer, tile_data blob);
+		INSERT INTO tiles VALUES (1, 0, 1, x'89504e470d0a1a0a0000000d4948445200000100');
+		INSERT INTO metadata VALUES ('bounds', '-180,-95,180,95');
+		INSERT INTO metadata VALUES ('center', 'invalid');
+	`)
+
+	db, err := Open(path)
+	if err != nil {
+		t.Fatal("Could not open:", path, err)
+	}
+	defer db.Close()
+
+	bounds, present, err := db.GetBounds()
+	if err != nil {
+		t.Fatal("Unexpected error reading bounds:", err)
+	}
+	if present || bounds != [4]float64{-180, 0, 0, bounds[3]} {
+		t.Error("GetBounds did not calculate bounds from tiles for invalid bounds, got:", bounds, present)
+	}
+
+	center, present, err := db.GetCenter()
+	if err != nil {
+		t.Fatal("Unexpected error reading center:", err)
+	}
+	if present || center[0] != -90 || math.Abs(center[1]-maxMercatorLatitude/2) > 1e-9 || center[2] != 1 {
+		t.Error("GetCenter did not calculate center from tiles for invalid center, got:", center, present)
+	}
+}
+
+func Test_GetCenter(t *testing.T) {
+	tests := []struct {
+		path    string
+		present bool
+	}{
+		{path: "geography-class-png.mbtiles", present: true},
+		{path: "geography-class-png-missing-metadata.mbtiles", present: false},
+	}
+
+	for _, tc := range tests {
+		db, err := Open("./testdata/" + tc.path)
+		if err != nil {
+			t.Error("Could not open:", tc.path)
+			continue
+		}
+		defer db.Close()
+
+		center, present, err := db.GetCenter()
+		if err != nil {
+			t.Error("Unexpected error reading center for:", tc.path, err)
+			continue
+		}
+		if present != tc.present {
+			t.Error("GetCenter presence", present, "does not match expected value", tc.present, "for:", tc.path)
+		}
+		// missing center is calculated from the extent of the world tiles
+		if !present && (math.Abs(center[0]) > 1e-9 || math.Abs(center[1]) > 1e-9 || center[2] != 0) {
+			t.Error("GetCenter did not calculate center from tiles for:", tc.path, "got:", center)
+		}
+	}
+}
+
+func Test_ValidateMetadata(t *testing.T) {
+	tests := []struct {
+		path   string
+		errors []string
+	}{
+		{path: "./testdata/world_cities.mbtiles"},
+		{path: "./testdata/geography-class-png.mbtiles", errors: []string{"format is required"}},
+		{path: "./testdata/geography-class-png-missing-metadata.mbtiles", errors: []string{"format is required"}},
+		{path: createTestMBtiles(t, `
+			INSERT INTO metadata VALUES ('format', 'png'), ('bounds', '-200,10,20'), ('minzoom', '4'), ('maxzoom', '2');
+			CREATE TABLE tiles (zoom_level integer, tile_column integer, tile_row integer, tile_data blob);
+			INSERT INTO tiles VALUES (0, 0, 0, x'1f8b0800000000000000');
+		`), errors: []string{"does not match detected tile format", "bounds must have 4 values", "minzoom 4 is greater than maxzoom 2"}},
+		{path: createTestMBtiles(t, `
+			INSERT INTO metadata VALUES ('format', 'pbf'), ('bounds', '-200,10,20,30');
+			CREATE TABLE tiles (zoom_level integer, tile_column integer, tile_row integer, tile_data blob);
+			INSERT INTO tiles VALUES (0, 0, 0, x'1f8b0800000000000000');
+		`), errors: []string{"longitude outside"}},
+	}
+
+	for _, tc := range tests {
+		db, err := Open(tc.path)
+		if err != nil {
+			t.Fatal("Could not open:", tc.path, err)
+		}
+		defer db.Close()
+
+		err = db.ValidateMetadata()
+		if len(tc.errors) == 0 {
+			if err != nil {
+				t.Error("Unexpected error validating metadata for:", tc.path, err)
+			}
+			continue
+		}
+		if err == nil {
+			t.Error("ValidateMetadata did not raise error for:", tc.path)
+			continue
+		}
+		for _, expected := range tc.errors {
+			if !strings.Contains(err.Error(), expected) {
+				t.Error("Error", err, "does not contain expected value", expected, "for:", tc.path)
+			}
+		}
+	}
+}
+
+func Test_RepairMetadata(t *testing.T) {
+	// single tile in the northwest quadrant at zoom 1, with stale zoom levels
+	// and invalid bounds
+	path := createTestMBtiles(t, `
+		CREATE TABLE tiles (zoom_level integer, tile_column integer, tile_row integer, tile_data blob);
+		INSERT INTO tiles VALUES (0, 0, 0, x'89504e470d0a1a0a0000000d4948445200000100');
+		INSERT INTO tiles VALUES (1, 0, 1, x'89504e470d0a1a0a0000000d4948445200000100');
+		INSERT INTO metadata VALUES ('minzoom', '2');
+		INSERT INTO metadata VALUES ('maxzoom', '5');
+		INSERT INTO metadata VALUES ('bounds', 'invalid');
+		INSERT INTO metadata VALUES ('center', '-10,10,1');
+	`)
+
+	db, err := Open(path, WithFlags(sqlite.SQLITE_OPEN_READWRITE|sqlite.SQLITE_OPEN_NOMUTEX))
+	if err != nil {
+		t.Fatal("Could not open:", path, err)
+	}
+	defer db.Close()
+
+	written, err := db.RepairMetadata()
+	if err != nil {
+		t.Fatal("Unexpected error repairing metadata:", err)
+	}
+	if written["minzoom"] != "0" || written["maxzoom"] != "1" || written["format"] != "png" {
+		t.Error("RepairMetadata did not write expected values, got:", written)
+	}
+	if _, ok := written["center"]; ok {
+		t.Error("RepairMetadata replaced valid center")
+	}
+
+	metadata, err := db.GetMetadata()
+	if err != nil {
+		t.Fatal("Unexpected error reading metadata:", err)
+	}
+	if metadata.MinZoom != 0 || metadata.MaxZoom != 1 || metadata.Format != "png" {
+		t.Error("Repaired metadata do not match expected values, got:", metadata)
+	}
+	expected := [4]float64{-180, 0, 0, maxMercatorLatitude}
+	for i := range expected {
+		if math.Abs(metadata.Bounds[i]-expected[i]) > 1e-9 {
+			t.Error("Repaired bounds", metadata.Bounds, "do not match expected values", expected)
+			break
+		}
+	}
+	if metadata.Center != [3]float64{-10, 10, 1} {
+		t.Error("Center does not match original value, got:", metadata.Center)
+	}
+	if db.GetMinZoom() != 0 || db.GetMaxZoom() != 1 {
+		t.Error("RepairMetadata did not update cached zoom levels, got:", db.GetMinZoom(), db.GetMaxZoom())
+	}
+
+	ro, err := Open(path)
+	if err != nil {
+		t.Fatal("Could not open:", path, err)
+	}
+	defer ro.Close()
+	if _, err = ro.RepairMetadata(); err == nil {
+		t.Error("RepairMetadata did not raise error for database opened read-only")
+	}
+}
+
+func Test_GetSpecVersion(t *testing.T) {
+	tests := []struct {
+		path     string
+		expected string
+	}{
+		{path: "./testdata/world_cities.mbtiles", expected: "1.3"},
+		{path: "./testdata/geography-class-png.mbtiles", expected: "1.2"},
+		{path: createTestMBtiles(t, `
+			INSERT INTO metadata VALUES ('format', 'png');
+			CREATE TABLE tiles (zoom_level integer, tile_column integer, tile_row integer, tile_data blob);
+			INSERT INTO tiles VALUES (0, 0, 0, x'89504e470d0a1a0a0000000d4948445200000100');
+		`), expected: "1.1"},
+		{path: createTestMBtiles(t, `
+			CREATE TABLE tiles (zoom_level integer, tile_column integer, tile_row integer, tile_data blob);
+			INSERT INTO tiles VALUES (0, 0, 0, x'89504e470d0a1a0a0000000d4948445200000100');
+		`), expected: "1.0"},
+	}
+
+	for _, tc := range tests {
+		db, err := Open(tc.path)
+		if err != nil {
+			t.Fatal("Could not open:", tc.path, err)
+		}
+		defer db.Close()
+
+		version, err := db.GetSpecVersion()
+		if err != nil {
+			t.Error("Unexpected error detecting spec version for:", tc.path, err)
+			continue
+		}
+		if version != tc.expected {
+			t.Error("Spec version", version, "does not match expected value", tc.expected, "for:", tc.path)
+		}
+	}
+}
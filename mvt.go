@@ -0,0 +1,191 @@
+package mbtiles
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"math"
+)
+
+// This file decodes the parts of Mapbox Vector Tiles (protocol buffers) needed
+// to summarize their layers and attributes; geometries are not decoded.  See
+// https://github.com/mapbox/vector-tile-spec/blob/master/2.1/vector_tile.proto
+
+// Protocol buffer wire types
+const (
+	wireVarint  = 0
+	wireFixed64 = 1
+	wireBytes   = 2
+	wireFixed32 = 5
+)
+
+// mvtGeomTypes are the names of the GeomType enum values of vector tile
+// features.
+var mvtGeomTypes = map[uint64]string{1: "Point", 2: "LineString", 3: "Polygon"}
+
+// mvtLayer is a layer of a vector tile.
+type mvtLayer struct {
+	name     string
+	keys     []string
+	values   []interface{} // string, float64, or bool
+	features []mvtFeature
+}
+
+// mvtFeature is a feature of a vector tile layer.
+type mvtFeature struct {
+	geomType uint64
+	// tags are pairs of indexes into the keys and values of the layer
+	tags []uint64
+}
+
+// decodeMVT decodes the layers of an uncompressed vector tile.
+func decodeMVT(data []byte) ([]mvtLayer, error) {
+	var layers []mvtLayer
+	err := readProtoFields(data, func(field uint64, wireType uint64, value uint64, data []byte) error {
+		if field != 3 || wireType != wireBytes {
+			return nil
+		}
+		layer, err := decodeMVTLayer(data)
+		if err != nil {
+			return err
+		}
+		layers = append(layers, layer)
+		return nil
+	})
+	if err != nil {
+		return nil, fmt.Errorf("cannot decode vector tile: %w", err)
+	}
+	return layers, nil
+}
+
+// decodeMVTLayer decodes a vector tile layer message.
+func decodeMVTLayer(data []byte) (mvtLayer, error) {
+	var layer mvtLayer
+	err := readProtoFields(data, func(field uint64, wireType uint64, value uint64, data []byte) error {
+		switch {
+		case field == 1 && wireType == wireBytes:
+			layer.name = string(data)
+		case field == 2 && wireType == wireBytes:
+			feature, err := decodeMVTFeature(data)
+			if err != nil {
+				return err
+			}
+			layer.features = append(layer.features, feature)
+		case field == 3 && wireType == wireBytes:
+			layer.keys = append(layer.keys, string(data))
+		case field == 4 && wireType == wireBytes:
+			v, err := decodeMVTValue(data)
+			if err != nil {
+				return err
+			}
+			layer.values = append(layer.values, v)
+		}
+		return nil
+	})
+	return layer, err
+}
+
+// decodeMVTFeature decodes the type and tags of a vector tile feature message.
+func decodeMVTFeature(data []byte) (mvtFeature, error) {
+	var feature mvtFeature
+	err := readProtoFields(data, func(field uint64, wireType uint64, value uint64, data []byte) error {
+		switch {
+		case field == 2 && wireType == wireBytes:
+			// packed repeated uint32
+			for len(data) > 0 {
+				tag, n := binary.Uvarint(data)
+				if n <= 0 {
+					return errors.New("invalid packed tags")
+				}
+				feature.tags = append(feature.tags, tag)
+				data = data[n:]
+			}
+		case field == 2 && wireType == wireVarint:
+			feature.tags = append(feature.tags, value)
+		case field == 3 && wireType == wireVarint:
+			feature.geomType = value
+		}
+		return nil
+	})
+	return feature, err
+}
+
+// decodeMVTValue decodes a vector tile value message to a string, float64, or
+// bool.
+func decodeMVTValue(data []byte) (interface{}, error) {
+	var v interface{}
+	err := readProtoFields(data, func(field uint64, wireType uint64, value uint64, data []byte) error {
+		switch field {
+		case 1:
+			v = string(data)
+		case 2:
+			v = float64(math.Float32frombits(uint32(value)))
+		case 3:
+			v = math.Float64frombits(value)
+		case 4:
+			v = float64(int64(value))
+		case 5:
+			v = float64(value)
+		case 6:
+			// zigzag encoded
+			v = float64(int64(value>>1) ^ -int64(value&1))
+		case 7:
+			v = value != 0
+		}
+		return nil
+	})
+	return v, err
+}
+
+// readProtoFields calls fn with each field of a protocol buffer message.
+// value is set for varint and fixed width fields, and data for length
+// delimited fields.
+func readProtoFields(buf []byte, fn func(field uint64, wireType uint64, value uint64, data []byte) error) error {
+	for len(buf) > 0 {
+		key, n := binary.Uvarint(buf)
+		if n <= 0 {
+			return errors.New("invalid field key")
+		}
+		buf = buf[n:]
+
+		var (
+			value uint64
+			data  []byte
+		)
+		wireType := key & 7
+		switch wireType {
+		case wireVarint:
+			value, n = binary.Uvarint(buf)
+			if n <= 0 {
+				return errors.New("invalid varint")
+			}
+			buf = buf[n:]
+		case wireFixed64:
+			if len(buf) < 8 {
+				return errors.New("truncated fixed64")
+			}
+			value = binary.LittleEndian.Uint64(buf)
+			buf = buf[8:]
+		case wireBytes:
+			length, n := binary.Uvarint(buf)
+			if n <= 0 || uint64(len(buf)-n) < length {
+				return errors.New("invalid length delimited field")
+			}
+			data = buf[n : n+int(length)]
+			buf = buf[n+int(length):]
+		case wireFixed32:
+			if len(buf) < 4 {
+				return errors.New("truncated fixed32")
+			}
+			value = uint64(binary.LittleEndian.Uint32(buf))
+			buf = buf[4:]
+		default:
+			return fmt.Errorf("unsupported wire type %d", wireType)
+		}
+
+		if err := fn(key>>3, wireType, value, data); err != nil {
+			return err
+		}
+	}
+	return nil
+}
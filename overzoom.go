@@ -0,0 +1,97 @@
+package mbtiles
+
+import (
+	"bytes"
+	"fmt"
+	"image"
+	"image/jpeg"
+	"image/png"
+)
+
+// ReadTileOverzoomScaled reads a tile for z, x, y.  If z is greater than
+// maxZoom, the tile is instead created by cropping the area covered by z, x, y
+// from its ancestor tile at maxZoom and scaling it up to the full tile size.
+// y is in the TMS scheme used by mbtiles, or the XYZ scheme if the XYZ option
+// is set, as for ReadTile.  Only PNG and JPG tilesets are supported; scaled
+// tiles are re-encoded in the same format.  Returns nil if the tile (or
+// ancestor tile) does not exist in the database.
+func (db *MBtiles) ReadTileOverzoomScaled(z int64, x int64, y int64, maxZoom int64) ([]byte, error) {
+	var data []byte
+	if z <= maxZoom {
+		err := db.ReadTile(z, x, y, &data)
+		return data, err
+	}
+
+	format := db.GetTileFormat()
+	if format != PNG && format != JPG {
+		return nil, fmt.Errorf("overzoom scaling is not supported for tile format: %q", format)
+	}
+
+	// number of tiles at z along each axis within the ancestor tile
+	d := z - maxZoom
+	if d > 30 {
+		return nil, fmt.Errorf("zoom level %d is too far above maxZoom %d to scale", z, maxZoom)
+	}
+	n := int64(1) << d
+
+	err := db.ReadTile(maxZoom, x>>d, y>>d, &data)
+	if err != nil || data == nil {
+		return nil, err
+	}
+
+	var src image.Image
+	if format == PNG {
+		src, err = png.Decode(bytes.NewReader(data))
+	} else {
+		src, err = jpeg.Decode(bytes.NewReader(data))
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	bounds := src.Bounds()
+	size := int64(bounds.Dx())
+	if size/n < 1 {
+		return nil, fmt.Errorf("zoom level %d is too far above maxZoom %d to scale", z, maxZoom)
+	}
+	cropSize := size / n
+
+	// image rows increase downward as XYZ rows do, but TMS rows increase upward
+	col := x % n
+	row := y % n
+	if !db.isXYZ(db.opts.XYZ) {
+		row = (n - 1) - row
+	}
+	crop := image.Rect(
+		bounds.Min.X+int(col*cropSize),
+		bounds.Min.Y+int(row*cropSize),
+		bounds.Min.X+int((col+1)*cropSize),
+		bounds.Min.Y+int((row+1)*cropSize),
+	)
+	scaled := scaleNearest(src, crop, int(size))
+
+	var buf bytes.Buffer
+	if format == PNG {
+		err = png.Encode(&buf, scaled)
+	} else {
+		err = jpeg.Encode(&buf, scaled, nil)
+	}
+	if err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+// scaleNearest scales the area of src within crop to a new size x size image
+// using nearest neighbor sampling.
+func scaleNearest(src image.Image, crop image.Rectangle, size int) *image.RGBA {
+	dst := image.NewRGBA(image.Rect(0, 0, size, size))
+	for dy := 0; dy < size; dy++ {
+		sy := crop.Min.Y + dy*crop.Dy()/size
+		for dx := 0; dx < size; dx++ {
+			sx := crop.Min.X + dx*crop.Dx()/size
+			dst.Set(dx, dy, src.At(sx, sy))
+		}
+	}
+	return dst
+}
@@ -0,0 +1,110 @@
+package mbtiles
+
+import (
+	"bytes"
+	"encoding/hex"
+	"image"
+	"image/color"
+	"image/png"
+	"testing"
+)
+
+func Test_ReadTileOverzoomScaled(t *testing.T) {
+	// 256px tile with a different color in each quadrant
+	quadrants := map[image.Point]color.RGBA{
+		{0, 0}: {255, 0, 0, 255}, // top left
+		{1, 0}: {0, 255, 0, 255}, // top right
+		{0, 1}: {0, 0, 255, 255}, // bottom left
+		{1, 1}: {255, 255, 0, 255},
+	}
+	img := image.NewRGBA(image.Rect(0, 0, 256, 256))
+	for p, c := range quadrants {
+		for y := p.Y * 128; y < (p.Y+1)*128; y++ {
+			for x := p.X * 128; x < (p.X+1)*128; x++ {
+				img.Set(x, y, c)
+			}
+		}
+	}
+	var buf bytes.Buffer
+	png.Encode(&buf, img)
+
+	path := createTestMBtiles(t, `
+		CREATE TABLE tiles (zoom_level integer, tile_column integer, tile_row integer, tile_data blob);
+		INSERT INTO tiles VALUES (0, 0, 0, x'`+hex.EncodeToString(buf.Bytes())+`');
+	`)
+
+	db, err := Open(path)
+	if err != nil {
+		t.Fatal("Could not open:", path, err)
+	}
+	defer db.Close()
+
+	tests := []struct {
+		x     int64
+		y     int64 // TMS
+		color color.RGBA
+	}{
+		{x: 0, y: 1, color: quadrants[image.Point{0, 0}]},
+		{x: 1, y: 1, color: quadrants[image.Point{1, 0}]},
+		{x: 0, y: 0, color: quadrants[image.Point{0, 1}]},
+		{x: 1, y: 0, color: quadrants[image.Point{1, 1}]},
+	}
+
+	for _, tc := range tests {
+		data, err := db.ReadTileOverzoomScaled(1, tc.x, tc.y, 0)
+		if err != nil {
+			t.Error("Unexpected error reading scaled tile:", err)
+			continue
+		}
+		scaled, err := png.Decode(bytes.NewReader(data))
+		if err != nil {
+			t.Error("Could not decode scaled tile:", err)
+			continue
+		}
+		if scaled.Bounds().Dx() != 256 {
+			t.Error("Scaled tile size does not match expected value, got:", scaled.Bounds().Dx())
+		}
+		for _, p := range []image.Point{{0, 0}, {255, 255}} {
+			if c := color.RGBAModel.Convert(scaled.At(p.X, p.Y)); c != tc.color {
+				t.Error("Scaled tile", tc.x, tc.y, "color", c, "does not match expected value", tc.color)
+			}
+		}
+	}
+
+	// tiles at or below maxZoom are read directly
+	data, err := db.ReadTileOverzoomScaled(0, 0, 0, 0)
+	if err != nil || !bytes.Equal(data, buf.Bytes()) {
+		t.Error("ReadTileOverzoomScaled did not return original tile at maxZoom")
+	}
+
+	// y is in XYZ scheme with the XYZ option
+	xyzDB, err := Open(path, WithXYZ())
+	if err != nil {
+		t.Fatal("Could not open:", path, err)
+	}
+	defer xyzDB.Close()
+	data, err = xyzDB.ReadTileOverzoomScaled(1, 0, 0, 0)
+	if err != nil {
+		t.Fatal("Unexpected error reading scaled tile:", err)
+	}
+	scaled, err := png.Decode(bytes.NewReader(data))
+	if err != nil {
+		t.Fatal("Could not decode scaled tile:", err)
+	}
+	if c := color.RGBAModel.Convert(scaled.At(0, 0)); c != quadrants[image.Point{0, 0}] {
+		t.Error("Scaled XYZ tile color", c, "does not match expected value", quadrants[image.Point{0, 0}])
+	}
+}
+
+func Test_ReadTileOverzoomScaled_unsupported(t *testing.T) {
+	db, err := Open("./testdata/world_cities.mbtiles")
+	if err != nil {
+		t.Fatal("Could not open mbtiles:", err)
+	}
+	defer db.Close()
+
+	_, err = db.ReadTileOverzoomScaled(8, 0, 0, 6)
+	if err == nil {
+		t.Error("ReadTileOverzoomScaled did not raise error for PBF tileset")
+	}
+}
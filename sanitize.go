@@ -0,0 +1,154 @@
+package mbtiles
+
+import (
+	"html"
+	"regexp"
+	"slices"
+	"strings"
+)
+
+// sanitizedMetadataItems are the metadata items that are sanitized by the
+// SanitizeHTML option.
+var sanitizedMetadataItems = []string{"description", "attribution", "legend"}
+
+// allowedTags are the HTML elements kept by SanitizeHTML, with the attributes
+// allowed for each.
+var allowedTags = map[string][]string{
+	"a":      {"href", "title"},
+	"b":      nil,
+	"br":     nil,
+	"div":    {"class"},
+	"em":     nil,
+	"i":      nil,
+	"img":    {"src", "alt", "title", "width", "height"},
+	"li":     nil,
+	"ol":     nil,
+	"p":      {"class"},
+	"small":  nil,
+	"span":   {"class"},
+	"strong": nil,
+	"sub":    nil,
+	"sup":    nil,
+	"table":  {"class"},
+	"tbody":  nil,
+	"td":     nil,
+	"th":     nil,
+	"thead":  nil,
+	"tr":     nil,
+	"u":      nil,
+	"ul":     nil,
+}
+
+// droppedTags are the HTML elements removed by SanitizeHTML along with their
+// content.
+var droppedTags = map[string]bool{"script": true, "style": true, "iframe": true, "object": true, "embed": true}
+
+var (
+	tagPattern       = regexp.MustCompile(`^<(/?)([a-zA-Z][a-zA-Z0-9]*)((?:\s+[^\s"'<>/=]+(?:\s*=\s*(?:"[^"]*"|'[^']*'|[^\s"'>]+))?)*)\s*/?>`)
+	attributePattern = regexp.MustCompile(`([^\s"'<>/=]+)(?:\s*=\s*(?:"([^"]*)"|'([^']*)'|([^\s"'>]+)))?`)
+)
+
+// SanitizeHTML removes all HTML elements and attributes from s except for a
+// small set used for formatting, links, and images, so that metadata from
+// untrusted sources can be displayed in web clients.  script, style, and
+// other embedded content are removed along with their content, as are
+// comments.  Links and image sources must use http, https, or mailto (links
+// only) URLs.  Text is otherwise unchanged.
+func SanitizeHTML(s string) string {
+	var out strings.Builder
+	for len(s) > 0 {
+		switch s[0] {
+		case '<':
+			if strings.HasPrefix(s, "<!--") {
+				end := strings.Index(s[4:], "-->")
+				if end < 0 {
+					return out.String()
+				}
+				s = s[4+end+3:]
+				continue
+			}
+
+			match := tagPattern.FindStringSubmatch(s)
+			if match == nil {
+				out.WriteString("&lt;")
+				s = s[1:]
+				continue
+			}
+			s = s[len(match[0]):]
+
+			closing, name := match[1] == "/", strings.ToLower(match[2])
+			if droppedTags[name] {
+				if !closing {
+					s = skipElement(s, name)
+				}
+				continue
+			}
+			attributes, ok := allowedTags[name]
+			if !ok {
+				continue
+			}
+			if closing {
+				out.WriteString("</" + name + ">")
+				continue
+			}
+			out.WriteString("<" + name)
+			writeAllowedAttributes(&out, attributes, match[3])
+			out.WriteString(">")
+		case '>':
+			out.WriteString("&gt;")
+			s = s[1:]
+		default:
+			out.WriteByte(s[0])
+			s = s[1:]
+		}
+	}
+	return out.String()
+}
+
+// skipElement returns s after the closing tag of the element name, or an empty
+// string if there is no closing tag.
+func skipElement(s string, name string) string {
+	lower := strings.ToLower(s)
+	end := strings.Index(lower, "</"+name)
+	if end < 0 {
+		return ""
+	}
+	gt := strings.IndexByte(s[end:], '>')
+	if gt < 0 {
+		return ""
+	}
+	return s[end+gt+1:]
+}
+
+// writeAllowedAttributes writes the attributes in attrs that are in allowed to
+// out, with their values escaped.
+func writeAllowedAttributes(out *strings.Builder, allowed []string, attrs string) {
+	for _, match := range attributePattern.FindAllStringSubmatch(attrs, -1) {
+		key := strings.ToLower(match[1])
+		if !slices.Contains(allowed, key) {
+			continue
+		}
+		value := html.UnescapeString(match[2] + match[3] + match[4])
+		if (key == "href" || key == "src") && !allowedURL(value, key == "href") {
+			continue
+		}
+		out.WriteString(" " + key + `="` + html.EscapeString(value) + `"`)
+	}
+}
+
+// allowedURL returns true if url uses the http or https scheme, or mailto if
+// allowMailto is true.
+func allowedURL(url string, allowMailto bool) bool {
+	url = strings.ToLower(strings.TrimSpace(url))
+	return strings.HasPrefix(url, "http://") || strings.HasPrefix(url, "https://") || (allowMailto && strings.HasPrefix(url, "mailto:"))
+}
+
+// sanitizeMetadata sanitizes the HTML of the sanitizedMetadataItems in
+// metadata.
+func sanitizeMetadata(metadata map[string]interface{}) {
+	for _, key := range sanitizedMetadataItems {
+		if value, ok := metadata[key].(string); ok {
+			metadata[key] = SanitizeHTML(value)
+		}
+	}
+}
@@ -0,0 +1,84 @@
+package mbtiles
+
+import (
+	"strings"
+	"testing"
+)
+
+func Test_SanitizeHTML(t *testing.T) {
+	tests := []struct {
+		html     string
+		expected string
+	}{
+		{html: "plain text", expected: "plain text"},
+		{html: `<a href="https://example.com" onclick="alert(1)">Example</a>`, expected: `<a href="https://example.com">Example</a>`},
+		{html: `<a href="javascript:alert(1)">link</a>`, expected: `<a>link</a>`},
+		{html: `<A HREF='mailto:test@example.com'>mail</A>`, expected: `<a href="mailto:test@example.com">mail</a>`},
+		{html: `<img src="data:image/png;base64,AAAA" alt="x">`, expected: `<img alt="x">`},
+		{html: `before<script>alert("x")</script>after`, expected: "beforeafter"},
+		{html: `<STYLE>body {}</style>text`, expected: "text"},
+		{html: `<!-- comment -->text`, expected: "text"},
+		{html: `<div class="a"><blink>text</blink><br/></div>`, expected: `<div class="a">text<br></div>`},
+		{html: `<span title="a&quot;b">x</span>`, expected: `<span>x</span>`},
+		{html: `1 < 2 > 0`, expected: `1 &lt; 2 &gt; 0`},
+		{html: `<p class="x" <script>alert(1)</script>`, expected: `&lt;p class="x" `},
+	}
+
+	for _, tc := range tests {
+		if out := SanitizeHTML(tc.html); out != tc.expected {
+			t.Error("SanitizeHTML returned", out, "expected", tc.expected, "for:", tc.html)
+		}
+	}
+}
+
+func Test_WithSanitizeHTML(t *testing.T) {
+	path := createTestMBtiles(t, `
+		CREATE TABLE tiles (zoom_level integer, tile_column integer, tile_row integer, tile_data blob);
+		INSERT INTO tiles VALUES (0, 0, 0, x'89504e470d0a1a0a0000000d4948445200000100');
+		INSERT INTO metadata VALUES ('description', '<b>bold</b><script>alert(1)</script>');
+		INSERT INTO metadata VALUES ('attribution', '<a href="javascript:alert(1)">x</a>');
+		INSERT INTO metadata VALUES ('legend', '<img src="x" onerror="alert(1)">');
+	`)
+
+	db, err := Open(path, WithSanitizeHTML())
+	if err != nil {
+		t.Fatal("Could not open:", path, err)
+	}
+	defer db.Close()
+
+	metadata, err := db.ReadMetadata()
+	if err != nil {
+		t.Fatal("Unexpected error reading metadata:", err)
+	}
+	for _, key := range []string{"description", "attribution", "legend"} {
+		value, _ := metadata[key].(string)
+		if strings.Contains(value, "alert") || strings.Contains(value, "javascript") {
+			t.Error("Metadata item", key, "was not sanitized, got:", value)
+		}
+	}
+	if metadata["description"] != "<b>bold</b>" {
+		t.Error("description does not match expected value, got:", metadata["description"])
+	}
+
+	_, description, err := db.NameAndDescription()
+	if err != nil || description != "<b>bold</b>" {
+		t.Error("NameAndDescription did not sanitize description, got:", description, err)
+	}
+	_, legend, err := db.TemplateAndLegend()
+	if err != nil || legend != "<img>" {
+		t.Error("TemplateAndLegend did not sanitize legend, got:", legend, err)
+	}
+
+	unsanitized, err := Open(path)
+	if err != nil {
+		t.Fatal("Could not open:", path, err)
+	}
+	defer unsanitized.Close()
+	metadata, err = unsanitized.ReadMetadata()
+	if err != nil {
+		t.Fatal("Unexpected error reading metadata:", err)
+	}
+	if !strings.Contains(metadata["description"].(string), "<script>") {
+		t.Error("description was sanitized without SanitizeHTML option")
+	}
+}
@@ -0,0 +1,98 @@
+package mbtiles
+
+import (
+	"context"
+	"errors"
+	"fmt"
+
+	"crawshaw.io/sqlite"
+	"crawshaw.io/sqlite/sqlitex"
+)
+
+// Snapshot provides a consistent, point-in-time view of an mbtiles file across
+// a batch of reads.  It holds a single connection from the pool inside a read
+// transaction until Close is called.
+type Snapshot struct {
+	db  *MBtiles
+	con *sqlite.Conn
+}
+
+// Snapshot opens a read transaction on a connection from the pool.  All reads
+// from the returned Snapshot see the same state of the database, even if the
+// file is updated in the meantime.  Close must be called to end the
+// transaction and release the connection; if the handle is rebound or closed
+// in the meantime, the Snapshot continues to read from the previous file.
+func (db *MBtiles) Snapshot(ctx context.Context) (*Snapshot, error) {
+	if db == nil {
+		return nil, fmt.Errorf("cannot read tile: %w", ErrDatabaseClosed)
+	}
+
+	con, err := db.getConnection(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	err = sqlitex.ExecTransient(con, "BEGIN", nil)
+	if err != nil {
+		db.closeConnection(con)
+		return nil, err
+	}
+
+	// SQLite defers starting the read transaction until the first read, so
+	// read now to fix the snapshot at this point in time
+	err = sqlitex.ExecTransient(con, "select count(*) from sqlite_master", nil)
+	if err != nil {
+		sqlitex.ExecTransient(con, "ROLLBACK", nil)
+		db.closeConnection(con)
+		return nil, err
+	}
+
+	return &Snapshot{db: db, con: con}, nil
+}
+
+// ReadTile reads a tile for z, x, y into the provided *[]byte, as for
+// MBtiles.ReadTile.  data will be nil if the tile does not exist in the
+// database, unless the TileNotFoundError option is set, in which case
+// ErrTileNotFound is returned.
+// If the AutoDecompress option is set, GZIP and ZLIB encoded tiles are
+// decompressed.
+func (s *Snapshot) ReadTile(z int64, x int64, y int64, data *[]byte) error {
+	if s == nil || s.con == nil {
+		return errors.New("cannot read tile from closed snapshot")
+	}
+	if s.db.opts.StrictCoordinates {
+		if err := validateTileCoord(z, x, y); err != nil {
+			return err
+		}
+	}
+
+	return s.db.readTileWithOptions(context.TODO(), s.con, z, x, y, s.db.opts.XYZ, data)
+}
+
+// ReadMetadata reads the metadata table into a map, casting their values into
+// the appropriate type
+func (s *Snapshot) ReadMetadata() (map[string]interface{}, error) {
+	if s == nil || s.con == nil {
+		return nil, errors.New("cannot read metadata from closed snapshot")
+	}
+	metadata, warnings, err := readMetadata(s.con, s.db.opts.LenientMetadata)
+	if err != nil {
+		return nil, err
+	}
+	s.db.logMetadataWarnings(warnings)
+	if s.db.opts.SanitizeHTML {
+		sanitizeMetadata(metadata)
+	}
+	return metadata, nil
+}
+
+// Close ends the read transaction and returns the connection to the pool.
+func (s *Snapshot) Close() error {
+	if s == nil || s.con == nil {
+		return nil
+	}
+	err := sqlitex.ExecTransient(s.con, "ROLLBACK", nil)
+	s.db.closeConnection(s.con)
+	s.con = nil
+	return err
+}
@@ -0,0 +1,108 @@
+package mbtiles
+
+import (
+	"context"
+	"errors"
+	"testing"
+)
+
+func Test_Snapshot(t *testing.T) {
+	db, err := Open("./testdata/geography-class-png.mbtiles")
+	if err != nil {
+		t.Fatal("Could not open mbtiles:", err)
+	}
+	defer db.Close()
+
+	snapshot, err := db.Snapshot(context.Background())
+	if err != nil {
+		t.Fatal("Could not create snapshot:", err)
+	}
+
+	metadata, err := snapshot.ReadMetadata()
+	if err != nil {
+		t.Error("Error raised when reading metadata:", err)
+	}
+	if metadata["name"] != "Geography Class" {
+		t.Error("Metadata name does not match expected value, got:", metadata["name"])
+	}
+
+	var data []byte
+	err = snapshot.ReadTile(0, 0, 0, &data)
+	if err != nil {
+		t.Error("Unexpected error reading tile:", err)
+	}
+	if len(data) != 21246 {
+		t.Error("ReadTile returned different number of bytes than expected, got:", len(data))
+	}
+
+	if err := snapshot.Close(); err != nil {
+		t.Error("Unexpected error closing snapshot:", err)
+	}
+
+	// closed snapshot should fail to read
+	if err := snapshot.ReadTile(0, 0, 0, &data); err == nil {
+		t.Error("Closed snapshot did not raise error on read")
+	}
+
+	// connection should be returned to the pool and be usable
+	if err := db.ReadTile(0, 0, 0, &data); err != nil {
+		t.Error("Unexpected error reading tile after closing snapshot:", err)
+	}
+}
+
+func Test_Snapshot_options(t *testing.T) {
+	db, err := Open("./testdata/geography-class-png.mbtiles", WithStrictCoordinates(), WithTileNotFoundError())
+	if err != nil {
+		t.Fatal("Could not open mbtiles:", err)
+	}
+	defer db.Close()
+
+	snapshot, err := db.Snapshot(context.Background())
+	if err != nil {
+		t.Fatal("Could not create snapshot:", err)
+	}
+	defer snapshot.Close()
+
+	var data []byte
+	if err := snapshot.ReadTile(1, 2, 0, &data); err == nil || errors.Is(err, ErrTileNotFound) {
+		t.Error("Snapshot did not raise error for invalid coordinates, got:", err)
+	}
+	if err := snapshot.ReadTile(10, 0, 0, &data); !errors.Is(err, ErrTileNotFound) {
+		t.Error("Snapshot did not return ErrTileNotFound for nonexistent tile, got:", err)
+	}
+}
+
+func Test_Snapshot_Rebind(t *testing.T) {
+	db, err := Open("./testdata/geography-class-png.mbtiles")
+	if err != nil {
+		t.Fatal("Could not open mbtiles:", err)
+	}
+	defer db.Close()
+
+	snapshot, err := db.Snapshot(context.Background())
+	if err != nil {
+		t.Fatal("Could not create snapshot:", err)
+	}
+
+	// metadata can be refreshed and the handle rebound and closed while the
+	// snapshot is open
+	if _, err := db.RefreshMetadata(); err != nil {
+		t.Error("Unexpected error refreshing metadata:", err)
+	}
+	if err := db.Rebind("./testdata/world_cities.mbtiles"); err != nil {
+		t.Fatal("Unexpected error rebinding:", err)
+	}
+	if db.GetTileFormat() != PBF {
+		t.Error("Tile format", db.GetTileFormat(), "does not match expected value", PBF)
+	}
+	db.Close()
+
+	// snapshot reads from the previous file until it is closed
+	var data []byte
+	if err := snapshot.ReadTile(0, 0, 0, &data); err != nil || len(data) != 21246 {
+		t.Error("Could not read tile from snapshot of previous file:", err)
+	}
+	if err := snapshot.Close(); err != nil {
+		t.Error("Unexpected error closing snapshot:", err)
+	}
+}
@@ -0,0 +1,196 @@
+package mbtiles
+
+import (
+	"context"
+	"database/sql"
+	"database/sql/driver"
+	"errors"
+	"fmt"
+	"io"
+
+	"crawshaw.io/sqlite"
+)
+
+// OpenSQL opens an MBtiles file for reading as a *sql.DB, so that the tiles and
+// metadata tables can be queried using standard SQL via database/sql.  The
+// file is validated in the same way as Open.  Connections are read-only.
+func OpenSQL(path string) (*sql.DB, error) {
+	if _, err := getModTime(path, false, false); err != nil {
+		return nil, err
+	}
+
+	con, err := sqlite.OpenConn(path, sqlite.SQLITE_OPEN_READONLY|sqlite.SQLITE_OPEN_NOMUTEX)
+	if err != nil {
+		return nil, err
+	}
+	defer con.Close()
+
+	err = validateRequiredTables(con)
+	if err != nil {
+		return nil, err
+	}
+
+	return sql.OpenDB(&sqlConnector{path: path}), nil
+}
+
+// sqlConnector implements driver.Connector for a read-only mbtiles file.
+type sqlConnector struct {
+	path string
+}
+
+func (c *sqlConnector) Connect(ctx context.Context) (driver.Conn, error) {
+	con, err := sqlite.OpenConn(c.path, sqlite.SQLITE_OPEN_READONLY|sqlite.SQLITE_OPEN_NOMUTEX)
+	if err != nil {
+		return nil, err
+	}
+	return &sqlConn{con: con}, nil
+}
+
+func (c *sqlConnector) Driver() driver.Driver {
+	return sqlDriver{}
+}
+
+// sqlDriver implements driver.Driver; connections are normally created via
+// sqlConnector instead.
+type sqlDriver struct{}
+
+func (sqlDriver) Open(name string) (driver.Conn, error) {
+	return (&sqlConnector{path: name}).Connect(context.Background())
+}
+
+// sqlConn implements driver.Conn around a single sqlite.Conn.
+type sqlConn struct {
+	con *sqlite.Conn
+}
+
+func (c *sqlConn) Prepare(query string) (driver.Stmt, error) {
+	stmt, trailing, err := c.con.PrepareTransient(query)
+	if err != nil {
+		return nil, err
+	}
+	if trailing > 0 {
+		stmt.Finalize()
+		return nil, errors.New("multiple SQL statements are not supported")
+	}
+	return &sqlStmt{stmt: stmt}, nil
+}
+
+func (c *sqlConn) Close() error {
+	return c.con.Close()
+}
+
+func (c *sqlConn) Begin() (driver.Tx, error) {
+	return nil, errors.New("transactions are not supported on read-only mbtiles database")
+}
+
+// sqlStmt implements driver.Stmt around a sqlite.Stmt.
+type sqlStmt struct {
+	stmt *sqlite.Stmt
+}
+
+func (s *sqlStmt) Close() error {
+	return s.stmt.Finalize()
+}
+
+func (s *sqlStmt) NumInput() int {
+	return s.stmt.BindParamCount()
+}
+
+// bind resets the statement and binds args to its parameters.
+func (s *sqlStmt) bind(args []driver.Value) error {
+	if err := s.stmt.Reset(); err != nil {
+		return err
+	}
+	if err := s.stmt.ClearBindings(); err != nil {
+		return err
+	}
+	for i, arg := range args {
+		// parameters are 1-indexed
+		param := i + 1
+		switch v := arg.(type) {
+		case nil:
+			s.stmt.BindNull(param)
+		case int64:
+			s.stmt.BindInt64(param, v)
+		case float64:
+			s.stmt.BindFloat(param, v)
+		case bool:
+			s.stmt.BindBool(param, v)
+		case []byte:
+			s.stmt.BindBytes(param, v)
+		case string:
+			s.stmt.BindText(param, v)
+		default:
+			return fmt.Errorf("unsupported argument type %T", arg)
+		}
+	}
+	return nil
+}
+
+func (s *sqlStmt) Exec(args []driver.Value) (driver.Result, error) {
+	if err := s.bind(args); err != nil {
+		return nil, err
+	}
+	for {
+		hasRow, err := s.stmt.Step()
+		if err != nil {
+			return nil, err
+		}
+		if !hasRow {
+			break
+		}
+	}
+	return driver.RowsAffected(0), nil
+}
+
+func (s *sqlStmt) Query(args []driver.Value) (driver.Rows, error) {
+	if err := s.bind(args); err != nil {
+		return nil, err
+	}
+	return &sqlRows{stmt: s.stmt}, nil
+}
+
+// sqlRows implements driver.Rows by stepping through a sqlite.Stmt.
+type sqlRows struct {
+	stmt *sqlite.Stmt
+}
+
+func (r *sqlRows) Columns() []string {
+	columns := make([]string, r.stmt.ColumnCount())
+	for i := range columns {
+		columns[i] = r.stmt.ColumnName(i)
+	}
+	return columns
+}
+
+func (r *sqlRows) Close() error {
+	return r.stmt.Reset()
+}
+
+func (r *sqlRows) Next(dest []driver.Value) error {
+	hasRow, err := r.stmt.Step()
+	if err != nil {
+		return err
+	}
+	if !hasRow {
+		return io.EOF
+	}
+
+	for i := range dest {
+		switch r.stmt.ColumnType(i) {
+		case sqlite.SQLITE_INTEGER:
+			dest[i] = r.stmt.ColumnInt64(i)
+		case sqlite.SQLITE_FLOAT:
+			dest[i] = r.stmt.ColumnFloat(i)
+		case sqlite.SQLITE_TEXT:
+			dest[i] = r.stmt.ColumnText(i)
+		case sqlite.SQLITE_BLOB:
+			data := make([]byte, r.stmt.ColumnLen(i))
+			r.stmt.ColumnBytes(i, data)
+			dest[i] = data
+		default:
+			dest[i] = nil
+		}
+	}
+	return nil
+}
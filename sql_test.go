@@ -0,0 +1,71 @@
+package mbtiles
+
+import (
+	"strings"
+	"testing"
+)
+
+func Test_OpenSQL(t *testing.T) {
+	db, err := OpenSQL("./testdata/geography-class-png.mbtiles")
+	if err != nil {
+		t.Fatal("Could not open:", err)
+	}
+	defer db.Close()
+
+	var name string
+	err = db.QueryRow("select value from metadata where name = ?", "name").Scan(&name)
+	if err != nil {
+		t.Error("Error querying metadata:", err)
+	}
+	if name != "Geography Class" {
+		t.Error("Metadata name does not match expected value, got:", name)
+	}
+
+	var data []byte
+	err = db.QueryRow("select tile_data from tiles where zoom_level = ? and tile_column = ? and tile_row = ?", 0, 0, 0).Scan(&data)
+	if err != nil {
+		t.Error("Error querying tile:", err)
+	}
+	if len(data) != 21246 {
+		t.Error("Tile has different number of bytes than expected, got:", len(data))
+	}
+
+	rows, err := db.Query("select zoom_level, count(*) from tiles group by zoom_level order by zoom_level")
+	if err != nil {
+		t.Fatal("Error querying tiles:", err)
+	}
+	defer rows.Close()
+
+	var counts []int64
+	for rows.Next() {
+		var zoom, count int64
+		if err := rows.Scan(&zoom, &count); err != nil {
+			t.Fatal("Error scanning row:", err)
+		}
+		counts = append(counts, count)
+	}
+	if len(counts) != 2 || counts[0] != 1 || counts[1] != 4 {
+		t.Error("Tile counts per zoom do not match expected values, got:", counts)
+	}
+}
+
+func Test_OpenSQL_invalid(t *testing.T) {
+	tests := []struct {
+		path string
+		err  string
+	}{
+		{path: "invalid.mbtiles", err: "missing one or more required tables: tiles, metadata"},
+		{path: "does-not-exist.mbtiles", err: "path does not exist"},
+	}
+	for _, tc := range tests {
+		db, err := OpenSQL("./testdata/" + tc.path)
+		if err == nil {
+			db.Close()
+			t.Error("Invalid mbtiles did not raise error on open:", tc.path)
+			continue
+		}
+		if !strings.Contains(err.Error(), tc.err) {
+			t.Error("Invalid mbtiles did not raise expected error:", tc.path, ", instead raised: ", err)
+		}
+	}
+}
@@ -0,0 +1,77 @@
+package mbtiles
+
+import (
+	"context"
+	"fmt"
+	"os"
+
+	"crawshaw.io/sqlite"
+	"crawshaw.io/sqlite/sqlitex"
+)
+
+// Stats summarizes the tiles in an mbtiles file.
+type Stats struct {
+	TileCount         int64
+	DistinctTileBlobs int64 // number of distinct tile data values
+	MinZoom           int
+	MaxZoom           int
+	FileSize          int64 // 0 for databases opened using OpenInMemory
+	TilesPerZoom      map[int64]int64
+}
+
+// Stats returns the number of tiles overall and at each zoom level, the number
+// of distinct tile data values, and the size of the mbtiles file.  Counting
+// distinct tile data reads all tiles, so this may be slow for large files.
+func (db *MBtiles) Stats() (*Stats, error) {
+	if db == nil {
+		return nil, fmt.Errorf("cannot read tile: %w", ErrDatabaseClosed)
+	}
+
+	db.mu.RLock()
+	filename, inMemory := db.filename, db.inMemory
+	db.mu.RUnlock()
+
+	var fileSize int64
+	if !inMemory {
+		info, err := os.Stat(filename)
+		if err != nil {
+			return nil, err
+		}
+		fileSize = info.Size()
+	}
+
+	con, err := db.getConnection(context.TODO())
+	defer db.closeConnection(con)
+	if err != nil {
+		return nil, err
+	}
+
+	stats := &Stats{
+		FileSize:     fileSize,
+		TilesPerZoom: make(map[int64]int64),
+	}
+
+	err = sqlitex.Exec(con, "select zoom_level, count(*) from tiles group by zoom_level order by zoom_level", func(stmt *sqlite.Stmt) error {
+		z, count := stmt.ColumnInt64(0), stmt.ColumnInt64(1)
+		if len(stats.TilesPerZoom) == 0 {
+			stats.MinZoom = int(z)
+		}
+		stats.MaxZoom = int(z)
+		stats.TilesPerZoom[z] = count
+		stats.TileCount += count
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	err = sqlitex.Exec(con, "select count(distinct tile_data) from tiles", func(stmt *sqlite.Stmt) error {
+		stats.DistinctTileBlobs = stmt.ColumnInt64(0)
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return stats, nil
+}
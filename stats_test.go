@@ -0,0 +1,53 @@
+package mbtiles
+
+import (
+	"testing"
+)
+
+func Test_Stats(t *testing.T) {
+	db, err := Open("./testdata/world_cities.mbtiles")
+	if err != nil {
+		t.Fatal("Could not open mbtiles:", err)
+	}
+	defer db.Close()
+
+	stats, err := db.Stats()
+	if err != nil {
+		t.Fatal("Unexpected error reading stats:", err)
+	}
+
+	if stats.TileCount != 196 {
+		t.Error("TileCount", stats.TileCount, "does not match expected value: 196")
+	}
+	if stats.DistinctTileBlobs != 196 {
+		t.Error("DistinctTileBlobs", stats.DistinctTileBlobs, "does not match expected value: 196")
+	}
+	if stats.MinZoom != 0 || stats.MaxZoom != 6 {
+		t.Error("Zoom range", stats.MinZoom, stats.MaxZoom, "does not match expected value: 0 6")
+	}
+	if stats.FileSize != 49152 {
+		t.Error("FileSize", stats.FileSize, "does not match expected value: 49152")
+	}
+	if len(stats.TilesPerZoom) != 7 || stats.TilesPerZoom[6] != 72 {
+		t.Error("TilesPerZoom", stats.TilesPerZoom, "does not match expected value")
+	}
+}
+
+func Test_Stats_InMemory(t *testing.T) {
+	db, err := OpenInMemory("./testdata/geography-class-png.mbtiles")
+	if err != nil {
+		t.Fatal("Could not open mbtiles:", err)
+	}
+	defer db.Close()
+
+	stats, err := db.Stats()
+	if err != nil {
+		t.Fatal("Unexpected error reading stats:", err)
+	}
+	if stats.FileSize != 0 {
+		t.Error("FileSize", stats.FileSize, "is not 0 for in-memory database")
+	}
+	if stats.TileCount != 5 {
+		t.Error("TileCount", stats.TileCount, "does not match expected value: 5")
+	}
+}
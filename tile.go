@@ -2,9 +2,12 @@ package mbtiles
 
 import (
 	"bytes"
+	"compress/gzip"
+	"compress/zlib"
 	"encoding/binary"
 	"errors"
 	"image/jpeg"
+	"io"
 )
 
 // TileFormat defines the tile format of tiles an mbtiles file.  Supported image
@@ -12,6 +15,7 @@ import (
 //   - PNG
 //   - JPG
 //   - WEBP
+//   - AVIF
 //   - PBF  (vector tile protocol buffers)
 //
 // Tiles may be compressed, in which case the type is one of:
@@ -28,6 +32,7 @@ const (
 	JPG
 	PBF
 	WEBP
+	AVIF
 )
 
 // String returns a string representing the TileFormat.
@@ -41,6 +46,8 @@ func (t TileFormat) String() string {
 		return "pbf"
 	case WEBP:
 		return "webp"
+	case AVIF:
+		return "avif"
 	case GZIP:
 		return "gzip"
 	default:
@@ -59,6 +66,8 @@ func (t TileFormat) MimeType() string {
 		return "application/x-protobuf" // Content-Encoding header must be gzip
 	case WEBP:
 		return "image/webp"
+	case AVIF:
+		return "image/avif"
 	default:
 		return ""
 	}
@@ -85,9 +94,25 @@ func detectTileFormat(data []byte) (TileFormat, error) {
 		}
 	}
 
+	// AVIF begins with an ftyp box of variable size, so cannot be detected
+	// by prefix
+	if isAVIF(data) {
+		return AVIF, nil
+	}
+
 	return UNKNOWN, errors.New("could not detect tile format")
 }
 
+// isAVIF returns true if data begins with an ISO-BMFF ftyp box with a major
+// brand of avif (image) or avis (image sequence).
+func isAVIF(data []byte) bool {
+	if len(data) < 12 || !bytes.Equal(data[4:8], []byte("ftyp")) {
+		return false
+	}
+	brand := data[8:12]
+	return bytes.Equal(brand, []byte("avif")) || bytes.Equal(brand, []byte("avis"))
+}
+
 // detectTileSize reads tile dimensions from image tiles, and otherwise assumes
 // 512px size for PBF tiles.  Tiles are assumed to be square.
 // Data must contain at least the first 20 bytes of the beginning of a tile.
@@ -132,15 +157,65 @@ func detectTileSize(format TileFormat, data []byte) (uint32, error) {
 
 			return uint32(binary.LittleEndian.Uint16(data[21:23])&0x1ff) + 1, nil
 
-		case bytes.HasPrefix(encType, []byte("VP8X")): // Alpha
-			// width is in 24 bits out of bytes 24-26
+		case bytes.HasPrefix(encType, []byte("VP8X")): // Extended (e.g., alpha)
+			// canvas width minus one is a 24 bit little endian integer in
+			// bytes 24-26
 			if len(data) < 27 {
 				return 0, errors.New("insufficient length to detect webp image size")
 			}
 
-			return uint32(binary.LittleEndian.Uint16(data[24:27])) + 1, nil
+			return (uint32(data[24]) | uint32(data[25])<<8 | uint32(data[26])<<16) + 1, nil
 		}
+	case AVIF:
+		// width is stored in the image spatial extents (ispe) property box:
+		// 4 byte box type, 4 byte version and flags, 4 byte width, 4 byte height
+		i := bytes.Index(data, []byte("ispe"))
+		if i < 0 || len(data) < i+12 {
+			return 0, errors.New("insufficient length to detect avif image size")
+		}
+		return binary.BigEndian.Uint32(data[i+8 : i+12]), nil
 	}
 
 	return 0, nil
 }
+
+// decompressTile decompresses GZIP or ZLIB encoded tile data.  Data in any other
+// format (including nil) is returned unmodified.  Returns an error rather than
+// partial data if the compressed data are corrupt.
+func decompressTile(data []byte) ([]byte, error) {
+	var (
+		r   io.ReadCloser
+		err error
+	)
+	switch {
+	case bytes.HasPrefix(data, formatPrefixes[GZIP]):
+		r, err = gzip.NewReader(bytes.NewReader(data))
+	case bytes.HasPrefix(data, formatPrefixes[ZLIB]):
+		r, err = zlib.NewReader(bytes.NewReader(data))
+	default:
+		return data, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	defer r.Close()
+
+	out, err := io.ReadAll(r)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+// compressZlib compresses data using zlib.
+func compressZlib(data []byte) ([]byte, error) {
+	var buf bytes.Buffer
+	w := zlib.NewWriter(&buf)
+	if _, err := w.Write(data); err != nil {
+		return nil, err
+	}
+	if err := w.Close(); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
@@ -1,6 +1,9 @@
 package mbtiles
 
 import (
+	"bytes"
+	"compress/gzip"
+	"compress/zlib"
 	"encoding/hex"
 	"testing"
 )
@@ -38,6 +41,10 @@ func Test_DetectTileFormat(t *testing.T) {
 			// is detected as a GZIP and handled as a PBF later
 			data: "1f8b0800000000000203", format: GZIP,
 		},
+		{
+			// AVIF, ftyp box of a 256px AVIF image
+			data: "0000001c667479706176696600000000617669666d6966316d696166", format: AVIF,
+		},
 	}
 
 	for _, tc := range tests {
@@ -87,10 +94,20 @@ func Test_DetectTilesize(t *testing.T) {
 			// first 27 bytes of https://www.gstatic.com/webp/gallery3/1_webp_a.webp
 			format: WEBP, data: "52494646ce46000057454250565038580a000000100000008f0100", tilesize: 400,
 		},
+		{
+			// Extended webp with a canvas width that requires all 24 bits
+			// first 27 bytes of Alpha webp above, with width set to 65537
+			format: WEBP, data: "52494646ce46000057454250565038580a00000010000000000001", tilesize: 65537,
+		},
 		{
 			// PBF, first 10 bytes of tile 0/0/0 in world_cities.mbtiles
 			format: PBF, data: "1f8b0800000000000203", tilesize: 512,
 		},
+		{
+			// AVIF, ftyp box followed by ispe property box of a 256px AVIF
+			// image; the intervening meta boxes are omitted
+			format: AVIF, data: "0000001c667479706176696600000000617669666d6966316d6961660000001469737065000000000000010000000100", tilesize: 256,
+		},
 	}
 
 	for _, tc := range tests {
@@ -108,3 +125,48 @@ func Test_DetectTilesize(t *testing.T) {
 		}
 	}
 }
+
+func Test_DecompressTile(t *testing.T) {
+	var gzipped bytes.Buffer
+	gw := gzip.NewWriter(&gzipped)
+	gw.Write([]byte("tile"))
+	gw.Close()
+
+	var zlibbed bytes.Buffer
+	zw := zlib.NewWriter(&zlibbed)
+	zw.Write([]byte("tile"))
+	zw.Close()
+
+	png, _ := hex.DecodeString("89504e470d0a1a0a0000000d4948445200000100")
+
+	tests := []struct {
+		data     []byte
+		expected []byte
+	}{
+		{data: gzipped.Bytes(), expected: []byte("tile")},
+		{data: zlibbed.Bytes(), expected: []byte("tile")},
+		// image tiles are not modified
+		{data: png, expected: png},
+		{data: nil, expected: nil},
+	}
+
+	for _, tc := range tests {
+		data, err := decompressTile(tc.data)
+		if err != nil {
+			t.Error("Error decompressing tile:", err)
+			continue
+		}
+		if !bytes.Equal(data, tc.expected) {
+			t.Error("Decompressed tile", data, "does not match expected value", tc.expected)
+		}
+	}
+}
+
+func Test_TileFormat_AVIF(t *testing.T) {
+	if AVIF.String() != "avif" {
+		t.Error("AVIF String does not match expected value, got:", AVIF.String())
+	}
+	if AVIF.MimeType() != "image/avif" {
+		t.Error("AVIF MimeType does not match expected value, got:", AVIF.MimeType())
+	}
+}
@@ -0,0 +1,144 @@
+package mbtiles
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/url"
+	"strconv"
+	"strings"
+)
+
+// TileJSONOption sets an option for TileJSON and MarshalTileJSON.
+type TileJSONOption func(*tileJSONOptions)
+
+type tileJSONOptions struct {
+	version     string
+	scheme      string
+	gridURLs    []string
+	queryParams url.Values
+}
+
+// WithTileJSONVersion3 creates a TileJSON 3.0.0 document, which includes
+// fillzoom from the metadata, if present.
+func WithTileJSONVersion3() TileJSONOption {
+	return func(o *tileJSONOptions) {
+		o.version = "3.0.0"
+	}
+}
+
+// WithTileJSONScheme sets the scheme of the tile URLs, "xyz" or "tms".  By
+// default, scheme is omitted, which TileJSON consumers treat as "xyz".
+func WithTileJSONScheme(scheme string) TileJSONOption {
+	return func(o *tileJSONOptions) {
+		o.scheme = scheme
+	}
+}
+
+// WithGridURLs sets the UTFGrid URLs of the document, for tilesets that
+// include UTFGrid interactivity.
+func WithGridURLs(urls ...string) TileJSONOption {
+	return func(o *tileJSONOptions) {
+		o.gridURLs = urls
+	}
+}
+
+// WithQueryParams appends params (e.g., an API key) to the query string of
+// each tile and grid URL.
+func WithQueryParams(params url.Values) TileJSONOption {
+	return func(o *tileJSONOptions) {
+		o.queryParams = params
+	}
+}
+
+// TileJSON creates a TileJSON 2.2.0 document from the metadata, with tiles set
+// to tileURLs.  minzoom and maxzoom are inferred from the tiles table if not
+// present in the metadata.  For PBF tilesets, vector_layers is included from the
+// 'json' metadata item.  legend and template are included from the metadata, if
+// present.
+func (db *MBtiles) TileJSON(tileURLs []string, opts ...TileJSONOption) (map[string]interface{}, error) {
+	options := tileJSONOptions{version: "2.2.0"}
+	for _, opt := range opts {
+		opt(&options)
+	}
+	if options.scheme != "" && options.scheme != "xyz" && options.scheme != "tms" {
+		return nil, fmt.Errorf("scheme must be one of xyz, tms, got: %q", options.scheme)
+	}
+
+	metadata, err := db.ReadMetadata()
+	if err != nil {
+		return nil, err
+	}
+
+	tilejson := map[string]interface{}{
+		"tilejson": options.version,
+		"tiles":    appendQueryParams(tileURLs, options.queryParams),
+	}
+	for _, key := range []string{"name", "description", "attribution", "version", "bounds", "center", "minzoom", "maxzoom", "legend", "template"} {
+		if value, ok := metadata[key]; ok {
+			tilejson[key] = value
+		}
+	}
+	if options.scheme != "" {
+		tilejson["scheme"] = options.scheme
+	}
+	if len(options.gridURLs) > 0 {
+		tilejson["grids"] = appendQueryParams(options.gridURLs, options.queryParams)
+	}
+	if options.version == "3.0.0" {
+		if value, ok := metadata["fillzoom"].(string); ok {
+			fillzoom, err := strconv.Atoi(value)
+			if err != nil {
+				return nil, fmt.Errorf("cannot read metadata item fillzoom: %v", err)
+			}
+			tilejson["fillzoom"] = fillzoom
+		}
+	}
+
+	if db.GetTileFormat() == PBF {
+		if layers, ok := metadata["vector_layers"]; ok {
+			tilejson["vector_layers"] = layers
+		}
+	}
+
+	return tilejson, nil
+}
+
+// appendQueryParams returns a copy of urls with params appended to the query
+// string of each.
+func appendQueryParams(urls []string, params url.Values) []string {
+	if len(params) == 0 {
+		return urls
+	}
+	query := params.Encode()
+	out := make([]string, len(urls))
+	for i, u := range urls {
+		sep := "?"
+		if strings.Contains(u, "?") {
+			sep = "&"
+		}
+		out[i] = u + sep + query
+	}
+	return out
+}
+
+// MarshalTileJSON creates a TileJSON document as for TileJSON using opts,
+// encoded as JSON, with a single tile URL template formed from baseURL, e.g.,
+// "https://example.com/tiles" becomes
+// "https://example.com/tiles/{z}/{x}/{y}.png" for a PNG tileset.
+func (db *MBtiles) MarshalTileJSON(baseURL string, opts ...TileJSONOption) ([]byte, error) {
+	if baseURL == "" {
+		return nil, errors.New("baseURL must not be empty")
+	}
+	ext := db.GetTileFormat().String()
+	if ext == "" {
+		return nil, errors.New("cannot create tile URL for unknown tile format")
+	}
+
+	tileURL := strings.TrimSuffix(baseURL, "/") + "/{z}/{x}/{y}." + ext
+	tilejson, err := db.TileJSON([]string{tileURL}, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return json.Marshal(tilejson)
+}
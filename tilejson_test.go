@@ -0,0 +1,150 @@
+package mbtiles
+
+import (
+	"encoding/json"
+	"net/url"
+	"testing"
+)
+
+func Test_TileJSON(t *testing.T) {
+	tiles := []string{"https://example.com/{z}/{x}/{y}.pbf"}
+
+	db, err := Open("./testdata/world_cities.mbtiles")
+	if err != nil {
+		t.Fatal("Could not open mbtiles:", err)
+	}
+	defer db.Close()
+
+	tilejson, err := db.TileJSON(tiles)
+	if err != nil {
+		t.Fatal("Unexpected error creating TileJSON:", err)
+	}
+
+	if tilejson["tilejson"] != "2.2.0" {
+		t.Error("tilejson version does not match expected value, got:", tilejson["tilejson"])
+	}
+	if urls, ok := tilejson["tiles"].([]string); !ok || len(urls) != 1 || urls[0] != tiles[0] {
+		t.Error("tiles do not match expected value, got:", tilejson["tiles"])
+	}
+	if tilejson["maxzoom"] != 6 {
+		t.Error("maxzoom does not match expected value, got:", tilejson["maxzoom"])
+	}
+	if _, ok := tilejson["vector_layers"]; !ok {
+		t.Error("TileJSON missing vector_layers for PBF tileset")
+	}
+	if _, ok := tilejson["format"]; ok {
+		t.Error("TileJSON contains metadata item that is not part of TileJSON: format")
+	}
+}
+
+func Test_TileJSON_missing_metadata(t *testing.T) {
+	db, err := Open("./testdata/geography-class-png-missing-metadata.mbtiles")
+	if err != nil {
+		t.Fatal("Could not open mbtiles:", err)
+	}
+	defer db.Close()
+
+	tilejson, err := db.TileJSON([]string{"https://example.com/{z}/{x}/{y}.png"})
+	if err != nil {
+		t.Fatal("Unexpected error creating TileJSON:", err)
+	}
+
+	// inferred from tiles table
+	if tilejson["minzoom"] != 0 || tilejson["maxzoom"] != 1 {
+		t.Error("zoom levels do not match expected values, got:", tilejson["minzoom"], tilejson["maxzoom"])
+	}
+	if _, ok := tilejson["vector_layers"]; ok {
+		t.Error("TileJSON contains vector_layers for PNG tileset")
+	}
+}
+
+func Test_MarshalTileJSON(t *testing.T) {
+	db, err := Open("./testdata/world_cities.mbtiles")
+	if err != nil {
+		t.Fatal("Could not open mbtiles:", err)
+	}
+	defer db.Close()
+
+	data, err := db.MarshalTileJSON("https://example.com/tiles/")
+	if err != nil {
+		t.Fatal("Unexpected error creating TileJSON:", err)
+	}
+
+	var tilejson struct {
+		TileJSON     string        `json:"tilejson"`
+		Tiles        []string      `json:"tiles"`
+		MaxZoom      int           `json:"maxzoom"`
+		Bounds       []float64     `json:"bounds"`
+		VectorLayers []VectorLayer `json:"vector_layers"`
+	}
+	if err = json.Unmarshal(data, &tilejson); err != nil {
+		t.Fatal("TileJSON is not valid JSON:", err)
+	}
+	if tilejson.TileJSON != "2.2.0" || tilejson.MaxZoom != 6 || len(tilejson.Bounds) != 4 {
+		t.Error("TileJSON does not match expected values, got:", string(data))
+	}
+	if len(tilejson.Tiles) != 1 || tilejson.Tiles[0] != "https://example.com/tiles/{z}/{x}/{y}.pbf" {
+		t.Error("tiles do not match expected value, got:", tilejson.Tiles)
+	}
+	if len(tilejson.VectorLayers) != 1 || tilejson.VectorLayers[0].ID != "cities" {
+		t.Error("vector_layers do not match expected value, got:", tilejson.VectorLayers)
+	}
+
+	if _, err = db.MarshalTileJSON(""); err == nil {
+		t.Error("Empty baseURL did not raise error")
+	}
+}
+
+func Test_TileJSON_options(t *testing.T) {
+	path := createTestMBtiles(t, `
+		CREATE TABLE tiles (zoom_level integer, tile_column integer, tile_row integer, tile_data blob);
+		INSERT INTO tiles VALUES (0, 0, 0, x'89504e470d0a1a0a0000000d4948445200000100');
+		INSERT INTO metadata VALUES ('fillzoom', '3');
+		INSERT INTO metadata VALUES ('legend', '<div>legend</div>');
+	`)
+
+	db, err := Open(path)
+	if err != nil {
+		t.Fatal("Could not open:", path, err)
+	}
+	defer db.Close()
+
+	tilejson, err := db.TileJSON(
+		[]string{"https://a.example.com/{z}/{x}/{y}.png", "https://b.example.com/{z}/{x}/{y}.png?style=dark"},
+		WithTileJSONVersion3(),
+		WithTileJSONScheme("xyz"),
+		WithGridURLs("https://example.com/{z}/{x}/{y}.grid.json"),
+		WithQueryParams(url.Values{"key": {"secret"}}),
+	)
+	if err != nil {
+		t.Fatal("Unexpected error creating TileJSON:", err)
+	}
+
+	if tilejson["tilejson"] != "3.0.0" || tilejson["fillzoom"] != 3 || tilejson["scheme"] != "xyz" {
+		t.Error("TileJSON v3 fields do not match expected values, got:", tilejson)
+	}
+	if tilejson["legend"] != "<div>legend</div>" {
+		t.Error("legend does not match expected value, got:", tilejson["legend"])
+	}
+	tiles, _ := tilejson["tiles"].([]string)
+	if len(tiles) != 2 || tiles[0] != "https://a.example.com/{z}/{x}/{y}.png?key=secret" || tiles[1] != "https://b.example.com/{z}/{x}/{y}.png?style=dark&key=secret" {
+		t.Error("tiles do not match expected values, got:", tiles)
+	}
+	grids, _ := tilejson["grids"].([]string)
+	if len(grids) != 1 || grids[0] != "https://example.com/{z}/{x}/{y}.grid.json?key=secret" {
+		t.Error("grids do not match expected values, got:", grids)
+	}
+
+	// fillzoom is not part of TileJSON 2.2.0
+	tilejson, err = db.TileJSON([]string{"https://example.com/{z}/{x}/{y}.png"})
+	if err != nil {
+		t.Fatal("Unexpected error creating TileJSON:", err)
+	}
+	if _, ok := tilejson["fillzoom"]; ok {
+		t.Error("TileJSON 2.2.0 contains fillzoom")
+	}
+
+	if _, err = db.TileJSON(nil, WithTileJSONScheme("other")); err == nil {
+		t.Error("Invalid scheme did not raise error")
+	}
+}
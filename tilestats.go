@@ -0,0 +1,249 @@
+package mbtiles
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"sort"
+
+	"crawshaw.io/sqlite"
+	"crawshaw.io/sqlite/sqlitex"
+)
+
+// maxTilestatsValues is the maximum number of sample values listed for each
+// attribute, as in mapbox-geostats.
+const maxTilestatsValues = 100
+
+// Tilestats summarizes the layers and attributes of a vector tileset, in the
+// format produced by mapbox-geostats.
+type Tilestats struct {
+	LayerCount int          `json:"layerCount"`
+	Layers     []LayerStats `json:"layers"`
+}
+
+// LayerStats summarizes a layer of a vector tileset.
+type LayerStats struct {
+	Layer          string           `json:"layer"`
+	Count          int64            `json:"count"`    // number of features
+	Geometry       string           `json:"geometry"` // most common geometry type
+	AttributeCount int              `json:"attributeCount"`
+	Attributes     []AttributeStats `json:"attributes"`
+}
+
+// AttributeStats summarizes an attribute of the features in a layer.
+type AttributeStats struct {
+	Attribute string        `json:"attribute"`
+	Count     int           `json:"count"` // number of distinct values
+	Type      string        `json:"type"`  // string, number, boolean, or mixed
+	Values    []interface{} `json:"values"`
+	Min       *float64      `json:"min,omitempty"` // for number attributes
+	Max       *float64      `json:"max,omitempty"` // for number attributes
+}
+
+// layerStatsBuilder accumulates statistics for a layer.
+type layerStatsBuilder struct {
+	count      int64
+	geomTypes  map[string]int64
+	attributes map[string]*attributeStatsBuilder
+}
+
+// attributeStatsBuilder accumulates statistics for an attribute.
+type attributeStatsBuilder struct {
+	types    map[string]bool
+	distinct map[interface{}]bool
+	values   []interface{}
+	min, max float64
+	hasRange bool
+}
+
+// Tilestats scans the vector tiles at the maximum zoom level and summarizes
+// their layers and attributes.  Features that are split across tiles are
+// counted once per tile, so counts may exceed the number of features in the
+// source data.  Returns an error if the tileset is not PBF.
+func (db *MBtiles) Tilestats() (*Tilestats, error) {
+	if db == nil {
+		return nil, fmt.Errorf("cannot read tile: %w", ErrDatabaseClosed)
+	}
+	if format := db.GetTileFormat(); format != PBF && format != GZIP {
+		return nil, fmt.Errorf("tilestats require PBF tiles, got: %q", format)
+	}
+
+	con, err := db.getConnection(context.TODO())
+	defer db.closeConnection(con)
+	if err != nil {
+		return nil, err
+	}
+
+	layers := make(map[string]*layerStatsBuilder)
+	err = sqlitex.Exec(con, "select tile_data from tiles where zoom_level = (select max(zoom_level) from tiles)", func(stmt *sqlite.Stmt) error {
+		data := make([]byte, stmt.ColumnLen(0))
+		stmt.ColumnBytes(0, data)
+		data, err := decompressTile(data)
+		if err != nil {
+			return err
+		}
+		tileLayers, err := decodeMVT(data)
+		if err != nil {
+			return err
+		}
+		for _, layer := range tileLayers {
+			builder, ok := layers[layer.name]
+			if !ok {
+				builder = &layerStatsBuilder{
+					geomTypes:  make(map[string]int64),
+					attributes: make(map[string]*attributeStatsBuilder),
+				}
+				layers[layer.name] = builder
+			}
+			if err := builder.add(layer); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	stats := &Tilestats{LayerCount: len(layers), Layers: make([]LayerStats, 0, len(layers))}
+	for name, builder := range layers {
+		stats.Layers = append(stats.Layers, builder.build(name))
+	}
+	sort.Slice(stats.Layers, func(i, j int) bool {
+		return stats.Layers[i].Layer < stats.Layers[j].Layer
+	})
+	return stats, nil
+}
+
+// WriteTilestats calculates tilestats as for Tilestats and writes them to the
+// 'json' metadata item, preserving its other contents.  db must have been
+// opened for writing, using Create or the SQLITE_OPEN_READWRITE flag.
+func (db *MBtiles) WriteTilestats() error {
+	stats, err := db.Tilestats()
+	if err != nil {
+		return err
+	}
+
+	metadata, err := db.GetMetadata()
+	if err != nil {
+		return err
+	}
+	values := make(map[string]interface{})
+	if metadata.RawJSON != "" {
+		if err = json.Unmarshal([]byte(metadata.RawJSON), &values); err != nil {
+			return fmt.Errorf("unable to parse JSON metadata item: %v", err)
+		}
+	}
+	values["tilestats"] = stats
+
+	data, err := json.Marshal(values)
+	if err != nil {
+		return err
+	}
+	return db.WriteMetadata("json", string(data))
+}
+
+// add adds the features of layer to the statistics.
+func (b *layerStatsBuilder) add(layer mvtLayer) error {
+	for _, feature := range layer.features {
+		b.count++
+		if geomType, ok := mvtGeomTypes[feature.geomType]; ok {
+			b.geomTypes[geomType]++
+		}
+
+		if len(feature.tags)%2 != 0 {
+			return errors.New("cannot decode vector tile: feature tags must be pairs")
+		}
+		for i := 0; i < len(feature.tags); i += 2 {
+			k, v := feature.tags[i], feature.tags[i+1]
+			if k >= uint64(len(layer.keys)) || v >= uint64(len(layer.values)) {
+				return errors.New("cannot decode vector tile: feature tag out of range")
+			}
+			key := layer.keys[k]
+			attribute, ok := b.attributes[key]
+			if !ok {
+				attribute = &attributeStatsBuilder{
+					types:    make(map[string]bool),
+					distinct: make(map[interface{}]bool),
+				}
+				b.attributes[key] = attribute
+			}
+			attribute.add(layer.values[v])
+		}
+	}
+	return nil
+}
+
+// build returns the statistics for the layer name.
+func (b *layerStatsBuilder) build(name string) LayerStats {
+	stats := LayerStats{
+		Layer:          name,
+		Count:          b.count,
+		AttributeCount: len(b.attributes),
+		Attributes:     make([]AttributeStats, 0, len(b.attributes)),
+	}
+	var maxCount int64
+	for geomType, count := range b.geomTypes {
+		// ties are broken by name so that the result is stable
+		if count > maxCount || (count == maxCount && geomType < stats.Geometry) {
+			stats.Geometry, maxCount = geomType, count
+		}
+	}
+	for key, attribute := range b.attributes {
+		stats.Attributes = append(stats.Attributes, attribute.build(key))
+	}
+	sort.Slice(stats.Attributes, func(i, j int) bool {
+		return stats.Attributes[i].Attribute < stats.Attributes[j].Attribute
+	})
+	return stats
+}
+
+// add adds value to the statistics.
+func (b *attributeStatsBuilder) add(value interface{}) {
+	switch v := value.(type) {
+	case string:
+		b.types["string"] = true
+	case bool:
+		b.types["boolean"] = true
+	case float64:
+		b.types["number"] = true
+		if !b.hasRange || v < b.min {
+			b.min = v
+		}
+		if !b.hasRange || v > b.max {
+			b.max = v
+		}
+		b.hasRange = true
+	default:
+		return
+	}
+
+	if b.distinct[value] {
+		return
+	}
+	b.distinct[value] = true
+	if len(b.values) < maxTilestatsValues {
+		b.values = append(b.values, value)
+	}
+}
+
+// build returns the statistics for the attribute key.
+func (b *attributeStatsBuilder) build(key string) AttributeStats {
+	stats := AttributeStats{
+		Attribute: key,
+		Count:     len(b.distinct),
+		Type:      "mixed",
+		Values:    b.values,
+	}
+	if len(b.types) == 1 {
+		for t := range b.types {
+			stats.Type = t
+		}
+	}
+	if b.hasRange {
+		min, max := b.min, b.max
+		stats.Min, stats.Max = &min, &max
+	}
+	return stats
+}
@@ -0,0 +1,72 @@
+package mbtiles
+
+import (
+	"path/filepath"
+	"testing"
+	"time"
+
+	"crawshaw.io/sqlite"
+)
+
+func Test_Tilestats(t *testing.T) {
+	db, err := Open("./testdata/world_cities.mbtiles")
+	if err != nil {
+		t.Fatal("Could not open mbtiles:", err)
+	}
+	defer db.Close()
+
+	stats, err := db.Tilestats()
+	if err != nil {
+		t.Fatal("Unexpected error calculating tilestats:", err)
+	}
+	if stats.LayerCount != 1 || len(stats.Layers) != 1 {
+		t.Fatal("Tilestats does not have expected number of layers, got:", stats)
+	}
+	layer := stats.Layers[0]
+	if layer.Layer != "cities" || layer.Geometry != "Point" || layer.Count < 68 {
+		t.Error("Layer stats do not match expected values, got:", layer)
+	}
+	if layer.AttributeCount != 1 || len(layer.Attributes) != 1 {
+		t.Fatal("Layer stats do not have expected number of attributes, got:", layer.Attributes)
+	}
+	attribute := layer.Attributes[0]
+	if attribute.Attribute != "name" || attribute.Type != "string" || attribute.Count != 68 || len(attribute.Values) != 68 {
+		t.Error("Attribute stats do not match expected values, got:", attribute.Attribute, attribute.Type, attribute.Count, len(attribute.Values))
+	}
+
+	png, err := Open("./testdata/geography-class-png.mbtiles")
+	if err != nil {
+		t.Fatal("Could not open mbtiles:", err)
+	}
+	defer png.Close()
+	if _, err = png.Tilestats(); err == nil {
+		t.Error("Tilestats did not raise error for PNG tileset")
+	}
+}
+
+func Test_WriteTilestats(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "world_cities.mbtiles")
+	replaceTestFile(t, "./testdata/world_cities.mbtiles", path, time.Now())
+
+	db, err := Open(path, WithFlags(sqlite.SQLITE_OPEN_READWRITE|sqlite.SQLITE_OPEN_NOMUTEX))
+	if err != nil {
+		t.Fatal("Could not open:", path, err)
+	}
+	defer db.Close()
+
+	if err = db.WriteTilestats(); err != nil {
+		t.Fatal("Unexpected error writing tilestats:", err)
+	}
+
+	metadata, err := db.GetMetadata()
+	if err != nil {
+		t.Fatal("Unexpected error reading metadata:", err)
+	}
+	tilestats, ok := metadata.JSON["tilestats"].(map[string]interface{})
+	if !ok || tilestats["layerCount"] != float64(1) {
+		t.Error("tilestats were not written to json metadata, got:", metadata.JSON["tilestats"])
+	}
+	if len(metadata.VectorLayers) != 1 {
+		t.Error("vector_layers were not preserved in json metadata")
+	}
+}
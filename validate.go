@@ -0,0 +1,234 @@
+package mbtiles
+
+import (
+	"context"
+	"fmt"
+	"strings"
+
+	"crawshaw.io/sqlite"
+	"crawshaw.io/sqlite/sqlitex"
+)
+
+// ValidationLevel sets the checks performed by Validate.  Each level includes
+// the checks of the levels before it.
+type ValidationLevel uint8
+
+// ValidationLevel enum values
+const (
+	ValidationMetadata ValidationLevel = iota // metadata items; see ValidateMetadata
+	ValidationSchema                          // tables, columns, and indexes
+	ValidationTiles                           // tile coordinates; reads every tile
+)
+
+// String returns a string representing the ValidationLevel.
+func (l ValidationLevel) String() string {
+	switch l {
+	case ValidationMetadata:
+		return "metadata"
+	case ValidationSchema:
+		return "schema"
+	case ValidationTiles:
+		return "tiles"
+	default:
+		return ""
+	}
+}
+
+// Violation describes a way in which an mbtiles file does not conform to the
+// mbtiles specification.
+type Violation struct {
+	Level   ValidationLevel // level of the check that found the violation
+	Message string
+}
+
+// Error returns the message of the Violation, so that it can be used as an
+// error.
+func (v Violation) Error() string {
+	return v.Message
+}
+
+// specFormats are the values of the format metadata item allowed by version 1.3
+// of the mbtiles specification, in addition to IETF media types.
+var specFormats = map[string]bool{"pbf": true, "jpg": true, "png": true, "webp": true}
+
+// Validate checks the mbtiles file against version 1.3 of the mbtiles
+// specification at the given level, and returns all violations found.  err is
+// set only if the checks cannot be performed.
+//   - ValidationMetadata: the checks of ValidateMetadata, and that format is
+//     one of pbf, jpg, png, webp, or an IETF media type.
+//   - ValidationSchema: metadata has name and value columns and a unique index
+//     on name without duplicate names; tiles has zoom_level, tile_column,
+//     tile_row, and tile_data columns and, if it is a table, a unique index on
+//     zoom_level, tile_column, and tile_row.
+//   - ValidationTiles: tile_column and tile_row of every tile are within the
+//     valid range of tiles at its zoom level.
+func (db *MBtiles) Validate(level ValidationLevel) (violations []Violation, err error) {
+	if db == nil {
+		return nil, fmt.Errorf("cannot read metadata: %w", ErrDatabaseClosed)
+	}
+	if level > ValidationTiles {
+		return nil, fmt.Errorf("invalid validation level: %d", level)
+	}
+
+	detectedFormat := db.GetTileFormat()
+
+	con, err := db.getConnection(context.TODO())
+	defer db.closeConnection(con)
+	if err != nil {
+		return nil, err
+	}
+
+	checks := []func(*sqlite.Conn) ([]string, error){
+		func(con *sqlite.Conn) ([]string, error) {
+			return validateMetadataLevel(con, detectedFormat)
+		},
+		validateSchemaLevel,
+		validateTilesLevel,
+	}
+	for l := ValidationMetadata; l <= level; l++ {
+		messages, err := checks[l](con)
+		if err != nil {
+			return nil, err
+		}
+		for _, message := range messages {
+			violations = append(violations, Violation{Level: l, Message: message})
+		}
+	}
+	return violations, nil
+}
+
+// validateMetadataLevel performs the checks of ValidationMetadata using con.
+func validateMetadataLevel(con *sqlite.Conn, detectedFormat TileFormat) ([]string, error) {
+	errs, err := validateMetadata(con, detectedFormat)
+	if err != nil {
+		return nil, err
+	}
+	messages := make([]string, 0, len(errs))
+	for _, err := range errs {
+		messages = append(messages, err.Error())
+	}
+
+	format, present, err := readMetadataValue(con, "format")
+	if err != nil {
+		return nil, err
+	}
+	if present && !specFormats[format] && !strings.Contains(format, "/") {
+		messages = append(messages, fmt.Sprintf("metadata item format must be one of pbf, jpg, png, webp, or an IETF media type, got %q", format))
+	}
+	return messages, nil
+}
+
+// validateSchemaLevel performs the checks of ValidationSchema using con.
+func validateSchemaLevel(con *sqlite.Conn) ([]string, error) {
+	var messages []string
+
+	required := map[string][]string{
+		"metadata": {"name", "value"},
+		"tiles":    {"zoom_level", "tile_column", "tile_row", "tile_data"},
+	}
+	for _, table := range []string{"metadata", "tiles"} {
+		columns := make(map[string]bool)
+		err := sqlitex.Exec(con, "select name from pragma_table_info(?)", func(stmt *sqlite.Stmt) error {
+			columns[stmt.ColumnText(0)] = true
+			return nil
+		}, table)
+		if err != nil {
+			return nil, err
+		}
+		for _, column := range required[table] {
+			if !columns[column] {
+				messages = append(messages, fmt.Sprintf("'%s' is missing required column %s", table, column))
+			}
+		}
+	}
+
+	hasIndex, err := hasUniqueIndex(con, "metadata", "name")
+	if err != nil {
+		return nil, err
+	}
+	if !hasIndex {
+		messages = append(messages, "'metadata' is missing unique index on name")
+	}
+	err = sqlitex.Exec(con, "select name from metadata group by name having count(*) > 1", func(stmt *sqlite.Stmt) error {
+		messages = append(messages, fmt.Sprintf("metadata item %s is duplicated", stmt.ColumnText(0)))
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	// tiles may be a view in the deduplicated schema, which cannot be indexed
+	isTable := false
+	err = sqlitex.Exec(con, "select 1 from sqlite_master where type = 'table' and name = 'tiles'", func(stmt *sqlite.Stmt) error {
+		isTable = true
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	if isTable {
+		hasIndex, err = hasUniqueIndex(con, "tiles", "zoom_level", "tile_column", "tile_row")
+		if err != nil {
+			return nil, err
+		}
+		if !hasIndex {
+			messages = append(messages, "'tiles' is missing unique index on zoom_level, tile_column, tile_row")
+		}
+	}
+
+	return messages, nil
+}
+
+// hasUniqueIndex returns true if table has a unique index on exactly columns,
+// in any order.
+func hasUniqueIndex(con *sqlite.Conn, table string, columns ...string) (bool, error) {
+	var indexes []string
+	err := sqlitex.Exec(con, `select name from pragma_index_list(?) where "unique" = 1`, func(stmt *sqlite.Stmt) error {
+		indexes = append(indexes, stmt.ColumnText(0))
+		return nil
+	}, table)
+	if err != nil {
+		return false, err
+	}
+
+	for _, index := range indexes {
+		indexed := make(map[string]bool)
+		err = sqlitex.Exec(con, "select name from pragma_index_info(?)", func(stmt *sqlite.Stmt) error {
+			indexed[stmt.ColumnText(0)] = true
+			return nil
+		}, index)
+		if err != nil {
+			return false, err
+		}
+		if len(indexed) != len(columns) {
+			continue
+		}
+		match := true
+		for _, column := range columns {
+			match = match && indexed[column]
+		}
+		if match {
+			return true, nil
+		}
+	}
+	return false, nil
+}
+
+// validateTilesLevel performs the checks of ValidationTiles using con.
+func validateTilesLevel(con *sqlite.Conn) ([]string, error) {
+	var messages []string
+	err := sqlitex.Exec(con, `select zoom_level, count(*) from tiles
+		where zoom_level < 0 or zoom_level > ?
+		or tile_column < 0 or tile_column >= (1 << zoom_level)
+		or tile_row < 0 or tile_row >= (1 << zoom_level)
+		group by zoom_level order by zoom_level`, func(stmt *sqlite.Stmt) error {
+		z := stmt.ColumnInt64(0)
+		if z < 0 || z > maxZoom {
+			messages = append(messages, fmt.Sprintf("%d tiles have zoom level %d outside 0 to %d", stmt.ColumnInt64(1), z, maxZoom))
+			return nil
+		}
+		messages = append(messages, fmt.Sprintf("%d tiles at zoom level %d are outside the valid range of tiles", stmt.ColumnInt64(1), z))
+		return nil
+	}, maxZoom)
+	return messages, err
+}
@@ -0,0 +1,71 @@
+package mbtiles
+
+import (
+	"strings"
+	"testing"
+)
+
+func Test_Validate(t *testing.T) {
+	db, err := Open("./testdata/world_cities.mbtiles")
+	if err != nil {
+		t.Fatal("Could not open mbtiles:", err)
+	}
+	defer db.Close()
+
+	violations, err := db.Validate(ValidationTiles)
+	if err != nil {
+		t.Fatal("Unexpected error validating:", err)
+	}
+	if len(violations) != 0 {
+		t.Error("Unexpected violations for valid mbtiles:", violations)
+	}
+
+	if _, err = db.Validate(ValidationTiles + 1); err == nil {
+		t.Error("Invalid validation level did not raise error")
+	}
+}
+
+func Test_Validate_violations(t *testing.T) {
+	path := createTestMBtiles(t, `
+		INSERT INTO metadata VALUES ('format', 'image'), ('name', 'duplicate');
+		CREATE TABLE tiles (zoom_level integer, tile_column integer, tile_row integer, tile_data blob);
+		INSERT INTO tiles VALUES (0, 0, 0, x'89504e470d0a1a0a0000000d4948445200000100');
+		INSERT INTO tiles VALUES (1, 2, 0, x'89504e470d0a1a0a0000000d4948445200000100');
+	`)
+
+	db, err := Open(path)
+	if err != nil {
+		t.Fatal("Could not open:", path, err)
+	}
+	defer db.Close()
+
+	tests := []struct {
+		level    ValidationLevel
+		expected []string
+	}{
+		{level: ValidationMetadata, expected: []string{"format must be one of"}},
+		{level: ValidationSchema, expected: []string{"format must be one of", "'metadata' is missing unique index", "name is duplicated", "'tiles' is missing unique index"}},
+		{level: ValidationTiles, expected: []string{"format must be one of", "1 tiles at zoom level 1 are outside"}},
+	}
+
+	for _, tc := range tests {
+		violations, err := db.Validate(tc.level)
+		if err != nil {
+			t.Fatal("Unexpected error validating at level:", tc.level, err)
+		}
+		for _, violation := range violations {
+			if violation.Level > tc.level {
+				t.Error("Violation", violation, "found by check above level", tc.level)
+			}
+		}
+		for _, expected := range tc.expected {
+			found := false
+			for _, violation := range violations {
+				found = found || strings.Contains(violation.Message, expected)
+			}
+			if !found {
+				t.Error("Violations", violations, "do not contain expected value", expected, "at level", tc.level)
+			}
+		}
+	}
+}
@@ -0,0 +1,140 @@
+package mbtiles
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+
+	"crawshaw.io/sqlite"
+	"crawshaw.io/sqlite/sqlitex"
+)
+
+// WALOptions configure WAL journal mode for writing an mbtiles file, so that
+// it can be read by other processes while it is updated in place.  Readers in
+// other processes must open the file using WithWALReadOnly while it has an
+// associated -wal file.
+type WALOptions struct {
+	// Synchronous sets how often SQLite waits for data to be written to disk:
+	// "OFF", "NORMAL", "FULL", or "EXTRA".  NORMAL is safe from corruption in
+	// WAL mode but may lose the latest commits on power loss.  Defaults to the
+	// SQLite default (FULL) if empty.
+	Synchronous string
+
+	// AutoCheckpoint is the number of pages the -wal file may grow to before
+	// it is checkpointed (copied into the mbtiles file) after a commit.  A
+	// negative value disables automatic checkpoints; use Checkpoint instead.
+	// Defaults to the SQLite default (1000) if 0.
+	AutoCheckpoint int
+}
+
+// WithWAL switches the mbtiles file to WAL journal mode when it is opened;
+// see Options.WAL.
+func WithWAL(opts WALOptions) Option {
+	return func(o *Options) {
+		o.WAL = &opts
+	}
+}
+
+// validate checks that the WALOptions are valid.
+func (o WALOptions) validate() error {
+	switch strings.ToUpper(o.Synchronous) {
+	case "", "OFF", "NORMAL", "FULL", "EXTRA":
+		return nil
+	default:
+		return fmt.Errorf("Synchronous must be one of OFF, NORMAL, FULL, EXTRA, got: %q", o.Synchronous)
+	}
+}
+
+// EnableWAL switches the mbtiles file to WAL journal mode and configures each
+// connection in the pool using opts.  The journal mode is stored in the file,
+// so it remains in WAL mode when it is opened again.  Waits until all
+// connections have been returned to the pool.  db must have been opened for
+// writing, using Create or the SQLITE_OPEN_READWRITE flag.
+func (db *MBtiles) EnableWAL(opts WALOptions) error {
+	if db == nil {
+		return fmt.Errorf("cannot enable WAL: %w", ErrDatabaseClosed)
+	}
+	if err := opts.validate(); err != nil {
+		return err
+	}
+
+	pool := db.acquirePool()
+	if pool == nil {
+		return fmt.Errorf("cannot enable WAL: %w", ErrDatabaseClosed)
+	}
+	defer db.releasePool(pool)
+	if db.opts.Flags&sqlite.SQLITE_OPEN_READWRITE == 0 || db.opts.WALReadOnly {
+		return errors.New("cannot enable WAL for mbtiles database opened read-only")
+	}
+
+	err := configurePool(pool, db.opts.PoolSize, func(con *sqlite.Conn) error {
+		return setWAL(con, opts)
+	})
+	if err != nil {
+		return err
+	}
+	db.mu.Lock()
+	db.opts.WAL = &opts
+	db.mu.Unlock()
+	return nil
+}
+
+// Checkpoint copies all commits in the -wal file into the mbtiles file and
+// truncates the -wal file, e.g., after a batch of updates when AutoCheckpoint
+// is disabled.  Waits for readers in other processes to finish reading from
+// the -wal file; returns an error if they are still busy after the busy
+// timeout.  Has no effect if the file is not in WAL journal mode.
+func (db *MBtiles) Checkpoint() error {
+	if db == nil {
+		return fmt.Errorf("cannot checkpoint: %w", ErrDatabaseClosed)
+	}
+
+	con, err := db.getConnection(context.TODO())
+	defer db.closeConnection(con)
+	if err != nil {
+		return err
+	}
+
+	busy := false
+	err = sqlitex.ExecTransient(con, "PRAGMA wal_checkpoint(TRUNCATE)", func(stmt *sqlite.Stmt) error {
+		busy = stmt.ColumnInt(0) != 0
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+	if busy {
+		return errors.New("cannot checkpoint: database is in use by another connection")
+	}
+	return nil
+}
+
+// setWAL switches con to WAL journal mode and configures it using opts.
+func setWAL(con *sqlite.Conn, opts WALOptions) error {
+	var mode string
+	err := sqlitex.ExecTransient(con, "PRAGMA journal_mode = WAL", func(stmt *sqlite.Stmt) error {
+		mode = stmt.ColumnText(0)
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+	if !strings.EqualFold(mode, "wal") {
+		return fmt.Errorf("could not enable WAL journal mode, got: %q", mode)
+	}
+
+	if opts.Synchronous != "" {
+		err = sqlitex.ExecTransient(con, "PRAGMA synchronous = "+strings.ToUpper(opts.Synchronous), nil)
+		if err != nil {
+			return err
+		}
+	}
+	if opts.AutoCheckpoint != 0 {
+		err = sqlitex.ExecTransient(con, fmt.Sprintf("PRAGMA wal_autocheckpoint = %d", max(opts.AutoCheckpoint, 0)), nil)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
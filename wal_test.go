@@ -0,0 +1,74 @@
+package mbtiles
+
+import (
+	"bytes"
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func Test_EnableWAL(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "test.mbtiles")
+	db, err := Create(path, PNG)
+	if err != nil {
+		t.Fatal("Could not create:", path, err)
+	}
+	defer db.Close()
+
+	if err := db.EnableWAL(WALOptions{Synchronous: "bogus"}); err == nil {
+		t.Error("EnableWAL did not raise error for invalid Synchronous")
+	}
+	if err := db.EnableWAL(WALOptions{Synchronous: "normal", AutoCheckpoint: -1}); err != nil {
+		t.Fatal("Could not enable WAL:", err)
+	}
+
+	tile := []byte{0x89, 0x50, 0x4e, 0x47, 0x0d, 0x0a, 0x1a, 0x0a, 0, 0, 0, 0x0d, 0x49, 0x48, 0x44, 0x52, 0, 0, 1, 0, 0, 0, 1, 0}
+	if err := db.WriteTile(0, 0, 0, tile); err != nil {
+		t.Fatal("Could not write tile:", err)
+	}
+	if _, err := os.Stat(path + "-wal"); err != nil {
+		t.Fatal("-wal file not found after write:", err)
+	}
+
+	// readers must use WALReadOnly while the -wal file is present
+	if _, err := Open(path); !errors.Is(err, ErrWALPresent) {
+		t.Error("Open did not return ErrWALPresent, got:", err)
+	}
+	reader, err := Open(path, WithWALReadOnly())
+	if err != nil {
+		t.Fatal("Could not open reader:", err)
+	}
+	defer reader.Close()
+	var data []byte
+	if err := reader.ReadTile(0, 0, 0, &data); err != nil {
+		t.Fatal("Could not read tile:", err)
+	}
+	if !bytes.Equal(data, tile) {
+		t.Error("Read tile", data, "does not match expected value", tile)
+	}
+
+	if err := db.Checkpoint(); err != nil {
+		t.Error("Unexpected error during checkpoint:", err)
+	}
+
+	// writers can reopen the file while the -wal file is present
+	writer, err := OpenReadWrite(path, WithWAL(WALOptions{Synchronous: "NORMAL"}))
+	if err != nil {
+		t.Fatal("Could not open for writing:", err)
+	}
+	defer writer.Close()
+	if err := writer.DeleteTile(0, 0, 0); err != nil {
+		t.Error("Could not delete tile:", err)
+	}
+	if err := writer.Optimize(WithPageSize(8192)); err == nil {
+		t.Error("Optimize did not raise error for changing page size in WAL mode")
+	}
+
+	if _, err := Open(path, WithWAL(WALOptions{})); err == nil {
+		t.Error("Open did not raise error for WAL option with read-only flags")
+	}
+	if err := reader.EnableWAL(WALOptions{}); err == nil {
+		t.Error("EnableWAL did not raise error for read-only database")
+	}
+}
@@ -0,0 +1,432 @@
+package mbtiles
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"strings"
+
+	"crawshaw.io/sqlite"
+	"crawshaw.io/sqlite/sqlitex"
+)
+
+// createTilesetSchema creates the 'metadata' and 'tiles' tables according to
+// the mbtiles specification.
+func createTilesetSchema(con *sqlite.Conn) error {
+	return sqlitex.ExecScript(con, `
+		CREATE TABLE metadata (name text, value text);
+		CREATE UNIQUE INDEX name ON metadata (name);
+		CREATE TABLE tiles (zoom_level integer, tile_column integer, tile_row integer, tile_data blob);
+		CREATE UNIQUE INDEX tile_index ON tiles (zoom_level, tile_column, tile_row);
+	`)
+}
+
+// createDedupTilesetSchema creates the 'metadata' table and the deduplicated
+// schema, where tile data are stored once in the 'images' table and referenced
+// by tile_id from the 'map' table, and 'tiles' is a view joining them.
+func createDedupTilesetSchema(con *sqlite.Conn) error {
+	return sqlitex.ExecScript(con, `
+		CREATE TABLE metadata (name text, value text);
+		CREATE UNIQUE INDEX name ON metadata (name);
+		CREATE TABLE map (zoom_level integer, tile_column integer, tile_row integer, tile_id text, grid_id text);
+		CREATE UNIQUE INDEX map_index ON map (zoom_level, tile_column, tile_row);
+		CREATE TABLE images (tile_data blob, tile_id text);
+		CREATE UNIQUE INDEX images_id ON images (tile_id);
+		CREATE VIEW tiles AS
+			SELECT map.zoom_level AS zoom_level, map.tile_column AS tile_column, map.tile_row AS tile_row, images.tile_data AS tile_data
+			FROM map JOIN images ON images.tile_id = map.tile_id;
+	`)
+}
+
+// createTileset creates a new mbtiles file at path with the required tables,
+// using the deduplicated schema if dedup is true, and returns an open
+// read-write connection to it.  path must not already exist.
+func createTileset(path string, dedup bool) (*sqlite.Conn, error) {
+	if _, err := os.Stat(path); err == nil {
+		return nil, fmt.Errorf("refusing to overwrite existing file: %q", path)
+	} else if !errors.Is(err, os.ErrNotExist) {
+		return nil, err
+	}
+
+	con, err := sqlite.OpenConn(path, sqlite.SQLITE_OPEN_CREATE|sqlite.SQLITE_OPEN_READWRITE|sqlite.SQLITE_OPEN_NOMUTEX)
+	if err != nil {
+		return nil, err
+	}
+
+	if dedup {
+		err = createDedupTilesetSchema(con)
+	} else {
+		err = createTilesetSchema(con)
+	}
+	if err != nil {
+		con.Close()
+		os.Remove(path)
+		return nil, err
+	}
+	return con, nil
+}
+
+// createFlags are the flags used to open connections in the connection pool
+// of an MBtiles created using Create.
+const createFlags = sqlite.SQLITE_OPEN_READWRITE | sqlite.SQLITE_OPEN_NOMUTEX
+
+// Create creates a new mbtiles file at path with the standard 'tiles' and
+// 'metadata' tables, and opens it for reading and writing.  format is stored
+// in the metadata table.  path must not already exist.
+func Create(path string, format TileFormat) (*MBtiles, error) {
+	return CreateWithMetadata(path, format, nil)
+}
+
+// CreateWithMetadata creates a new mbtiles file at path as for Create, and also
+// writes the metadata items in metadata.  Returns an error if metadata contains
+// a format that does not match format.
+func CreateWithMetadata(path string, format TileFormat, metadata map[string]string) (*MBtiles, error) {
+	return create(path, format, metadata, false)
+}
+
+// CreateDeduplicated creates a new mbtiles file at path as for
+// CreateWithMetadata, but stores each distinct tile only once: tiles are
+// identified by the MD5 hash of their data (see HashTile), and writing a tile
+// that is already present only adds a reference to it.  This greatly reduces
+// the size of tilesets with many identical tiles, such as ocean or empty tiles.
+func CreateDeduplicated(path string, format TileFormat, metadata map[string]string) (*MBtiles, error) {
+	return create(path, format, metadata, true)
+}
+
+// create creates a new mbtiles file at path with format and metadata, using
+// the deduplicated schema if dedup is true.
+func create(path string, format TileFormat, metadata map[string]string, dedup bool) (*MBtiles, error) {
+	if format.String() == "" || format == GZIP {
+		return nil, fmt.Errorf("unsupported tile format: %q", format)
+	}
+	if value, ok := metadata["format"]; ok && value != format.String() {
+		return nil, fmt.Errorf("metadata item format %q does not match tile format %q", value, format)
+	}
+
+	con, err := createTileset(path, dedup)
+	if err != nil {
+		return nil, err
+	}
+	err = writeMetadataValue(con, "format", format.String())
+	for key, value := range metadata {
+		if err != nil {
+			break
+		}
+		err = writeMetadataValue(con, key, value)
+	}
+	con.Close()
+	if err != nil {
+		os.Remove(path)
+		return nil, err
+	}
+
+	modTime, err := getModTime(path, false, false)
+	if err != nil {
+		return nil, err
+	}
+	file, err := os.Stat(path)
+	if err != nil {
+		return nil, err
+	}
+
+	opts := Options{PoolSize: defaultPoolSize, Flags: createFlags}
+	pool, err := sqlitex.Open(path, opts.Flags, opts.PoolSize)
+	if err != nil {
+		return nil, err
+	}
+
+	db := &MBtiles{
+		filename:  path,
+		pool:      pool,
+		timestamp: modTime,
+		file:      file,
+		format:    format,
+		scheme:    "tms",
+		dedup:     dedup,
+		opts:      opts,
+	}
+	trackHandle(db)
+
+	return db, nil
+}
+
+// OpenReadWrite opens an existing MBtiles file for incremental updates, e.g.,
+// using WriteTile, DeleteTile, and SetMetadata.  The file is validated as for
+// Open, but the connections in the pool are opened for writing; the Flags
+// option is ignored.  Returns an error if the WALReadOnly option is set.
+// Tiles of files using the deduplicated schema are written to the 'map' and
+// 'images' tables as for CreateDeduplicated; tiles cannot be written to files
+// where tiles is some other view.
+func OpenReadWrite(path string, opts ...Option) (*MBtiles, error) {
+	var options Options
+	for _, opt := range opts {
+		opt(&options)
+	}
+	if options.WALReadOnly {
+		return nil, errors.New("cannot open mbtiles database for writing with WALReadOnly option")
+	}
+	options.Flags = createFlags
+	return OpenWithOptions(path, options)
+}
+
+// WriteTile inserts the tile for z, x, y, replacing the existing tile if there
+// is one, e.g., to update tiles that have been re-rendered.  y must be in the
+// TMS scheme used by mbtiles.  db must have been opened for writing, using
+// Create or the SQLITE_OPEN_READWRITE flag.
+func (db *MBtiles) WriteTile(z int64, x int64, y int64, data []byte) error {
+	if db == nil {
+		return fmt.Errorf("cannot write tile: %w", ErrDatabaseClosed)
+	}
+
+	con, err := db.getConnection(context.TODO())
+	defer db.closeConnection(con)
+	if err != nil {
+		return err
+	}
+
+	if db.opts.Flags&sqlite.SQLITE_OPEN_READWRITE == 0 {
+		return errors.New("cannot write tile to mbtiles database opened read-only")
+	}
+
+	// cached metadata may include minzoom and maxzoom inferred from the tiles
+	defer db.InvalidateMetadata()
+	write := writeTile
+	if db.isDedup() {
+		write = writeDedupTile
+	}
+	if err = write(con, z, x, y, data); err != nil {
+		return err
+	}
+	return db.updateZoomRange(con)
+}
+
+// DeleteTile deletes the tile for z, x, y.  y must be in the TMS scheme used
+// by mbtiles.  It is not an error if the tile does not exist.  db must have
+// been opened for writing, using Create or the SQLITE_OPEN_READWRITE flag.
+// In deduplicated files, tile data that are no longer used are kept until
+// Optimize is called.
+func (db *MBtiles) DeleteTile(z int64, x int64, y int64) error {
+	if db == nil {
+		return fmt.Errorf("cannot delete tile: %w", ErrDatabaseClosed)
+	}
+
+	con, err := db.getConnection(context.TODO())
+	defer db.closeConnection(con)
+	if err != nil {
+		return err
+	}
+
+	if db.opts.Flags&sqlite.SQLITE_OPEN_READWRITE == 0 {
+		return errors.New("cannot delete tile from mbtiles database opened read-only")
+	}
+
+	defer db.InvalidateMetadata()
+	table := "tiles"
+	if db.isDedup() {
+		table = "map"
+	}
+	err = sqlitex.Exec(con, "delete from "+table+" where zoom_level = ? and tile_column = ? and tile_row = ?", nil, z, x, y)
+	if err != nil {
+		return err
+	}
+	return db.updateZoomRange(con)
+}
+
+// WriteMetadata inserts or replaces the metadata item for key.  db must have
+// been opened for writing, using Create or the SQLITE_OPEN_READWRITE flag.
+func (db *MBtiles) WriteMetadata(key string, value string) error {
+	return db.SetMetadata(map[string]string{key: value})
+}
+
+// SetMetadata inserts or replaces the metadata items in values in a single
+// transaction, e.g., to correct the bounds or attribution of an existing file.
+// db must have been opened for writing, using Create or the
+// SQLITE_OPEN_READWRITE flag.
+func (db *MBtiles) SetMetadata(values map[string]string) (err error) {
+	if db == nil {
+		return fmt.Errorf("cannot write metadata: %w", ErrDatabaseClosed)
+	}
+
+	con, err := db.getConnection(context.TODO())
+	defer db.closeConnection(con)
+	if err != nil {
+		return err
+	}
+
+	if db.opts.Flags&sqlite.SQLITE_OPEN_READWRITE == 0 {
+		return errors.New("cannot write metadata to mbtiles database opened read-only")
+	}
+
+	defer db.InvalidateMetadata()
+	err = writeMetadataValues(con, values)
+	if err != nil {
+		return err
+	}
+	// minzoom and maxzoom may have been written
+	return db.updateZoomRange(con)
+}
+
+// writeMetadataValues inserts or replaces the metadata items in values using
+// con within a single savepoint.
+func writeMetadataValues(con *sqlite.Conn, values map[string]string) (err error) {
+	defer sqlitex.Save(con)(&err)
+	for key, value := range values {
+		if err = writeMetadataValue(con, key, value); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// BackupTo copies the database to a new mbtiles file at path, including
+// databases opened using OpenInMemory.  path must not already exist, and is
+// removed on error.
+func (db *MBtiles) BackupTo(path string) (err error) {
+	if db == nil {
+		return fmt.Errorf("cannot read: %w", ErrDatabaseClosed)
+	}
+	if _, err := os.Stat(path); err == nil {
+		return fmt.Errorf("refusing to overwrite existing file: %q", path)
+	} else if !errors.Is(err, os.ErrNotExist) {
+		return err
+	}
+
+	con, err := db.getConnection(context.TODO())
+	defer db.closeConnection(con)
+	if err != nil {
+		return err
+	}
+
+	dstCon, err := sqlite.OpenConn(path, sqlite.SQLITE_OPEN_CREATE|sqlite.SQLITE_OPEN_READWRITE|sqlite.SQLITE_OPEN_NOMUTEX)
+	if err != nil {
+		return err
+	}
+	defer func() {
+		dstCon.Close()
+		if err != nil {
+			os.Remove(path)
+		}
+	}()
+
+	bkp, err := con.BackupInit("", "", dstCon)
+	if err != nil {
+		return fmt.Errorf("backup to %s: %w", path, err)
+	}
+	if err = bkp.Step(-1); err != nil {
+		bkp.Finish()
+		return fmt.Errorf("transfer whole db: %w", err)
+	}
+	return bkp.Finish()
+}
+
+// OptimizeOption sets an option for Optimize.
+type OptimizeOption func(*optimizeOptions)
+
+type optimizeOptions struct {
+	pageSize int
+}
+
+// WithPageSize sets the page size of the mbtiles file when it is vacuumed by
+// Optimize.  size must be a power of two from 512 to 65536; larger pages may
+// reduce the size of files with large tiles.  The page size cannot be changed
+// for files in WAL journal mode.
+func WithPageSize(size int) OptimizeOption {
+	return func(o *optimizeOptions) {
+		o.pageSize = size
+	}
+}
+
+// Optimize runs VACUUM, ANALYZE, and PRAGMA optimize to defragment the mbtiles
+// file and update query planner statistics, e.g., after many tiles have been
+// replaced.  In deduplicated files, tile data no longer used by any tile are
+// deleted first.  db must have been opened for writing, using Create or the
+// SQLITE_OPEN_READWRITE flag.
+func (db *MBtiles) Optimize(opts ...OptimizeOption) error {
+	if db == nil {
+		return fmt.Errorf("cannot optimize: %w", ErrDatabaseClosed)
+	}
+
+	var options optimizeOptions
+	for _, opt := range opts {
+		opt(&options)
+	}
+	if size := options.pageSize; size != 0 && (size < 512 || size > 65536 || size&(size-1) != 0) {
+		return fmt.Errorf("page size must be a power of two from 512 to 65536, got: %d", size)
+	}
+
+	con, err := db.getConnection(context.TODO())
+	defer db.closeConnection(con)
+	if err != nil {
+		return err
+	}
+
+	if db.opts.Flags&sqlite.SQLITE_OPEN_READWRITE == 0 {
+		return errors.New("cannot optimize mbtiles database opened read-only")
+	}
+
+	if db.isDedup() {
+		if err = deleteUnusedImages(con); err != nil {
+			return err
+		}
+	}
+
+	if options.pageSize != 0 {
+		var mode string
+		err = sqlitex.ExecTransient(con, "PRAGMA journal_mode", func(stmt *sqlite.Stmt) error {
+			mode = stmt.ColumnText(0)
+			return nil
+		})
+		if err != nil {
+			return err
+		}
+		if strings.EqualFold(mode, "wal") {
+			return errors.New("cannot change page size of mbtiles database in WAL journal mode")
+		}
+		err = sqlitex.ExecTransient(con, fmt.Sprintf("PRAGMA page_size = %d", options.pageSize), nil)
+		if err != nil {
+			return err
+		}
+	}
+
+	err = sqlitex.ExecTransient(con, "VACUUM", nil)
+	if err != nil {
+		return err
+	}
+	err = sqlitex.ExecTransient(con, "ANALYZE", nil)
+	if err != nil {
+		return err
+	}
+	return sqlitex.ExecTransient(con, "PRAGMA optimize", nil)
+}
+
+// writeTile inserts or replaces the tile for z, x, y using con.  y must be in
+// the TMS scheme used by mbtiles.
+func writeTile(con *sqlite.Conn, z int64, x int64, y int64, data []byte) error {
+	query, err := con.Prepare("insert or replace into tiles (zoom_level, tile_column, tile_row, tile_data) values ($z, $x, $y, $data)")
+	if err != nil {
+		return err
+	}
+	defer query.Reset()
+
+	query.SetInt64("$z", z)
+	query.SetInt64("$x", x)
+	query.SetInt64("$y", y)
+	query.SetBytes("$data", data)
+
+	_, err = query.Step()
+	return err
+}
+
+// writeMetadataValue inserts or replaces the metadata item for name using con.
+// Existing items are deleted first, since the unique index on name is not
+// present in all mbtiles files.
+func writeMetadataValue(con *sqlite.Conn, name string, value string) (err error) {
+	defer sqlitex.Save(con)(&err)
+
+	err = sqlitex.Exec(con, "delete from metadata where name = ?", nil, name)
+	if err != nil {
+		return err
+	}
+	return sqlitex.Exec(con, "insert into metadata (name, value) values (?, ?)", nil, name, value)
+}
@@ -0,0 +1,418 @@
+package mbtiles
+
+import (
+	"bytes"
+	"context"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"crawshaw.io/sqlite"
+	"crawshaw.io/sqlite/sqlitex"
+)
+
+func Test_Create(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "test.mbtiles")
+
+	db, err := Create(path, PNG)
+	if err != nil {
+		t.Fatal("Could not create:", path, err)
+	}
+	defer db.Close()
+
+	if db.GetTileFormat() != PNG {
+		t.Error("Created tile format", db.GetTileFormat(), "does not match expected value", PNG)
+	}
+
+	src, err := Open("./testdata/geography-class-png.mbtiles")
+	if err != nil {
+		t.Fatal("Could not open source:", err)
+	}
+	defer src.Close()
+	var tile []byte
+	err = src.ReadTile(0, 0, 0, &tile)
+	if err != nil {
+		t.Fatal("Could not read source tile:", err)
+	}
+
+	var data []byte
+	for _, expected := range [][]byte{{1, 2, 3}, tile} {
+		err = db.WriteTile(1, 0, 1, expected)
+		if err != nil {
+			t.Fatal("Could not write tile:", err)
+		}
+		err = db.ReadTile(1, 0, 1, &data)
+		if err != nil {
+			t.Fatal("Could not read tile:", err)
+		}
+		if !bytes.Equal(data, expected) {
+			t.Error("Read tile", data, "does not match expected value", expected)
+		}
+	}
+
+	err = db.WriteMetadata("name", "test")
+	if err != nil {
+		t.Fatal("Could not write metadata:", err)
+	}
+	metadata, err := db.ReadMetadata()
+	if err != nil {
+		t.Fatal("Could not read metadata:", err)
+	}
+	if metadata["name"] != "test" {
+		t.Error("Metadata name", metadata["name"], "does not match expected value: test")
+	}
+	if metadata["format"] != "png" {
+		t.Error("Metadata format", metadata["format"], "does not match expected value: png")
+	}
+
+	// file can be opened read-only once written
+	ro, err := Open(path)
+	if err != nil {
+		t.Fatal("Could not open created file:", err)
+	}
+	defer ro.Close()
+	if ro.GetTileFormat() != PNG {
+		t.Error("Opened tile format", ro.GetTileFormat(), "does not match expected value", PNG)
+	}
+
+	// refuse to overwrite existing file
+	_, err = Create(path, PNG)
+	if err == nil {
+		t.Error("Create did not raise error for existing file")
+	}
+}
+
+func Test_Create_invalid(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "test.mbtiles")
+	_, err := Create(path, UNKNOWN)
+	if err == nil {
+		t.Error("Create did not raise error for unknown tile format")
+	}
+}
+
+func Test_WriteTile_closed(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "test.mbtiles")
+	db, err := Create(path, PNG)
+	if err != nil {
+		t.Fatal("Could not create:", path, err)
+	}
+	db.Close()
+
+	err = db.WriteTile(0, 0, 0, []byte{1})
+	if err == nil {
+		t.Error("WriteTile did not raise error for closed database")
+	}
+}
+
+func Test_OpenReadWrite(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "test.mbtiles")
+	replaceTestFile(t, "./testdata/world_cities.mbtiles", path, time.Now())
+
+	db, err := OpenReadWrite(path)
+	if err != nil {
+		t.Fatal("Could not open for writing:", path, err)
+	}
+	defer db.Close()
+
+	if err := db.WriteTile(1, 0, 0, []byte{1, 2, 3}); err != nil {
+		t.Error("Could not write tile:", err)
+	}
+	if err := db.DeleteTile(1, 1, 1); err != nil {
+		t.Error("Could not delete tile:", err)
+	}
+	if err := db.WriteMetadata("name", "updated"); err != nil {
+		t.Error("Could not write metadata:", err)
+	}
+
+	var data []byte
+	if err := db.ReadTile(1, 0, 0, &data); err != nil {
+		t.Fatal("Could not read tile:", err)
+	}
+	if !bytes.Equal(data, []byte{1, 2, 3}) {
+		t.Error("Read tile", data, "does not match expected value: [1 2 3]")
+	}
+	exists, err := db.HasTile(1, 1, 1)
+	if err != nil {
+		t.Fatal("Could not check tile:", err)
+	}
+	if exists {
+		t.Error("Tile still exists after DeleteTile")
+	}
+
+	_, err = OpenReadWrite(path, WithWALReadOnly())
+	if err == nil {
+		t.Error("OpenReadWrite did not raise error for WALReadOnly option")
+	}
+
+	_, err = OpenReadWrite(filepath.Join(t.TempDir(), "missing.mbtiles"))
+	if err == nil {
+		t.Error("OpenReadWrite did not raise error for missing file")
+	}
+}
+
+func Test_DeleteTile(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "test.mbtiles")
+	db, err := Create(path, PNG)
+	if err != nil {
+		t.Fatal("Could not create:", path, err)
+	}
+	defer db.Close()
+
+	if err := db.WriteTile(1, 0, 1, []byte{1}); err != nil {
+		t.Fatal("Could not write tile:", err)
+	}
+	if err := db.DeleteTile(1, 0, 1); err != nil {
+		t.Fatal("Could not delete tile:", err)
+	}
+	exists, err := db.HasTile(1, 0, 1)
+	if err != nil {
+		t.Fatal("Could not check tile:", err)
+	}
+	if exists {
+		t.Error("Tile still exists after DeleteTile")
+	}
+	if err := db.DeleteTile(1, 0, 1); err != nil {
+		t.Error("Unexpected error deleting missing tile:", err)
+	}
+
+	ro, err := Open("./testdata/geography-class-png.mbtiles")
+	if err != nil {
+		t.Fatal("Could not open mbtiles:", err)
+	}
+	defer ro.Close()
+	if err := ro.WriteTile(1, 0, 1, []byte{1}); err == nil {
+		t.Error("WriteTile did not raise error for read-only database")
+	}
+	if err := ro.DeleteTile(1, 0, 1); err == nil {
+		t.Error("DeleteTile did not raise error for read-only database")
+	}
+}
+
+func Test_WriteTile_metadata(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "test.mbtiles")
+	db, err := Create(path, PNG)
+	if err != nil {
+		t.Fatal("Could not create:", path, err)
+	}
+	defer db.Close()
+
+	// minzoom and maxzoom are inferred from the tiles, so they are read again
+	// after tiles are written or deleted
+	tests := []struct {
+		write   func() error
+		maxZoom int
+	}{
+		{write: func() error { return db.WriteTile(0, 0, 0, []byte{1}) }, maxZoom: 0},
+		{write: func() error { return db.WriteTile(5, 0, 0, []byte{1}) }, maxZoom: 5},
+		{write: func() error { return db.DeleteTile(5, 0, 0) }, maxZoom: 0},
+		{write: func() error {
+			w, err := db.BatchWriter(context.Background(), 0, 0, WithoutMetadataUpdate())
+			if err != nil {
+				return err
+			}
+			if err := w.WriteTile(3, 0, 0, []byte{1}); err != nil {
+				return err
+			}
+			return w.Close()
+		}, maxZoom: 3},
+	}
+	for _, tc := range tests {
+		if err := tc.write(); err != nil {
+			t.Fatal("Could not write tile:", err)
+		}
+		metadata, err := db.ReadMetadata()
+		if err != nil {
+			t.Fatal("Could not read metadata:", err)
+		}
+		if metadata["maxzoom"] != tc.maxZoom {
+			t.Error("maxzoom", metadata["maxzoom"], "does not match expected value", tc.maxZoom)
+		}
+	}
+}
+
+func Test_WriteTile_zoomRange(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "test.mbtiles")
+	db, err := Create(path, PNG)
+	if err != nil {
+		t.Fatal("Could not create:", path, err)
+	}
+	defer db.Close()
+
+	tests := []struct {
+		write   func() error
+		minZoom int64
+		maxZoom int64
+	}{
+		{write: func() error { return db.WriteTile(2, 0, 0, []byte{1}) }, minZoom: 2, maxZoom: 2},
+		{write: func() error { return db.WriteTile(5, 0, 0, []byte{1}) }, minZoom: 2, maxZoom: 5},
+		{write: func() error { return db.DeleteTile(5, 0, 0) }, minZoom: 2, maxZoom: 2},
+		// metadata items take precedence over the tiles, as when opened
+		{write: func() error { return db.SetMetadata(map[string]string{"minzoom": "1", "maxzoom": "10"}) }, minZoom: 1, maxZoom: 10},
+	}
+	for _, tc := range tests {
+		if err := tc.write(); err != nil {
+			t.Fatal("Could not write:", err)
+		}
+		if db.GetMinZoom() != tc.minZoom || db.GetMaxZoom() != tc.maxZoom {
+			t.Error("Zoom range", db.GetMinZoom(), db.GetMaxZoom(), "does not match expected value", tc.minZoom, tc.maxZoom)
+		}
+	}
+}
+
+func Test_Optimize(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "test.mbtiles")
+	db, err := Create(path, PBF)
+	if err != nil {
+		t.Fatal("Could not create:", path, err)
+	}
+	defer db.Close()
+
+	tile := []byte{0x1f, 0x8b, 0x08, 0x00, 0x00, 0x00, 0x00, 0x00}
+	for i := int64(0); i < 4; i++ {
+		if err := db.WriteTile(2, i, 0, tile); err != nil {
+			t.Fatal("Could not write tile:", err)
+		}
+	}
+
+	if err := db.Optimize(); err != nil {
+		t.Error("Unexpected error optimizing:", err)
+	}
+
+	if err := db.Optimize(WithPageSize(1000)); err == nil {
+		t.Error("Optimize did not raise error for invalid page size")
+	}
+	if err := db.Optimize(WithPageSize(8192)); err != nil {
+		t.Error("Unexpected error optimizing with page size:", err)
+	}
+	con, err := sqlite.OpenConn(path, sqlite.SQLITE_OPEN_READONLY)
+	if err != nil {
+		t.Fatal("Could not open:", path, err)
+	}
+	var pageSize int64
+	err = sqlitex.ExecTransient(con, "PRAGMA page_size", func(stmt *sqlite.Stmt) error {
+		pageSize = stmt.ColumnInt64(0)
+		return nil
+	})
+	con.Close()
+	if err != nil {
+		t.Fatal("Could not read page size:", err)
+	}
+	if pageSize != 8192 {
+		t.Error("Page size", pageSize, "does not match expected value: 8192")
+	}
+
+	ro, err := Open(path)
+	if err != nil {
+		t.Fatal("Could not open:", path, err)
+	}
+	defer ro.Close()
+	if err := ro.Optimize(); err == nil {
+		t.Error("Optimize did not raise error for read-only database")
+	}
+}
+
+func Test_BackupTo(t *testing.T) {
+	tests := []struct {
+		name string
+		open func(path string) (*MBtiles, error)
+	}{
+		{name: "file", open: func(path string) (*MBtiles, error) { return Open(path) }},
+		{name: "in-memory", open: OpenInMemory},
+	}
+
+	for _, tc := range tests {
+		db, err := tc.open("./testdata/geography-class-png.mbtiles")
+		if err != nil {
+			t.Fatal("Could not open mbtiles:", tc.name, err)
+		}
+		defer db.Close()
+
+		path := filepath.Join(t.TempDir(), "backup.mbtiles")
+		if err := db.BackupTo(path); err != nil {
+			t.Fatal("Unexpected error backing up", tc.name, "database:", err)
+		}
+
+		backup, err := Open(path)
+		if err != nil {
+			t.Fatal("Could not open backup of", tc.name, "database:", err)
+		}
+		defer backup.Close()
+
+		var data []byte
+		if err := backup.ReadTile(0, 0, 0, &data); err != nil || len(data) != 21246 {
+			t.Error("Could not read tile from backup of", tc.name, "database:", err)
+		}
+
+		if err := db.BackupTo(path); err == nil {
+			t.Error("BackupTo did not raise error for existing file")
+		}
+	}
+}
+
+func Test_SetMetadata(t *testing.T) {
+	// metadata table has no unique index on name
+	path := createTestMBtiles(t, `
+		CREATE TABLE tiles (zoom_level integer, tile_column integer, tile_row integer, tile_data blob);
+		INSERT INTO tiles VALUES (0, 0, 0, x'89504e470d0a1a0a0000000d4948445200000100');
+	`)
+
+	db, err := Open(path, WithFlags(sqlite.SQLITE_OPEN_READWRITE|sqlite.SQLITE_OPEN_NOMUTEX))
+	if err != nil {
+		t.Fatal("Could not open:", path, err)
+	}
+	defer db.Close()
+
+	err = db.SetMetadata(map[string]string{"name": "updated", "attribution": "test attribution"})
+	if err != nil {
+		t.Fatal("Could not set metadata:", err)
+	}
+
+	var count int64
+	err = db.WithConnection(context.Background(), func(con *sqlite.Conn) error {
+		count, err = sqlitex.ResultInt64(con.Prep("select count(*) from metadata where name = 'name'"))
+		return err
+	})
+	if err != nil || count != 1 {
+		t.Error("SetMetadata did not replace existing metadata item, got count:", count, err)
+	}
+
+	metadata, err := db.ReadMetadata()
+	if err != nil {
+		t.Fatal("Could not read metadata:", err)
+	}
+	if metadata["name"] != "updated" || metadata["attribution"] != "test attribution" {
+		t.Error("SetMetadata did not write expected values, got:", metadata)
+	}
+
+	ro, err := Open(path)
+	if err != nil {
+		t.Fatal("Could not open:", path, err)
+	}
+	defer ro.Close()
+	if err = ro.WriteMetadata("name", "other"); err == nil {
+		t.Error("WriteMetadata did not raise error for database opened read-only")
+	}
+}
+
+func Test_CreateWithMetadata(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "test.mbtiles")
+
+	db, err := CreateWithMetadata(path, PBF, map[string]string{"name": "test", "minzoom": "0", "maxzoom": "4"})
+	if err != nil {
+		t.Fatal("Could not create:", path, err)
+	}
+	defer db.Close()
+
+	metadata, err := db.ReadMetadata()
+	if err != nil {
+		t.Fatal("Could not read metadata:", err)
+	}
+	if metadata["name"] != "test" || metadata["format"] != "pbf" || metadata["maxzoom"] != 4 {
+		t.Error("Metadata do not match expected values, got:", metadata)
+	}
+
+	_, err = CreateWithMetadata(filepath.Join(t.TempDir(), "test.mbtiles"), PBF, map[string]string{"format": "png"})
+	if err == nil {
+		t.Error("CreateWithMetadata did not raise error for mismatched format")
+	}
+}